@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
@@ -13,10 +14,17 @@ func main() {
 
 	err := root.Execute()
 	if err != nil {
+		var exitErr *wwclient.ExitError
+		if errors.As(err, &exitErr) && exitErr.Err == nil {
+			os.Exit(exitErr.Code)
+		}
 		fmt.Fprintf(os.Stderr, "ERROR: %s\n", err)
 		if wwclient.DebugFlag {
 			fmt.Printf("\nSTACK TRACE: %+v\n", err)
 		}
+		if exitErr != nil {
+			os.Exit(exitErr.Code)
+		}
 		os.Exit(255)
 	}
 }
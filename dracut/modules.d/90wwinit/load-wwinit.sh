@@ -3,25 +3,67 @@
 info "Mounting tmpfs at $NEWROOT"
 mount -t tmpfs -o mpol=interleave ${wwinit_tmpfs_size_option} tmpfs "$NEWROOT"
 
+# Request the compressed images if they can be decompressed here, and
+# fall back to the uncompressed images otherwise.
+compress=""
+decompress="cat"
+case "${wwinit_compress}" in
+    zstd)
+        if command -v zstd >/dev/null
+        then
+            compress="zstd"
+            decompress="zstd -dc"
+        fi
+        ;;
+    gz)
+        if command -v gzip >/dev/null
+        then
+            compress="gz"
+            decompress="gzip -d"
+        fi
+        ;;
+esac
+info "Requesting images with compress=${compress}"
+
 for stage in "image" "system" "runtime"
 do
     info "Loading stage: ${stage}"
-    # Load runtime overlay from a static privledged port.
-    # Others use default settings.
+    # Load the overlays from a privileged port, which warewulfd requires
+    # in secure mode and with node tokens. Others use default settings.
     localport=""
-    if [[ "${stage}" == "runtime" ]]
+    if [[ "${stage}" == "system" || "${stage}" == "runtime" ]]
     then
         localport="--local-port 1-1023"
     fi
+    # With node tokens, the system overlay holds the token of this node,
+    # which the runtime overlay request is signed with like wwclient does.
+    signature=""
+    if [[ "${stage}" == "runtime" && -s "${NEWROOT}/warewulf/token" ]]
+    then
+        if ! command -v openssl >/dev/null
+        then
+            warn "Unable to sign the runtime overlay request without openssl, wwclient will load it"
+            continue
+        fi
+        hwaddr="${wwinit_uri##*/}"
+        hwaddr="${hwaddr,,}"
+        hwaddr="${hwaddr//-/:}"
+        timestamp="$(date +%s)"
+        token="$(printf '%s\n%s' "${hwaddr}" "${timestamp}" \
+            | openssl dgst -sha256 -hmac "$(cat "${NEWROOT}/warewulf/token")" -r \
+            | cut -d ' ' -f 1)"
+        signature="--data-urlencode timestamp=${timestamp} --data-urlencode token=${token}"
+    fi
     (
         curl --location --silent --get ${localport} \
             --retry 60 --retry-delay 1 \
             --data-urlencode "assetkey=${wwinit_assetkey}" \
             --data-urlencode "uuid=${wwinit_uuid}" \
             --data-urlencode "stage=${stage}" \
-            --data-urlencode "compress=gz" \
+            --data-urlencode "compress=${compress}" \
+            ${signature} \
             "${wwinit_uri}" \
-        | gzip -d \
+        | ${decompress} \
         | cpio -im --directory="${NEWROOT}"
     ) || die "Unable to load stage: ${stage}"
 done
@@ -10,6 +10,10 @@ then
     export wwinit_assetkey=$(dmidecode -s chassis-asset-tag)
     export wwinit_uri="$(getarg wwinit.uri)"
 
+    # images are gzip compressed unless the server says otherwise
+    export wwinit_compress="$(getarg wwinit.compress=)"
+    [ -z "${wwinit_compress}" ] && export wwinit_compress=gz
+
     wwinit_tmpfs_size=$(getarg wwinit.tmpfs.size=)
     if [ -n "$wwinit_tmpfs_size" ]
     then
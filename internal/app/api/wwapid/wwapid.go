@@ -324,6 +324,18 @@ func (s *apiServer) NodeStatus(ctx context.Context, request *wwapiv1.NodeNames)
 	return apinode.NodeStatus(request.NodeNames)
 }
 
+// NodeStatusWatch streams the status of nodes each time warewulfd records
+// a status update.
+func (s *apiServer) NodeStatusWatch(request *wwapiv1.NodeNames, stream wwapiv1.WWApi_NodeStatusWatchServer) error {
+
+	// Parameter checks. request.NodeNames can be nil.
+	if request == nil {
+		return status.Errorf(codes.InvalidArgument, "nil request")
+	}
+
+	return apinode.NodeStatusWatch(stream.Context(), request.NodeNames, stream.Send)
+}
+
 // Version returns the versions of the wwapiv1 and warewulf as well as the api
 // prefix for http routes.
 func (s *apiServer) Version(ctx context.Context, request *emptypb.Empty) (response *wwapiv1.VersionResponse, err error) {
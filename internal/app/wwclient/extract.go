@@ -0,0 +1,539 @@
+package wwclient
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/cavaliergopher/cpio"
+	securejoin "github.com/cyphar/filepath-securejoin"
+	"github.com/klauspost/compress/zstd"
+	"golang.org/x/sys/unix"
+
+	"github.com/warewulf/warewulf/internal/pkg/util"
+	"github.com/warewulf/warewulf/internal/pkg/wwlog"
+)
+
+/*
+Native extraction of the runtime overlay, so that nodes don't need cpio
+or the decompression tools. Files are replaced atomically by writing a
+temporary file next to them which is renamed over the old file.
+*/
+
+// the entry of the archive would be written outside of the extraction
+// directory
+var errEscape = errors.New("path escapes the extraction directory")
+
+// error of a single archive entry, which doesn't stop the extraction
+type entryError struct {
+	name string
+	err  error
+}
+
+func (e *entryError) Error() string {
+	return fmt.Sprintf("/%s: %s", e.name, e.err)
+}
+
+func (e *entryError) Unwrap() error {
+	return e.err
+}
+
+// result of the extraction of a runtime overlay
+type extraction struct {
+	// paths of the archive relative to the extraction directory
+	paths []string
+	// paths which were created or modified
+	changed []string
+	// errors of single entries
+	errs []error
+}
+
+/*
+Returns a reader of the runtime overlay decompressed from r
+*/
+func decompressReader(r io.Reader, format string) (io.ReadCloser, error) {
+	switch format {
+	case util.CompressGzip:
+		return gzip.NewReader(r)
+	case util.CompressZstd:
+		decoder, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	case util.CompressNone:
+		return io.NopCloser(r), nil
+	}
+	return nil, fmt.Errorf("unknown compression format: %s", format)
+}
+
+/*
+Decompresses the runtime overlay read from body and extracts it to root.
+Errors of single entries are returned with the extraction, an error is
+only returned if the archive can't be read.
+*/
+func extractOverlay(root string, body io.Reader, format string) (*extraction, error) {
+	decompressed, err := decompressReader(body, format)
+	if err != nil {
+		return &extraction{}, fmt.Errorf("could not decompress runtime overlay: %w", err)
+	}
+	defer decompressed.Close()
+	return extractArchive(root, decompressed)
+}
+
+/*
+Returns the path of an archive entry relative to the extraction
+directory, or an empty path for the extraction directory itself. Entries
+outside of it are refused.
+*/
+func entryPath(name string) (string, error) {
+	name = path.Clean(strings.TrimLeft(name, "/"))
+	if name == ".." || strings.HasPrefix(name, "../") {
+		return "", errEscape
+	}
+	if name == "." {
+		return "", nil
+	}
+	return name, nil
+}
+
+// reader which records whether the end of its input was reached
+type eofReader struct {
+	r   io.Reader
+	eof bool
+}
+
+func (e *eofReader) Read(p []byte) (n int, err error) {
+	n, err = e.r.Read(p)
+	if n == 0 && err == io.EOF {
+		e.eof = true
+	}
+	return n, err
+}
+
+type extractor struct {
+	root string
+	// ownership is only restored when running as root, like cpio does
+	chown bool
+	// paths of extracted files with multiple links by inode
+	links map[int64]string
+	// links to files whose content follows later in the archive
+	pending map[int64][]string
+}
+
+/*
+Extracts the newc archive read from r to root
+*/
+func extractArchive(root string, r io.Reader) (*extraction, error) {
+	ret := &extraction{}
+	x := &extractor{
+		root:    root,
+		chown:   os.Geteuid() == 0,
+		links:   make(map[int64]string),
+		pending: make(map[int64][]string),
+	}
+	input := &eofReader{r: r}
+	reader := cpio.NewReader(input)
+	for {
+		hdr, err := reader.Next()
+		if err == io.EOF && input.eof {
+			// the input ended before the trailer
+			err = io.ErrUnexpectedEOF
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return ret, fmt.Errorf("could not read runtime overlay: %w", err)
+		}
+		name, err := entryPath(hdr.Name)
+		if err != nil {
+			ret.errs = append(ret.errs, &entryError{strings.TrimLeft(hdr.Name, "/"), err})
+			continue
+		}
+		if name == "" {
+			continue
+		}
+		ret.paths = append(ret.paths, name)
+
+		// the content of hard linked files is stored with the last link
+		if hdr.Mode&cpio.ModeType == cpio.TypeReg && hdr.Links > 1 && hdr.Size == 0 {
+			if _, ok := x.links[hdr.Inode]; !ok {
+				x.pending[hdr.Inode] = append(x.pending[hdr.Inode], name)
+				continue
+			}
+		}
+		changed, err := x.extractEntry(name, hdr, reader)
+		if err != nil {
+			ret.errs = append(ret.errs, &entryError{name, err})
+		} else if changed {
+			ret.changed = append(ret.changed, name)
+		}
+		if hdr.Mode&cpio.ModeType == cpio.TypeReg && hdr.Links > 1 && err == nil {
+			x.extractPending(ret, hdr.Inode)
+		}
+	}
+	// links to content which was never sent are empty files
+	for inode, names := range x.pending {
+		hdr := &cpio.Header{Mode: cpio.TypeReg | 0o644, Links: len(names), Inode: inode}
+		name := names[0]
+		changed, err := x.extractEntry(name, hdr, bytes.NewReader(nil))
+		if err != nil {
+			ret.errs = append(ret.errs, &entryError{name, err})
+			continue
+		} else if changed {
+			ret.changed = append(ret.changed, name)
+		}
+		x.pending[inode] = names[1:]
+		x.extractPending(ret, inode)
+	}
+	// read to the end, so that the checksum of the compression is verified
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		return ret, fmt.Errorf("could not read runtime overlay: %w", err)
+	}
+	return ret, nil
+}
+
+/*
+Links the pending links to the extracted file with the given inode
+*/
+func (x *extractor) extractPending(ret *extraction, inode int64) {
+	for _, name := range x.pending[inode] {
+		changed, err := x.extractLink(name, x.links[inode])
+		if err != nil {
+			ret.errs = append(ret.errs, &entryError{name, err})
+		} else if changed {
+			ret.changed = append(ret.changed, name)
+		}
+	}
+	delete(x.pending, inode)
+}
+
+/*
+Returns the path an entry is extracted to. Symbolic links in the parent
+directories are resolved within the extraction directory, so that they
+can't point outside of it. The entry itself is replaced, not followed.
+*/
+func (x *extractor) target(name string) (string, error) {
+	dir, err := securejoin.SecureJoin(x.root, path.Dir(name))
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, path.Base(name)), nil
+}
+
+/*
+Returns a name for a temporary file in the directory of target
+*/
+func tempName(target string) string {
+	return filepath.Join(filepath.Dir(target),
+		"."+filepath.Base(target)+".wwclient-"+strconv.FormatUint(rand.Uint64(), 36))
+}
+
+/*
+Extracts a single entry and returns whether the path was changed
+*/
+func (x *extractor) extractEntry(name string, hdr *cpio.Header, r io.Reader) (changed bool, err error) {
+	target, err := x.target(name)
+	if err != nil {
+		return false, err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return false, err
+	}
+	switch hdr.Mode & cpio.ModeType {
+	case cpio.TypeReg:
+		changed, err = x.writeFile(target, hdr, r)
+		if err == nil && hdr.Links > 1 {
+			x.links[hdr.Inode] = target
+		}
+		return changed, err
+	case cpio.TypeDir:
+		return x.writeDir(target, hdr)
+	case cpio.TypeSymlink:
+		return x.writeSymlink(target, hdr)
+	case cpio.TypeFifo:
+		return x.writeFifo(target, hdr)
+	}
+	return false, fmt.Errorf("unsupported file type: %o", hdr.Mode&cpio.ModeType)
+}
+
+/*
+Returns the mode bits of a header which are set with chmod
+*/
+func permBits(hdr *cpio.Header) uint32 {
+	return uint32(hdr.Mode) & 0o7777
+}
+
+/*
+Returns whether the existing file has the type, mode and ownership of
+the header
+*/
+func (x *extractor) sameAttributes(stat os.FileInfo, hdr *cpio.Header) bool {
+	sys, ok := stat.Sys().(*syscall.Stat_t)
+	if !ok || sys.Mode&cpio.ModeType != uint32(hdr.Mode)&cpio.ModeType {
+		return false
+	}
+	if hdr.Mode&cpio.ModeType != cpio.TypeSymlink && sys.Mode&0o7777 != permBits(hdr) {
+		return false
+	}
+	return !x.chown || (int(sys.Uid) == hdr.Uid && int(sys.Gid) == hdr.Guid)
+}
+
+/*
+Sets the ownership and mode of the header on the file with the given
+name. The mode is set after the ownership, as chown clears the setuid
+and setgid bits.
+*/
+func (x *extractor) setAttributes(fileName string, hdr *cpio.Header) error {
+	if x.chown {
+		if err := os.Lchown(fileName, hdr.Uid, hdr.Guid); err != nil {
+			return err
+		}
+	}
+	if hdr.Mode&cpio.ModeType == cpio.TypeSymlink {
+		return nil
+	}
+	return unix.Chmod(fileName, permBits(hdr))
+}
+
+/*
+Writes a regular file to a temporary file and renames it to target,
+unless target already has the same content and attributes
+*/
+func (x *extractor) writeFile(target string, hdr *cpio.Header, r io.Reader) (changed bool, err error) {
+	tmp, err := os.CreateTemp(filepath.Dir(target), "."+filepath.Base(target)+".wwclient-")
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(tmp.Name())
+	written, err := io.Copy(tmp, r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return false, err
+	} else if written != hdr.Size {
+		return false, io.ErrUnexpectedEOF
+	}
+	if stat, err := os.Lstat(target); err == nil && stat.Mode().IsRegular() && x.sameAttributes(stat, hdr) {
+		if written, err := os.Open(tmp.Name()); err == nil {
+			same := sameContent(target, written)
+			written.Close()
+			if same {
+				return false, nil
+			}
+		}
+	}
+	if err := x.setAttributes(tmp.Name(), hdr); err != nil {
+		return false, err
+	}
+	return true, os.Rename(tmp.Name(), target)
+}
+
+/*
+Returns whether the file with the given name has the content read from r
+*/
+func sameContent(fileName string, r io.Reader) bool {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	buf1 := make([]byte, 32*1024)
+	buf2 := make([]byte, 32*1024)
+	for {
+		n1, err1 := io.ReadFull(file, buf1)
+		n2, err2 := io.ReadFull(r, buf2)
+		if n1 != n2 || !bytes.Equal(buf1[:n1], buf2[:n2]) {
+			return false
+		}
+		if err1 == io.EOF || err1 == io.ErrUnexpectedEOF {
+			return err2 == io.EOF || err2 == io.ErrUnexpectedEOF
+		}
+		if err1 != nil || err2 != nil {
+			return false
+		}
+	}
+}
+
+/*
+Creates a directory or updates the attributes of an existing one. A
+symbolic link to a directory, e.g. /bin on a merged /usr, is kept.
+*/
+func (x *extractor) writeDir(target string, hdr *cpio.Header) (changed bool, err error) {
+	stat, err := os.Lstat(target)
+	if errors.Is(err, os.ErrNotExist) {
+		if err := os.Mkdir(target, 0o700); err != nil {
+			return false, err
+		}
+		return true, x.setAttributes(target, hdr)
+	} else if err != nil {
+		return false, err
+	}
+	if stat.Mode()&os.ModeSymlink != 0 {
+		if stat, err := os.Stat(target); err == nil && stat.IsDir() {
+			return false, nil
+		}
+	}
+	if !stat.IsDir() {
+		return false, fmt.Errorf("not a directory")
+	}
+	if x.sameAttributes(stat, hdr) {
+		return false, nil
+	}
+	return true, x.setAttributes(target, hdr)
+}
+
+/*
+Replaces target with a symbolic link, unless it already links to the
+same target
+*/
+func (x *extractor) writeSymlink(target string, hdr *cpio.Header) (changed bool, err error) {
+	if stat, err := os.Lstat(target); err == nil && x.sameAttributes(stat, hdr) {
+		if linkname, err := os.Readlink(target); err == nil && linkname == hdr.Linkname {
+			return false, nil
+		}
+	}
+	tmpName := tempName(target)
+	if err := os.Symlink(hdr.Linkname, tmpName); err != nil {
+		return false, err
+	}
+	defer os.Remove(tmpName)
+	if err := x.setAttributes(tmpName, hdr); err != nil {
+		return false, err
+	}
+	return true, os.Rename(tmpName, target)
+}
+
+/*
+Replaces target with a named pipe, unless it already is one
+*/
+func (x *extractor) writeFifo(target string, hdr *cpio.Header) (changed bool, err error) {
+	if stat, err := os.Lstat(target); err == nil && x.sameAttributes(stat, hdr) {
+		return false, nil
+	}
+	tmpName := tempName(target)
+	if err := unix.Mkfifo(tmpName, 0o600); err != nil {
+		return false, err
+	}
+	defer os.Remove(tmpName)
+	if err := x.setAttributes(tmpName, hdr); err != nil {
+		return false, err
+	}
+	return true, os.Rename(tmpName, target)
+}
+
+/*
+Replaces the file with the given name with a hard link to the extracted
+file source, unless it already is one
+*/
+func (x *extractor) extractLink(name string, source string) (changed bool, err error) {
+	target, err := x.target(name)
+	if err != nil {
+		return false, err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return false, err
+	}
+	sourceStat, err := os.Lstat(source)
+	if err != nil {
+		return false, err
+	}
+	if stat, err := os.Lstat(target); err == nil && os.SameFile(stat, sourceStat) {
+		return false, nil
+	}
+	tmpName := tempName(target)
+	if err := os.Link(source, tmpName); err != nil {
+		return false, err
+	}
+	defer os.Remove(tmpName)
+	return true, os.Rename(tmpName, target)
+}
+
+// differences between a runtime overlay and the files it would be
+// extracted over
+type overlayDiff struct {
+	// paths of the archive relative to the extraction directory
+	paths   []string
+	added   []string
+	changed []string
+}
+
+/*
+Compares the newc archive read from r with the files below root, without
+changing anything. Entries which would be refused are logged.
+*/
+func diffArchive(root string, r io.Reader) (*overlayDiff, error) {
+	ret := &overlayDiff{}
+	x := &extractor{root: root, chown: os.Geteuid() == 0}
+	input := &eofReader{r: r}
+	reader := cpio.NewReader(input)
+	for {
+		hdr, err := reader.Next()
+		if err == io.EOF && input.eof {
+			err = io.ErrUnexpectedEOF
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return ret, fmt.Errorf("could not read runtime overlay: %w", err)
+		}
+		name, err := entryPath(hdr.Name)
+		if err != nil {
+			wwlog.Warn("Would not extract %s", &entryError{strings.TrimLeft(hdr.Name, "/"), err})
+			continue
+		}
+		if name == "" {
+			continue
+		}
+		ret.paths = append(ret.paths, name)
+		target, err := x.target(name)
+		if err != nil {
+			ret.changed = append(ret.changed, name)
+			continue
+		}
+		stat, err := os.Lstat(target)
+		if errors.Is(err, os.ErrNotExist) {
+			ret.added = append(ret.added, name)
+		} else if err != nil || x.differs(target, stat, hdr, reader) {
+			ret.changed = append(ret.changed, name)
+		}
+	}
+	return ret, nil
+}
+
+/*
+Returns whether the existing file target differs from the archive entry
+with the header hdr and the content read from r
+*/
+func (x *extractor) differs(target string, stat os.FileInfo, hdr *cpio.Header, r io.Reader) bool {
+	if hdr.Mode&cpio.ModeType == cpio.TypeDir && stat.Mode()&os.ModeSymlink != 0 {
+		// symbolic links to directories are kept
+		stat, err := os.Stat(target)
+		return err != nil || !stat.IsDir()
+	}
+	if !x.sameAttributes(stat, hdr) {
+		return true
+	}
+	switch hdr.Mode & cpio.ModeType {
+	case cpio.TypeReg:
+		if hdr.Links > 1 && hdr.Size == 0 {
+			// the content is stored with another link
+			return false
+		}
+		return !sameContent(target, r)
+	case cpio.TypeSymlink:
+		linkname, err := os.Readlink(target)
+		return err != nil || linkname != hdr.Linkname
+	}
+	return false
+}
@@ -0,0 +1,322 @@
+package wwclient
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/cavaliergopher/cpio"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/warewulf/warewulf/internal/pkg/util"
+)
+
+type testEntry struct {
+	name  string
+	mode  cpio.FileMode
+	body  string
+	links int
+	inode int64
+}
+
+/*
+Returns a newc archive of the entries, owned by the current user
+*/
+func testArchive(t *testing.T, entries ...testEntry) []byte {
+	var buf bytes.Buffer
+	writer := cpio.NewWriter(&buf)
+	for i, entry := range entries {
+		hdr := &cpio.Header{
+			Name:  entry.name,
+			Mode:  entry.mode,
+			Uid:   os.Getuid(),
+			Guid:  os.Getgid(),
+			Links: 1,
+			Inode: int64(i + 1),
+		}
+		if entry.links > 0 {
+			hdr.Links = entry.links
+			hdr.Inode = entry.inode
+		}
+		// the target of a symbolic link is its content
+		hdr.Size = int64(len(entry.body))
+		require.NoError(t, writer.WriteHeader(hdr))
+		if hdr.Size > 0 {
+			_, err := writer.Write([]byte(entry.body))
+			require.NoError(t, err)
+		}
+	}
+	require.NoError(t, writer.Close())
+	return buf.Bytes()
+}
+
+func readFile(t *testing.T, name string) string {
+	data, err := os.ReadFile(name)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func fileMode(t *testing.T, name string) uint32 {
+	stat, err := os.Lstat(name)
+	require.NoError(t, err)
+	return stat.Sys().(*syscall.Stat_t).Mode & 0o7777
+}
+
+func Test_entryPath(t *testing.T) {
+	for name, expected := range map[string]string{
+		"etc/hosts":         "etc/hosts",
+		"./etc/hosts":       "etc/hosts",
+		"/etc/hosts":        "etc/hosts",
+		"etc/../etc//hosts": "etc/hosts",
+		".":                 "",
+		"/":                 "",
+	} {
+		cleaned, err := entryPath(name)
+		assert.NoError(t, err, name)
+		assert.Equal(t, expected, cleaned, name)
+	}
+	for _, name := range []string{"..", "../etc/hosts", "etc/../../hosts", "/../etc/hosts"} {
+		_, err := entryPath(name)
+		assert.ErrorIs(t, err, errEscape, name)
+	}
+}
+
+func Test_extractArchive(t *testing.T) {
+	root := t.TempDir()
+	entries := []testEntry{
+		{name: ".", mode: cpio.TypeDir | 0o755},
+		{name: "etc", mode: cpio.TypeDir | 0o750},
+		{name: "etc/hosts", mode: cpio.TypeReg | 0o644, body: "127.0.0.1 localhost\n"},
+		{name: "etc/secret", mode: cpio.TypeReg | 0o600, body: "secret\n"},
+		{name: "usr/bin/tool", mode: cpio.TypeReg | cpio.ModeSetuid | 0o755, body: "#!/bin/sh\n"},
+		{name: "etc/localtime", mode: cpio.TypeSymlink | 0o777, body: "/usr/share/zoneinfo/UTC"},
+		{name: "run/pipe", mode: cpio.TypeFifo | 0o640},
+	}
+
+	result, err := extractArchive(root, bytes.NewReader(testArchive(t, entries...)))
+	require.NoError(t, err)
+	assert.Empty(t, result.errs)
+	expected := []string{"etc", "etc/hosts", "etc/secret", "usr/bin/tool", "etc/localtime", "run/pipe"}
+	assert.Equal(t, expected, result.paths)
+	assert.Equal(t, expected, result.changed)
+
+	assert.Equal(t, "127.0.0.1 localhost\n", readFile(t, path.Join(root, "etc/hosts")))
+	assert.Equal(t, uint32(0o750), fileMode(t, path.Join(root, "etc")))
+	assert.Equal(t, uint32(0o600), fileMode(t, path.Join(root, "etc/secret")))
+	assert.Equal(t, uint32(0o4755), fileMode(t, path.Join(root, "usr/bin/tool")))
+	assert.Equal(t, uint32(0o640), fileMode(t, path.Join(root, "run/pipe")))
+	linkname, err := os.Readlink(path.Join(root, "etc/localtime"))
+	require.NoError(t, err)
+	assert.Equal(t, "/usr/share/zoneinfo/UTC", linkname)
+
+	t.Run("unchanged", func(t *testing.T) {
+		result, err := extractArchive(root, bytes.NewReader(testArchive(t, entries...)))
+		require.NoError(t, err)
+		assert.Empty(t, result.errs)
+		assert.Equal(t, expected, result.paths)
+		assert.Empty(t, result.changed)
+	})
+
+	t.Run("changed", func(t *testing.T) {
+		stat, err := os.Stat(path.Join(root, "etc/hosts"))
+		require.NoError(t, err)
+		changed := append([]testEntry{}, entries...)
+		changed[2].body = "10.0.0.1 master\n"
+		changed[3].mode = cpio.TypeReg | 0o640
+		changed[5].body = "/usr/share/zoneinfo/CET"
+		result, err := extractArchive(root, bytes.NewReader(testArchive(t, changed...)))
+		require.NoError(t, err)
+		assert.Empty(t, result.errs)
+		assert.Equal(t, []string{"etc/hosts", "etc/secret", "etc/localtime"}, result.changed)
+		assert.Equal(t, "10.0.0.1 master\n", readFile(t, path.Join(root, "etc/hosts")))
+		assert.Equal(t, uint32(0o640), fileMode(t, path.Join(root, "etc/secret")))
+		// files are replaced, not rewritten in place
+		newStat, err := os.Stat(path.Join(root, "etc/hosts"))
+		require.NoError(t, err)
+		assert.False(t, os.SameFile(stat, newStat))
+	})
+
+	t.Run("no temporary files", func(t *testing.T) {
+		matches, err := filepath.Glob(path.Join(root, "*/.*.wwclient-*"))
+		require.NoError(t, err)
+		assert.Empty(t, matches)
+	})
+}
+
+func Test_extractArchive_ownership(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("restoring ownership requires root")
+	}
+	root := t.TempDir()
+	var buf bytes.Buffer
+	writer := cpio.NewWriter(&buf)
+	require.NoError(t, writer.WriteHeader(&cpio.Header{Name: "etc/munge.key", Mode: cpio.TypeReg | 0o400, Uid: 1234, Guid: 5678, Size: 3}))
+	_, err := writer.Write([]byte("key"))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	result, err := extractArchive(root, &buf)
+	require.NoError(t, err)
+	assert.Empty(t, result.errs)
+	stat, err := os.Stat(path.Join(root, "etc/munge.key"))
+	require.NoError(t, err)
+	assert.Equal(t, uint32(1234), stat.Sys().(*syscall.Stat_t).Uid)
+	assert.Equal(t, uint32(5678), stat.Sys().(*syscall.Stat_t).Gid)
+}
+
+func Test_extractArchive_escape(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	archive := testArchive(t,
+		testEntry{name: "../escaped", mode: cpio.TypeReg | 0o644, body: "escaped\n"},
+		testEntry{name: "etc/../../escaped", mode: cpio.TypeReg | 0o644, body: "escaped\n"},
+		testEntry{name: "link", mode: cpio.TypeSymlink | 0o777, body: outside},
+		testEntry{name: "link/escaped", mode: cpio.TypeReg | 0o644, body: "escaped\n"},
+		testEntry{name: "up", mode: cpio.TypeSymlink | 0o777, body: "../.."},
+		testEntry{name: "up/escaped", mode: cpio.TypeReg | 0o644, body: "escaped\n"},
+	)
+	result, err := extractArchive(root, bytes.NewReader(archive))
+	require.NoError(t, err)
+	require.Len(t, result.errs, 2)
+	for _, entryErr := range result.errs {
+		assert.ErrorIs(t, entryErr, errEscape)
+	}
+	assert.NoFileExists(t, path.Join(outside, "escaped"))
+	assert.NoFileExists(t, path.Join(path.Dir(root), "escaped"))
+	// symbolic links are resolved within the extraction directory
+	assert.FileExists(t, path.Join(root, outside, "escaped"))
+	assert.FileExists(t, path.Join(root, "escaped"))
+}
+
+func Test_extractArchive_errors(t *testing.T) {
+	root := t.TempDir()
+	archive := testArchive(t,
+		testEntry{name: "etc", mode: cpio.TypeReg | 0o644, body: "not a directory\n"},
+		testEntry{name: "etc/hosts", mode: cpio.TypeReg | 0o644, body: "127.0.0.1 localhost\n"},
+		testEntry{name: "dev/null", mode: cpio.TypeChar | 0o666},
+		testEntry{name: "motd", mode: cpio.TypeReg | 0o644, body: "welcome\n"},
+	)
+	result, err := extractArchive(root, bytes.NewReader(archive))
+	require.NoError(t, err)
+	require.Len(t, result.errs, 2)
+	assert.Contains(t, result.errs[0].Error(), "/etc/hosts")
+	assert.Contains(t, result.errs[1].Error(), "/dev/null")
+	// the extraction continues after errors of single entries
+	assert.Equal(t, "welcome\n", readFile(t, path.Join(root, "motd")))
+	assert.Equal(t, []string{"etc", "motd"}, result.changed)
+
+	t.Run("truncated", func(t *testing.T) {
+		archive := testArchive(t, testEntry{name: "motd", mode: cpio.TypeReg | 0o644, body: "welcome\n"})
+		_, err := extractArchive(t.TempDir(), bytes.NewReader(archive[:len(archive)/2]))
+		assert.Error(t, err)
+	})
+}
+
+func Test_extractArchive_hardlinks(t *testing.T) {
+	root := t.TempDir()
+	archive := testArchive(t,
+		testEntry{name: "bin/a", mode: cpio.TypeReg | 0o755, links: 3, inode: 42},
+		testEntry{name: "bin/b", mode: cpio.TypeReg | 0o755, links: 3, inode: 42},
+		testEntry{name: "bin/c", mode: cpio.TypeReg | 0o755, body: "binary", links: 3, inode: 42},
+		testEntry{name: "bin/empty1", mode: cpio.TypeReg | 0o644, links: 2, inode: 43},
+		testEntry{name: "bin/empty2", mode: cpio.TypeReg | 0o644, links: 2, inode: 43},
+	)
+	result, err := extractArchive(root, bytes.NewReader(archive))
+	require.NoError(t, err)
+	assert.Empty(t, result.errs)
+	assert.ElementsMatch(t, []string{"bin/a", "bin/b", "bin/c", "bin/empty1", "bin/empty2"}, result.changed)
+	statC, err := os.Stat(path.Join(root, "bin/c"))
+	require.NoError(t, err)
+	for _, name := range []string{"bin/a", "bin/b"} {
+		assert.Equal(t, "binary", readFile(t, path.Join(root, name)))
+		stat, err := os.Stat(path.Join(root, name))
+		require.NoError(t, err)
+		assert.True(t, os.SameFile(statC, stat), name)
+	}
+	assert.Equal(t, "", readFile(t, path.Join(root, "bin/empty2")))
+
+	result, err = extractArchive(root, bytes.NewReader(archive))
+	require.NoError(t, err)
+	assert.Empty(t, result.errs)
+	assert.Empty(t, result.changed)
+}
+
+func Test_extractOverlay(t *testing.T) {
+	archive := testArchive(t, testEntry{name: "etc/motd", mode: cpio.TypeReg | 0o644, body: "welcome\n"})
+	var gzipped bytes.Buffer
+	gzipWriter := gzip.NewWriter(&gzipped)
+	_, err := gzipWriter.Write(archive)
+	require.NoError(t, err)
+	require.NoError(t, gzipWriter.Close())
+	zstdWriter, err := zstd.NewWriter(nil)
+	require.NoError(t, err)
+	zstded := zstdWriter.EncodeAll(archive, nil)
+
+	for format, data := range map[string][]byte{
+		util.CompressNone: archive,
+		util.CompressGzip: gzipped.Bytes(),
+		util.CompressZstd: zstded,
+	} {
+		t.Run(format, func(t *testing.T) {
+			root := t.TempDir()
+			result, err := extractOverlay(root, bytes.NewReader(data), format)
+			require.NoError(t, err)
+			assert.Equal(t, []string{"etc/motd"}, result.paths)
+			assert.Equal(t, "welcome\n", readFile(t, path.Join(root, "etc/motd")))
+		})
+	}
+
+	t.Run("corrupted", func(t *testing.T) {
+		corrupted := bytes.Clone(gzipped.Bytes())
+		corrupted[len(corrupted)-5] ^= 0xff
+		_, err := extractOverlay(t.TempDir(), bytes.NewReader(corrupted), util.CompressGzip)
+		assert.Error(t, err)
+	})
+
+	t.Run("wrong format", func(t *testing.T) {
+		_, err := extractOverlay(t.TempDir(), bytes.NewReader(archive), util.CompressGzip)
+		assert.Error(t, err)
+	})
+}
+
+func Test_diffArchive(t *testing.T) {
+	root := t.TempDir()
+	entries := []testEntry{
+		{name: "etc", mode: cpio.TypeDir | 0o755},
+		{name: "etc/hosts", mode: cpio.TypeReg | 0o644, body: "127.0.0.1 localhost\n"},
+		{name: "etc/secret", mode: cpio.TypeReg | 0o600, body: "secret\n"},
+		{name: "etc/localtime", mode: cpio.TypeSymlink | 0o777, body: "/usr/share/zoneinfo/UTC"},
+	}
+	_, err := extractArchive(root, bytes.NewReader(testArchive(t, entries...)))
+	require.NoError(t, err)
+
+	diff, err := diffArchive(root, bytes.NewReader(testArchive(t, entries...)))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"etc", "etc/hosts", "etc/secret", "etc/localtime"}, diff.paths)
+	assert.Empty(t, diff.added)
+	assert.Empty(t, diff.changed)
+
+	changed := append([]testEntry{}, entries...)
+	changed[1].body = "10.0.0.1 master\n"
+	changed[2].mode = cpio.TypeReg | 0o640
+	changed[3].body = "/usr/share/zoneinfo/CET"
+	changed = append(changed,
+		testEntry{name: "etc/motd", mode: cpio.TypeReg | 0o644, body: "welcome\n"},
+		testEntry{name: "../escaped", mode: cpio.TypeReg | 0o644, body: "escaped\n"})
+	diff, err = diffArchive(root, bytes.NewReader(testArchive(t, changed...)))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"etc/motd"}, diff.added)
+	assert.Equal(t, []string{"etc/hosts", "etc/secret", "etc/localtime"}, diff.changed)
+
+	// nothing is changed
+	assert.Equal(t, "127.0.0.1 localhost\n", readFile(t, path.Join(root, "etc/hosts")))
+	assert.Equal(t, uint32(0o600), fileMode(t, path.Join(root, "etc/secret")))
+	assert.NoFileExists(t, path.Join(root, "etc/motd"))
+	assert.NoFileExists(t, path.Join(path.Dir(root), "escaped"))
+}
@@ -0,0 +1,160 @@
+package wwclient
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"golang.org/x/sys/unix"
+
+	warewulfconf "github.com/warewulf/warewulf/internal/pkg/config"
+	"github.com/warewulf/warewulf/internal/pkg/nodehealth"
+	"github.com/warewulf/warewulf/internal/pkg/wwlog"
+)
+
+// files the health report is read from, which can be replaced in tests
+var (
+	procUptime  = "/proc/uptime"
+	procLoadavg = "/proc/loadavg"
+	procMeminfo = "/proc/meminfo"
+)
+
+/*
+Collects the health report of this node. Values which can't be read are
+left empty.
+*/
+func collectHealth() nodehealth.Health {
+	conf := warewulfconf.Get()
+	health := nodehealth.Health{
+		Version: fmt.Sprintf("%s-%s", warewulfconf.Version, warewulfconf.Release),
+	}
+	if data, err := os.ReadFile(procUptime); err == nil {
+		if fields := strings.Fields(string(data)); len(fields) > 0 {
+			uptime, _ := strconv.ParseFloat(fields[0], 64)
+			health.Uptime = int64(uptime)
+		}
+	}
+	if data, err := os.ReadFile(procLoadavg); err == nil {
+		fields := strings.Fields(string(data))
+		for i := 0; i < len(health.Load) && i < len(fields); i++ {
+			health.Load[i], _ = strconv.ParseFloat(fields[i], 64)
+		}
+	}
+	var uname unix.Utsname
+	if err := unix.Uname(&uname); err == nil {
+		health.Kernel = unix.ByteSliceToString(uname.Release[:])
+	}
+	health.MemoryTotal, health.MemoryAvailable = readMeminfo(procMeminfo)
+	health.Image, health.ImageDigest = readImage(path.Join(conf.Paths.WWClientdir, "config"))
+	health.FailedUnits = failedUnits()
+	health.Hooks = hookResults
+	health.UpdateError = updateError
+	return health
+}
+
+/*
+Returns the total and available memory in bytes from /proc/meminfo
+*/
+func readMeminfo(fileName string) (total uint64, available uint64) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		value, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch fields[0] {
+		case "MemTotal:":
+			total = value * 1024
+		case "MemAvailable:":
+			available = value * 1024
+		}
+	}
+	return
+}
+
+/*
+Returns the name and digest of the booted image from the node
+configuration in the system overlay
+*/
+func readImage(fileName string) (name string, digest string) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "WWIMAGE":
+			name = strings.Trim(value, "\"")
+		case "WWIMAGE_DIGEST":
+			digest = strings.Trim(value, "\"")
+		}
+	}
+	return
+}
+
+/*
+Returns the failed systemd units, or nil if systemd isn't available
+*/
+func failedUnits() (units []string) {
+	out, err := exec.Command("systemctl", "list-units", "--state=failed", "--plain", "--no-legend", "--no-pager").Output()
+	if err != nil {
+		return nil
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if fields := strings.Fields(line); len(fields) > 0 {
+			units = append(units, fields[0])
+		}
+	}
+	return units
+}
+
+/*
+Posts the health report of this node to warewulfd
+*/
+func sendHealth(scheme string, ipaddr string, port int, wwid string, tag string, localUUID uuid.UUID) {
+	data, err := json.Marshal(collectHealth())
+	if err != nil {
+		wwlog.Warn("Could not encode health report: %s", err)
+		return
+	}
+	postURL := &url.URL{
+		Scheme:   scheme,
+		Host:     fmt.Sprintf("%s:%d", ipaddr, port),
+		Path:     fmt.Sprintf("health/%s", wwid),
+		RawQuery: requestValues(wwid, tag, localUUID).Encode(),
+	}
+	wwlog.Debug("Sending health report: %s", postURL)
+	resp, err := Webclient.Post(postURL.String(), "application/json", bytes.NewReader(data))
+	if err != nil {
+		wwlog.Verbose("Could not send health report: %s", err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		wwlog.Verbose("Health report not accepted, got status code: %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,55 @@
+package wwclient
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_readMeminfo(t *testing.T) {
+	fileName := path.Join(t.TempDir(), "meminfo")
+	require.NoError(t, os.WriteFile(fileName, []byte(`MemTotal:       16315508 kB
+MemFree:         1206620 kB
+MemAvailable:    9123456 kB
+`), 0o644))
+	total, available := readMeminfo(fileName)
+	assert.Equal(t, uint64(16315508*1024), total)
+	assert.Equal(t, uint64(9123456*1024), available)
+
+	total, available = readMeminfo(path.Join(t.TempDir(), "missing"))
+	assert.Zero(t, total)
+	assert.Zero(t, available)
+}
+
+func Test_readImage(t *testing.T) {
+	fileName := path.Join(t.TempDir(), "config")
+	require.NoError(t, os.WriteFile(fileName, []byte(`WWIMAGE=rockylinux-9
+WWIMAGE_DIGEST=0123abcd
+WWHOSTNAME=n1
+WWIPMI_IPADDR="192.168.4.21"
+`), 0o644))
+	name, digest := readImage(fileName)
+	assert.Equal(t, "rockylinux-9", name)
+	assert.Equal(t, "0123abcd", digest)
+}
+
+func Test_collectHealth(t *testing.T) {
+	dir := t.TempDir()
+	procUptime = path.Join(dir, "uptime")
+	procLoadavg = path.Join(dir, "loadavg")
+	defer func() {
+		procUptime = "/proc/uptime"
+		procLoadavg = "/proc/loadavg"
+	}()
+	require.NoError(t, os.WriteFile(procUptime, []byte("3600.57 7000.12\n"), 0o644))
+	require.NoError(t, os.WriteFile(procLoadavg, []byte("0.50 0.25 0.10 1/123 4567\n"), 0o644))
+
+	health := collectHealth()
+	assert.Equal(t, int64(3600), health.Uptime)
+	assert.Equal(t, [3]float64{0.5, 0.25, 0.1}, health.Load)
+	assert.NotEmpty(t, health.Kernel)
+	assert.NotEmpty(t, health.Version)
+}
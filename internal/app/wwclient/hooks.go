@@ -0,0 +1,198 @@
+package wwclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	warewulfconf "github.com/warewulf/warewulf/internal/pkg/config"
+	"github.com/warewulf/warewulf/internal/pkg/nodehealth"
+	"github.com/warewulf/warewulf/internal/pkg/wwlog"
+)
+
+/*
+Post-update hooks, which run a command when an update of the runtime
+overlay changed matching paths. Hooks are declared by YAML files in the
+hooks.d directory of the wwclient directory, so that overlays can ship
+them along with the files they watch, e.g.
+
+	paths:
+	  - /etc/slurm/*
+	run: systemctl reload slurmd
+*/
+
+// name of the hooks directory in the wwclient directory
+const hooksDirName = "hooks.d"
+
+// time in seconds after which a hook is killed, unless set by the hook
+const defaultHookTimeout = 60
+
+// maximum length of the output kept of a hook
+const maxHookOutput = 4096
+
+// outcomes of the hooks which ran last, which are sent with the health
+// report
+var hookResults []nodehealth.HookResult
+
+type hook struct {
+	name string
+	// absolute shell patterns of the paths which trigger the hook
+	Paths []string `yaml:"paths"`
+	// command run with /bin/sh
+	Run string `yaml:"run"`
+	// seconds after which the command is killed
+	Timeout int `yaml:"timeout,omitempty"`
+}
+
+/*
+Returns the path of the hooks directory relative to the directory the
+runtime overlay is extracted to
+*/
+func hooksDir() string {
+	return path.Join(".", warewulfconf.Get().Paths.WWClientdir, hooksDirName)
+}
+
+/*
+Reads the hooks from the *.yaml files in dir, sorted by file name. Files
+which can't be read are logged and skipped.
+*/
+func readHooks(dir string) (hooks []hook) {
+	files, err := filepath.Glob(path.Join(dir, "*.yaml"))
+	if err != nil {
+		wwlog.Warn("Could not list hooks: %s", err)
+		return nil
+	}
+	for _, fileName := range files {
+		data, err := os.ReadFile(fileName)
+		if err != nil {
+			wwlog.Warn("Could not read hook: %s", err)
+			continue
+		}
+		h := hook{name: strings.TrimSuffix(path.Base(fileName), ".yaml")}
+		if err := yaml.Unmarshal(data, &h); err != nil {
+			wwlog.Warn("Could not parse hook %s: %s", fileName, err)
+			continue
+		}
+		if len(h.Paths) == 0 || h.Run == "" {
+			wwlog.Warn("Hook %s needs paths and a command to run", fileName)
+			continue
+		}
+		hooks = append(hooks, h)
+	}
+	return hooks
+}
+
+/*
+Returns the changed paths which match the patterns of the hook
+*/
+func (h hook) matches(changed []string) (matched []string) {
+	for _, name := range changed {
+		if matchPath(h.Paths, name) {
+			matched = append(matched, "/"+name)
+		}
+	}
+	return matched
+}
+
+/*
+Runs the command of the hook. The changed paths which triggered the hook
+are passed in WWCLIENT_CHANGED_PATHS, separated by spaces.
+*/
+func (h hook) run(matched []string) nodehealth.HookResult {
+	timeout := defaultHookTimeout
+	if h.Timeout > 0 {
+		timeout = h.Timeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", h.Run)
+	cmd.Env = append(os.Environ(), "WWCLIENT_CHANGED_PATHS="+strings.Join(matched, " "))
+	// kill the whole process group, so that children don't keep the output
+	// open after a timeout
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = time.Second
+
+	result := nodehealth.HookResult{
+		Name:  h.name,
+		Time:  time.Now().Unix(),
+		Paths: matched,
+	}
+	out, err := cmd.CombinedOutput()
+	if len(out) > maxHookOutput {
+		out = out[len(out)-maxHookOutput:]
+	}
+	result.Output = string(out)
+	var exitErr *exec.ExitError
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		result.ExitCode = -1
+		result.Error = fmt.Sprintf("timed out after %ds", timeout)
+	} else if errors.As(err, &exitErr) {
+		result.ExitCode = exitErr.ExitCode()
+	} else if err != nil {
+		result.ExitCode = -1
+		result.Error = err.Error()
+	}
+	return result
+}
+
+/*
+Runs the hooks matching the changed paths, each at most once, and returns
+their outcomes
+*/
+func runHooks(hooks []hook, changed []string) (results []nodehealth.HookResult) {
+	for _, h := range hooks {
+		matched := h.matches(changed)
+		if len(matched) == 0 {
+			continue
+		}
+		wwlog.Verbose("Running hook %s for %s", h.name, strings.Join(matched, " "))
+		result := h.run(matched)
+		if result.Failed() {
+			detail := result.Error
+			if detail == "" {
+				detail = strings.TrimSpace(result.Output)
+			}
+			wwlog.Warn("Hook %s failed with exit code %d: %s", h.name, result.ExitCode, detail)
+		} else {
+			wwlog.Info("Hook %s succeeded", h.name)
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+/*
+Runs the hooks of the runtime overlay extracted to root for the changed
+paths and returns their outcomes. Hooks only run on the live file system,
+as their commands act on the running node.
+*/
+func updateHooks(root string, changed []string) (results []nodehealth.HookResult) {
+	if len(changed) == 0 {
+		return nil
+	}
+	hooks := readHooks(hooksDir())
+	if root != "/" {
+		for _, h := range hooks {
+			if matched := h.matches(changed); len(matched) > 0 {
+				wwlog.Info("Not running hook %s outside of the live file system", h.name)
+			}
+		}
+		return nil
+	}
+	if results = runHooks(hooks, changed); len(results) > 0 {
+		hookResults = results
+	}
+	return results
+}
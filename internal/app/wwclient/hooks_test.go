@@ -0,0 +1,57 @@
+package wwclient
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_readHooks(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"20-slurm.yaml": "paths:\n  - /etc/slurm/*\nrun: systemctl reload slurmd\n",
+		"10-sshd.yaml":  "paths: [/etc/ssh/sshd_config.d]\nrun: systemctl reload sshd\ntimeout: 10\n",
+		"30-bad.yaml":   "paths: /etc/passwd\n",
+		"40-norun.yaml": "paths:\n  - /etc/passwd\n",
+		"README":        "not a hook",
+	} {
+		require.NoError(t, os.WriteFile(path.Join(dir, name), []byte(content), 0o644))
+	}
+	hooks := readHooks(dir)
+	assert.Equal(t, []hook{
+		{name: "10-sshd", Paths: []string{"/etc/ssh/sshd_config.d"}, Run: "systemctl reload sshd", Timeout: 10},
+		{name: "20-slurm", Paths: []string{"/etc/slurm/*"}, Run: "systemctl reload slurmd"},
+	}, hooks)
+	assert.Empty(t, readHooks(path.Join(dir, "missing")))
+}
+
+func Test_runHooks(t *testing.T) {
+	out := path.Join(t.TempDir(), "out")
+	hooks := []hook{
+		{name: "slurm", Paths: []string{"/etc/slurm/*"}, Run: "echo \"$WWCLIENT_CHANGED_PATHS\" > " + out},
+		{name: "sshd", Paths: []string{"/etc/ssh"}, Run: "echo reloading; exit 3"},
+		{name: "passwd", Paths: []string{"/etc/passwd"}, Run: "false"},
+		{name: "slow", Paths: []string{"/etc/slurm"}, Run: "sleep 10", Timeout: 1},
+	}
+	results := runHooks(hooks, []string{"etc/slurm/slurm.conf", "etc/slurm/gres.conf", "etc/ssh/sshd_config.d/50-warewulf.conf"})
+	require.Len(t, results, 3)
+
+	assert.Equal(t, "slurm", results[0].Name)
+	assert.False(t, results[0].Failed())
+	assert.Equal(t, []string{"/etc/slurm/slurm.conf", "/etc/slurm/gres.conf"}, results[0].Paths)
+	assert.Equal(t, "/etc/slurm/slurm.conf /etc/slurm/gres.conf\n", readFile(t, out))
+
+	assert.Equal(t, "sshd", results[1].Name)
+	assert.True(t, results[1].Failed())
+	assert.Equal(t, 3, results[1].ExitCode)
+	assert.Equal(t, "reloading\n", results[1].Output)
+
+	assert.Equal(t, "slow", results[2].Name)
+	assert.True(t, results[2].Failed())
+	assert.Equal(t, "timed out after 1s", results[2].Error)
+
+	assert.Empty(t, runHooks(hooks, []string{"etc/hosts"}))
+}
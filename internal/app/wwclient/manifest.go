@@ -0,0 +1,148 @@
+package wwclient
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	warewulfconf "github.com/warewulf/warewulf/internal/pkg/config"
+	"github.com/warewulf/warewulf/internal/pkg/wwlog"
+)
+
+/*
+Removal of files which were dropped from the runtime overlay. The paths
+of each extracted runtime overlay are kept in a manifest, and paths which
+are missing from the next runtime overlay are removed.
+*/
+
+// name of the manifest in the wwclient directory
+const manifestName = "runtime-overlay.manifest"
+
+/*
+Returns the path of the manifest relative to the directory the runtime
+overlay is extracted to
+*/
+func manifestFile() string {
+	return path.Join(".", warewulfconf.Get().Paths.WWClientdir, manifestName)
+}
+
+/*
+Returns the path of a manifest entry relative to the extraction
+directory. Entries outside of it are rejected.
+*/
+func cleanOverlayPath(name string) (string, bool) {
+	name = path.Clean("/" + name)
+	if name == "/" {
+		return "", false
+	}
+	return strings.TrimPrefix(name, "/"), true
+}
+
+func readManifest(fileName string) (paths []string, err error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if name, ok := cleanOverlayPath(scanner.Text()); ok {
+			paths = append(paths, name)
+		}
+	}
+	return paths, scanner.Err()
+}
+
+/*
+Replaces the manifest atomically, so that an interrupted write leaves the
+previous manifest in place
+*/
+func writeManifest(fileName string, paths []string) error {
+	if err := os.MkdirAll(path.Dir(fileName), 0o755); err != nil {
+		return err
+	}
+	tmpName := fileName + ".tmp"
+	if err := os.WriteFile(tmpName, []byte(strings.Join(paths, "\n")+"\n"), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmpName, fileName)
+}
+
+/*
+Returns true if the path, given relative to the extraction directory,
+matches one of the patterns. Patterns are absolute shell patterns, and a
+pattern matching a directory matches everything below it.
+*/
+func matchPath(patterns []string, name string) bool {
+	name = "/" + name
+	for _, pattern := range patterns {
+		for p := name; p != "/"; p = path.Dir(p) {
+			if ok, _ := filepath.Match(pattern, p); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+/*
+Returns the paths of the previous runtime overlay which are missing from
+the current one and are to be removed. Only existing paths matching
+conf.CleanupPaths, if set, and not matching conf.CleanupProtect are
+returned, the contents of directories before the directories.
+*/
+func droppedPaths(previous []string, current []string, conf warewulfconf.WWClientConf) (dropped []string) {
+	keep := make(map[string]bool, len(current))
+	for _, name := range current {
+		keep[name] = true
+	}
+	for _, name := range previous {
+		if keep[name] {
+			continue
+		}
+		if len(conf.CleanupPaths) > 0 && !matchPath(conf.CleanupPaths, name) {
+			continue
+		}
+		if matchPath(conf.CleanupProtect, name) {
+			wwlog.Verbose("Not removing protected path: /%s", name)
+			continue
+		}
+		if _, err := os.Lstat(name); errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		dropped = append(dropped, name)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(dropped)))
+	return dropped
+}
+
+/*
+Removes the paths of the previous runtime overlay which are missing from
+the current one, as returned by droppedPaths. Directories are only
+removed if they are empty. In a dry run the removals are only logged.
+
+Returns the removed paths, and the dropped paths which were not removed,
+because of a dry run or an error, so that they are kept in the manifest
+and tried again.
+*/
+func removeDropped(previous []string, current []string, conf warewulfconf.WWClientConf) (removed []string, remaining []string) {
+	for _, name := range droppedPaths(previous, current, conf) {
+		if conf.CleanupDryRun() {
+			wwlog.Info("Would remove path dropped from runtime overlay (dry run): /%s", name)
+			remaining = append(remaining, name)
+			continue
+		}
+		if err := os.Remove(name); err != nil {
+			wwlog.Verbose("Could not remove /%s: %s", name, err)
+			remaining = append(remaining, name)
+			continue
+		}
+		wwlog.Info("Removed path dropped from runtime overlay: /%s", name)
+		removed = append(removed, name)
+	}
+	return removed, remaining
+}
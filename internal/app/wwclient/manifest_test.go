@@ -0,0 +1,107 @@
+package wwclient
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	warewulfconf "github.com/warewulf/warewulf/internal/pkg/config"
+)
+
+func chdir(t *testing.T, dir string) {
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(dir))
+	t.Cleanup(func() {
+		_ = os.Chdir(wd)
+	})
+}
+
+func Test_cleanOverlayPath(t *testing.T) {
+	for name, expected := range map[string]string{
+		"etc/hosts":         "etc/hosts",
+		"./etc/hosts":       "etc/hosts",
+		"/etc/hosts":        "etc/hosts",
+		"../../etc/hosts":   "etc/hosts",
+		"etc/../etc//hosts": "etc/hosts",
+	} {
+		cleaned, ok := cleanOverlayPath(name)
+		assert.True(t, ok, name)
+		assert.Equal(t, expected, cleaned, name)
+	}
+	for _, name := range []string{".", "/", "..", ""} {
+		_, ok := cleanOverlayPath(name)
+		assert.False(t, ok, name)
+	}
+}
+
+func Test_matchPath(t *testing.T) {
+	patterns := []string{"/etc/sudoers.d", "/etc/cron.d/*.conf"}
+	assert.True(t, matchPath(patterns, "etc/sudoers.d"))
+	assert.True(t, matchPath(patterns, "etc/sudoers.d/old"))
+	assert.True(t, matchPath(patterns, "etc/cron.d/job.conf"))
+	assert.False(t, matchPath(patterns, "etc/cron.d/job"))
+	assert.False(t, matchPath(patterns, "etc/hosts"))
+	assert.False(t, matchPath(nil, "etc/hosts"))
+}
+
+func Test_manifest(t *testing.T) {
+	fileName := path.Join(t.TempDir(), "warewulf", manifestName)
+	_, err := readManifest(fileName)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	require.NoError(t, writeManifest(fileName, []string{"etc", "etc/hosts"}))
+	paths, err := readManifest(fileName)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"etc", "etc/hosts"}, paths)
+}
+
+func Test_removeDropped(t *testing.T) {
+	setup := func(t *testing.T) {
+		chdir(t, t.TempDir())
+		for _, dir := range []string{"etc/sudoers.d", "etc/cron.d", "etc/keep.d"} {
+			require.NoError(t, os.MkdirAll(dir, 0o755))
+		}
+		for _, file := range []string{"etc/hosts", "etc/sudoers.d/old", "etc/cron.d/job", "etc/keep.d/local"} {
+			require.NoError(t, os.WriteFile(file, []byte{}, 0o644))
+		}
+	}
+	previous := []string{"etc", "etc/hosts", "etc/sudoers.d", "etc/sudoers.d/old", "etc/cron.d", "etc/cron.d/job", "etc/keep.d", "etc/gone"}
+	current := []string{"etc", "etc/hosts", "etc/cron.d"}
+
+	t.Run("remove", func(t *testing.T) {
+		setup(t)
+		removed, remaining := removeDropped(previous, current, warewulfconf.WWClientConf{})
+		assert.Equal(t, []string{"etc/sudoers.d/old", "etc/sudoers.d", "etc/cron.d/job"}, removed)
+		assert.NoFileExists(t, "etc/sudoers.d/old")
+		assert.NoDirExists(t, "etc/sudoers.d")
+		assert.NoFileExists(t, "etc/cron.d/job")
+		assert.FileExists(t, "etc/hosts")
+		// directories with other contents are kept
+		assert.FileExists(t, "etc/keep.d/local")
+		assert.Equal(t, []string{"etc/keep.d"}, remaining)
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		setup(t)
+		dryRun := true
+		removed, remaining := removeDropped(previous, current, warewulfconf.WWClientConf{CleanupDryRunP: &dryRun})
+		assert.Empty(t, removed)
+		assert.FileExists(t, "etc/sudoers.d/old")
+		assert.FileExists(t, "etc/cron.d/job")
+		assert.ElementsMatch(t, []string{"etc/sudoers.d", "etc/sudoers.d/old", "etc/cron.d/job", "etc/keep.d"}, remaining)
+	})
+
+	t.Run("allowlist and denylist", func(t *testing.T) {
+		setup(t)
+		_, remaining := removeDropped(previous, current, warewulfconf.WWClientConf{
+			CleanupPaths:   []string{"/etc/sudoers.d", "/etc/cron.d"},
+			CleanupProtect: []string{"/etc/cron.d/job"},
+		})
+		assert.NoDirExists(t, "etc/sudoers.d")
+		assert.FileExists(t, "etc/cron.d/job")
+		assert.Empty(t, remaining)
+	})
+}
@@ -0,0 +1,67 @@
+package wwclient
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/warewulf/warewulf/internal/pkg/wwlog"
+)
+
+// time to wait before requesting notifications again after a notification
+// or an error
+var (
+	notifyPause      = 5 * time.Second
+	notifyRetryPause = 60 * time.Second
+)
+
+/*
+Waits for notifications from warewulfd and calls update when the runtime
+overlay has to be updated, e.g. because it changed or an update was
+pushed with wwctl overlay push.
+*/
+func watchNotifications(client *http.Client, scheme string, ipaddr string, port int, wwid string, tag string, localUUID uuid.UUID, update func()) {
+	for {
+		values := requestValues(wwid, tag, localUUID)
+		values.Set("stage", "notify")
+		getURL := &url.URL{
+			Scheme:   scheme,
+			Host:     fmt.Sprintf("%s:%d", ipaddr, port),
+			Path:     fmt.Sprintf("notify/%s", wwid),
+			RawQuery: values.Encode(),
+		}
+		notified, err := waitNotification(client, getURL.String())
+		if err != nil {
+			wwlog.Warn("Could not wait for notifications: %s", err)
+			time.Sleep(notifyRetryPause)
+		} else if notified {
+			wwlog.Info("Notified of a runtime overlay update")
+			update()
+			time.Sleep(notifyPause)
+		}
+	}
+}
+
+/*
+Waits for a single notification. Returns true if warewulfd notified this
+node and false if the request timed out without a notification.
+*/
+func waitNotification(client *http.Client, getURL string) (bool, error) {
+	wwlog.Debug("Making request: %s", getURL)
+	resp, err := client.Get(getURL)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNoContent:
+		return false, nil
+	default:
+		return false, fmt.Errorf("got status code: %d", resp.StatusCode)
+	}
+}
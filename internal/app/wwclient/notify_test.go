@@ -0,0 +1,37 @@
+package wwclient
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_waitNotification(t *testing.T) {
+	tests := map[string]struct {
+		status   int
+		notified bool
+		err      bool
+	}{
+		"notified":  {http.StatusOK, true, false},
+		"timed out": {http.StatusNoContent, false, false},
+		"denied":    {http.StatusUnauthorized, false, true},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				assert.Equal(t, "/notify/00:00:00:ff:ff:ff", req.URL.Path)
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+			notified, err := waitNotification(server.Client(), server.URL+"/notify/00:00:00:ff:ff:ff")
+			assert.Equal(t, tt.notified, notified)
+			if tt.err {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -1,8 +1,13 @@
 package wwclient
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"net/http"
@@ -11,6 +16,7 @@ import (
 	"os/exec"
 	"os/signal"
 	"path"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -20,7 +26,9 @@ import (
 	"github.com/spf13/cobra"
 	"github.com/talos-systems/go-smbios/smbios"
 	warewulfconf "github.com/warewulf/warewulf/internal/pkg/config"
+	"github.com/warewulf/warewulf/internal/pkg/nodetoken"
 	"github.com/warewulf/warewulf/internal/pkg/pidfile"
+	"github.com/warewulf/warewulf/internal/pkg/util"
 	"github.com/warewulf/warewulf/internal/pkg/wwlog"
 )
 
@@ -31,20 +39,53 @@ var (
 		Long:         "wwclient fetches the runtime overlay and puts it on the disk",
 		RunE:         CobraRunE,
 		SilenceUsage: true,
+		// errors are printed by main
+		SilenceErrors: true,
 	}
 	DebugFlag       bool
+	OnceFlag        bool
+	DiffFlag        bool
 	PIDFile         string
 	Webclient       *http.Client
 	WarewulfConfArg string
+	// ETag and compression of the last extracted runtime overlay
+	runtimeETag     string
+	runtimeCompress string
+	// error of the last update, which is sent with the health report
+	updateError string
 )
 
 func init() {
 	rootCmd.PersistentFlags().BoolVarP(&DebugFlag, "debug", "d", false, "Run with debugging messages enabled.")
 	rootCmd.PersistentFlags().StringVarP(&PIDFile, "pidfile", "p", "/var/run/wwclient.pid", "PIDFile to use")
 	rootCmd.PersistentFlags().StringVar(&WarewulfConfArg, "warewulfconf", "", "Set the warewulf configuration file")
+	rootCmd.PersistentFlags().BoolVar(&OnceFlag, "once", false, "Update the runtime overlay once and exit")
+	rootCmd.PersistentFlags().BoolVar(&DiffFlag, "diff", false, "Show the differences to the runtime overlay without changing anything")
+	rootCmd.MarkFlagsMutuallyExclusive("once", "diff")
 
 }
 
+// ExitError is an error with the exit status of wwclient. Err is nil if
+// there is nothing to print.
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+func (e *ExitError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("exit status %d", e.Code)
+	}
+	return e.Err.Error()
+}
+
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
+// the runtime overlay was not served by warewulfd
+var errNotServed = errors.New("not updating runtime overlay")
+
 // GetRootCommand returns the root cobra.Command for the application.
 func GetRootCommand() *cobra.Command {
 	// Run cobra
@@ -63,21 +104,32 @@ func CobraRunE(cmd *cobra.Command, args []string) (err error) {
 	if err != nil {
 		return
 	}
-	pid, err := pidfile.Write(PIDFile)
-	defer cleanUp()
-	if err != nil && pid == -1 {
-		wwlog.Warn("%v. starting new wwclient", err)
-	} else if err != nil && pid > 0 {
-		return errors.New("found pidfile " + PIDFile + " not starting")
+	// the diff doesn't change anything, so it can run next to the daemon
+	if !DiffFlag {
+		pid, err := pidfile.Write(PIDFile)
+		defer cleanUp()
+		if err != nil && pid == -1 {
+			wwlog.Warn("%v. starting new wwclient", err)
+		} else if err != nil && pid > 0 {
+			return errors.New("found pidfile " + PIDFile + " not starting")
+		}
 	}
 
-	if os.Args[0] == path.Join(conf.Paths.WWClientdir, "wwclient") {
+	if DiffFlag {
+		// the diff is always against the live file system
 		err := os.Chdir("/")
 		if err != nil {
 			return fmt.Errorf("failed to change dir: %w", err)
 		}
-		log.Printf("Updating live file system LIVE, cancel now if this is in error")
-		time.Sleep(5000 * time.Millisecond)
+	} else if os.Args[0] == path.Join(conf.Paths.WWClientdir, "wwclient") {
+		err := os.Chdir("/")
+		if err != nil {
+			return fmt.Errorf("failed to change dir: %w", err)
+		}
+		if !OnceFlag {
+			log.Printf("Updating live file system LIVE, cancel now if this is in error")
+			time.Sleep(5000 * time.Millisecond)
+		}
 	} else {
 		fmt.Printf("Called via: %s\n", os.Args[0])
 		fmt.Printf("Runtime overlay is being put in '/warewulf/wwclient-test' rather than '/'\n")
@@ -102,21 +154,30 @@ func CobraRunE(cmd *cobra.Command, args []string) (err error) {
 		localTCPAddr.Port = 987
 		wwlog.Info("Running from trusted port")
 	}
+	// the daemon keeps connections from its port open, so a diff next to
+	// it uses any free privileged port instead
+	anyPrivilegedPort := false
+	if DiffFlag && localTCPAddr.Port > 0 && localTCPAddr.Port < 1024 {
+		if pid, running := pidfile.Running(PIDFile); running {
+			wwlog.Info("wwclient is running as pid %d, using another trusted port", pid)
+			anyPrivilegedPort = true
+		}
+	}
 
-	Webclient = &http.Client{
-		Transport: &http.Transport{
-			Proxy: http.ProxyFromEnvironment,
-			DialContext: (&net.Dialer{
-				LocalAddr: &localTCPAddr,
-				Timeout:   30 * time.Second,
-				KeepAlive: 30 * time.Second,
-			}).DialContext,
-			MaxIdleConns:          100,
-			IdleConnTimeout:       2 * time.Duration(conf.Warewulf.UpdateInterval) * time.Second,
-			TLSHandshakeTimeout:   10 * time.Second,
-			ExpectContinueTimeout: 1 * time.Second,
-		},
+	scheme := "http"
+	port := conf.Warewulf.Port
+	var tlsConf *tls.Config
+	if conf.WWClient != nil && conf.WWClient.TLS() {
+		tlsConf, err = clientTLSConfig(conf.WWClient)
+		if err != nil {
+			return err
+		}
+		scheme = "https"
+		port = conf.Warewulf.TLS.Port
+		wwlog.Info("Using tls on port %d", port)
 	}
+
+	Webclient = newWebclient(tlsConf, localTCPAddr, anyPrivilegedPort)
 	var localUUID uuid.UUID
 	var tag string
 	smbiosDump, smbiosErr := smbios.New()
@@ -170,6 +231,19 @@ func CobraRunE(cmd *cobra.Command, args []string) (err error) {
 		wwlog.Info("Dereferencing wwid from [%s] to %s", iface, wwid)
 	}
 
+	if DiffFlag {
+		return diffSystem(scheme, conf.Ipaddr, port, wwid, tag, localUUID)
+	}
+	if OnceFlag {
+		err := updateSystem(scheme, conf.Ipaddr, port, wwid, tag, localUUID)
+		setUpdateError(err)
+		sendHealth(scheme, conf.Ipaddr, port, wwid, tag, localUUID)
+		if err != nil {
+			return &ExitError{Code: 1, Err: err}
+		}
+		return nil
+	}
+
 	duration := 300
 	if conf.Warewulf.UpdateInterval > 0 {
 		duration = conf.Warewulf.UpdateInterval
@@ -192,9 +266,27 @@ func CobraRunE(cmd *cobra.Command, args []string) (err error) {
 			}
 		}
 	}()
+	if conf.WWClient != nil && conf.WWClient.Notify() {
+		// the fetches keep a connection from the local port open to the
+		// same server port, so notifications are waited for from another
+		// free privileged port
+		notifyClient := newWebclient(tlsConf, net.TCPAddr{}, localTCPAddr.Port > 0 && localTCPAddr.Port < 1024)
+		go watchNotifications(notifyClient, scheme, conf.Ipaddr, port, wwid, tag, localUUID, func() {
+			stopTimer.Stop()
+			stopTimer.Reset(0)
+		})
+	}
 	var finishedInitialSync bool = false
 	for {
-		updateSystem(conf.Ipaddr, conf.Warewulf.Port, wwid, tag, localUUID)
+		err := updateSystem(scheme, conf.Ipaddr, port, wwid, tag, localUUID)
+		setUpdateError(err)
+		if err != nil {
+			log.Printf("ERROR: %s\n", err)
+			if errors.Is(err, errNotServed) {
+				time.Sleep(60000 * time.Millisecond)
+			}
+		}
+		sendHealth(scheme, conf.Ipaddr, port, wwid, tag, localUUID)
 		if !finishedInitialSync {
 			// ignore error and status here, as this wouldn't change anything
 			_, _ = daemon.SdNotify(false, daemon.SdNotifyReady)
@@ -206,26 +298,102 @@ func CobraRunE(cmd *cobra.Command, args []string) (err error) {
 	}
 }
 
-func updateSystem(ipaddr string, port int, wwid string, tag string, localUUID uuid.UUID) {
-	var resp *http.Response
+/*
+Returns the http client for requests to warewulfd from the local address,
+or from any free privileged port if anyPrivilegedPort is set
+*/
+func newWebclient(tlsConf *tls.Config, localTCPAddr net.TCPAddr, anyPrivilegedPort bool) *http.Client {
+	dialer := &net.Dialer{
+		LocalAddr: &localTCPAddr,
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	dial := dialer.DialContext
+	if anyPrivilegedPort {
+		dial = dialPrivileged(dialer)
+	}
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			TLSClientConfig:       tlsConf,
+			DialContext:           dial,
+			MaxIdleConns:          100,
+			IdleConnTimeout:       2 * time.Duration(warewulfconf.Get().Warewulf.UpdateInterval) * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: 1 * time.Second,
+		},
+	}
+}
+
+// range of privileged ports which are tried by dialPrivileged, like
+// rresvport(3)
+var (
+	privilegedPortFirst = 1023
+	privilegedPortLast  = 512
+)
+
+/*
+Returns a dial function which connects from the first free privileged
+port, counting down from 1023
+*/
+func dialPrivileged(dialer *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (conn net.Conn, err error) {
+		for port := privilegedPortFirst; port >= privilegedPortLast; port-- {
+			d := *dialer
+			d.LocalAddr = &net.TCPAddr{Port: port}
+			conn, err = d.DialContext(ctx, network, addr)
+			if !errors.Is(err, syscall.EADDRINUSE) && !errors.Is(err, syscall.EADDRNOTAVAIL) {
+				return conn, err
+			}
+		}
+		return nil, fmt.Errorf("no free privileged port: %w", err)
+	}
+}
+
+/*
+Records the error of the last update for the health report
+*/
+func setUpdateError(err error) {
+	if err != nil {
+		updateError = err.Error()
+	} else {
+		updateError = ""
+	}
+}
+
+/*
+Requests the runtime overlay from warewulfd, in the given compression
+and with an If-None-Match header if etag is set. Failed requests are
+retried every second, unless wwclient runs only once.
+*/
+func fetchOverlay(scheme string, ipaddr string, port int, wwid string, tag string, localUUID uuid.UUID, compress string, etag string) (resp *http.Response, err error) {
 	counter := 0
 	for {
-		var err error
-		values := &url.Values{}
-		values.Set("assetkey", tag)
-		values.Set("uuid", localUUID.String())
+		values := requestValues(wwid, tag, localUUID)
 		values.Set("stage", "runtime")
-		values.Set("compress", "gz")
+		if compress != "" {
+			values.Set("compress", compress)
+		}
 		getURL := &url.URL{
-			Scheme:   "http",
+			Scheme:   scheme,
 			Host:     fmt.Sprintf("%s:%d", ipaddr, port),
 			Path:     fmt.Sprintf("provision/%s", wwid),
 			RawQuery: values.Encode(),
 		}
 		wwlog.Debug("Making request: %s", getURL)
-		resp, err = Webclient.Get(getURL.String())
+		var req *http.Request
+		req, err = http.NewRequest(http.MethodGet, getURL.String(), nil)
+		if err != nil {
+			return nil, fmt.Errorf("could not create request: %w", err)
+		}
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		resp, err = Webclient.Do(req)
 		if err == nil {
-			break
+			return resp, nil
+		} else if OnceFlag || DiffFlag {
+			return nil, err
 		} else {
 			if counter > 60 {
 				counter = 0
@@ -237,18 +405,206 @@ func updateSystem(ipaddr string, port int, wwid string, tag string, localUUID uu
 		}
 		time.Sleep(1000 * time.Millisecond)
 	}
+}
+
+/*
+Updates the runtime overlay. Returns an error if the runtime overlay
+could not be fetched or extracted, or if hooks failed.
+*/
+func updateSystem(scheme string, ipaddr string, port int, wwid string, tag string, localUUID uuid.UUID) error {
+	format := warewulfconf.Get().Warewulf.CompressionFormat()
+	compress := util.CompressParam(format)
+	// the ETag of an overlay depends on its compression
+	etag := ""
+	if runtimeCompress == compress {
+		etag = runtimeETag
+	}
+	resp, err := fetchOverlay(scheme, ipaddr, port, wwid, tag, localUUID, compress, etag)
+	if err != nil {
+		return fmt.Errorf("could not fetch runtime overlay: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		wwlog.Verbose("Runtime overlay not modified")
+		return nil
+	}
 	if resp.StatusCode != 200 {
-		log.Printf("Not updating runtime overlay, got status code: %d\n", resp.StatusCode)
-		time.Sleep(60000 * time.Millisecond)
-		return
+		return fmt.Errorf("%w, got status code: %d", errNotServed, resp.StatusCode)
 	}
 	log.Printf("Updating system\n")
-	command := exec.Command("/bin/sh", "-c", "gzip -dc | cpio -iu")
-	command.Stdin = resp.Body
-	err := command.Run()
+	root, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("could not get extraction directory: %w", err)
+	}
+	result, err := extractOverlay(root, resp.Body, format)
+	for _, entryErr := range result.errs {
+		wwlog.Warn("Could not extract %s", entryErr)
+	}
+	if err != nil || len(result.errs) > 0 {
+		// fetch the whole overlay again on the next update
+		runtimeETag = ""
+	} else {
+		runtimeETag = resp.Header.Get("ETag")
+		runtimeCompress = compress
+	}
+	if err != nil {
+		return fmt.Errorf("failed extracting runtime overlay: %w", err)
+	}
+	wwlog.Verbose("Extracted runtime overlay, %d of %d paths changed", len(result.changed), len(result.paths))
+	removed := updateManifest(result.paths)
+	var failed []string
+	for _, hookResult := range updateHooks(root, append(result.changed, removed...)) {
+		if hookResult.Failed() {
+			failed = append(failed, hookResult.Name)
+		}
+	}
+	if len(result.errs) > 0 {
+		err = fmt.Errorf("could not extract %d paths of the runtime overlay", len(result.errs))
+	}
+	if len(failed) > 0 {
+		err = errors.Join(err, fmt.Errorf("hooks failed: %s", strings.Join(failed, ", ")))
+	}
+	return err
+}
+
+/*
+Prints the paths which an update of the runtime overlay would add, change
+or, with wwclient:cleanup, remove on the live file system. The runtime
+overlay is held in memory and nothing is changed. Returns an ExitError
+with status 1 if there are differences and 2 on errors, like diff.
+*/
+func diffSystem(scheme string, ipaddr string, port int, wwid string, tag string, localUUID uuid.UUID) error {
+	format := warewulfconf.Get().Warewulf.CompressionFormat()
+	resp, err := fetchOverlay(scheme, ipaddr, port, wwid, tag, localUUID, util.CompressParam(format), "")
 	if err != nil {
-		log.Printf("ERROR: Failed running CPIO: %s\n", err)
+		return &ExitError{Code: 2, Err: fmt.Errorf("could not fetch runtime overlay: %w", err)}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return &ExitError{Code: 2, Err: fmt.Errorf("%w, got status code: %d", errNotServed, resp.StatusCode)}
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return &ExitError{Code: 2, Err: fmt.Errorf("could not fetch runtime overlay: %w", err)}
+	}
+	decompressed, err := decompressReader(bytes.NewReader(data), format)
+	if err != nil {
+		return &ExitError{Code: 2, Err: fmt.Errorf("could not decompress runtime overlay: %w", err)}
+	}
+	defer decompressed.Close()
+	diff, err := diffArchive("/", decompressed)
+	if err != nil {
+		return &ExitError{Code: 2, Err: err}
+	}
+	var removed []string
+	if conf := warewulfconf.Get().WWClient; conf != nil && conf.Cleanup() {
+		previous, err := readManifest(manifestFile())
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			wwlog.Warn("Could not read manifest of runtime overlay: %s", err)
+		}
+		removed = droppedPaths(previous, diff.paths, *conf)
+	}
+	printDiff(os.Stdout, diff.added, diff.changed, removed)
+	if len(diff.added)+len(diff.changed)+len(removed) > 0 {
+		return &ExitError{Code: 1}
+	}
+	return nil
+}
+
+/*
+Prints the added, changed and removed paths, one per line
+*/
+func printDiff(w io.Writer, added []string, changed []string, removed []string) {
+	for _, list := range []struct {
+		action string
+		paths  []string
+	}{{"added", added}, {"changed", changed}, {"removed", removed}} {
+		for _, name := range list.paths {
+			fmt.Fprintf(w, "%-8s /%s\n", list.action, name)
+		}
+	}
+}
+
+/*
+Records the paths of the extracted runtime overlay in the manifest and, if
+enabled, removes the paths which were dropped from the runtime overlay
+since the last update. Returns the removed paths.
+*/
+func updateManifest(paths []string) (removed []string) {
+	fileName := manifestFile()
+	if conf := warewulfconf.Get().WWClient; conf != nil && conf.Cleanup() {
+		previous, err := readManifest(fileName)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			wwlog.Warn("Could not read manifest of runtime overlay: %s", err)
+		}
+		var remaining []string
+		removed, remaining = removeDropped(previous, paths, *conf)
+		paths = append(paths, remaining...)
+	}
+	if err := writeManifest(fileName, paths); err != nil {
+		wwlog.Warn("Could not write manifest of runtime overlay: %s", err)
+	}
+	return removed
+}
+
+/*
+Returns the query parameters which identify this node to warewulfd,
+signed with the node token if there is one
+*/
+func requestValues(wwid string, tag string, localUUID uuid.UUID) url.Values {
+	values := url.Values{}
+	values.Set("assetkey", tag)
+	values.Set("uuid", localUUID.String())
+	if secret := readNodeToken(); secret != "" {
+		timestamp := time.Now().Unix()
+		values.Set("timestamp", strconv.FormatInt(timestamp, 10))
+		values.Set("token", nodetoken.Sign(secret, wwid, timestamp))
+	}
+	return values
+}
+
+/*
+Returns the secret token of this node from the system overlay, or an
+empty string if the node has no token
+*/
+func readNodeToken() string {
+	conf := warewulfconf.Get()
+	tokenFile := path.Join(conf.Paths.WWClientdir, "token")
+	data, err := os.ReadFile(tokenFile)
+	if err != nil {
+		if conf.Warewulf.NodeTokens() {
+			wwlog.Warn("could not read node token: %s", err)
+		}
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+/*
+Builds the tls configuration for wwclient, pinning the server CA and
+optionally presenting a client certificate.
+*/
+func clientTLSConfig(conf *warewulfconf.WWClientConf) (*tls.Config, error) {
+	ret := &tls.Config{MinVersion: tls.VersionTLS12}
+	if conf.TLSCA != "" {
+		pem, err := os.ReadFile(conf.TLSCA)
+		if err != nil {
+			return nil, fmt.Errorf("could not read server CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in server CA: %s", conf.TLSCA)
+		}
+		ret.RootCAs = pool
+	}
+	if conf.TLSCert != "" && conf.TLSKey != "" {
+		cert, err := tls.LoadX509KeyPair(conf.TLSCert, conf.TLSKey)
+		if err != nil {
+			return nil, fmt.Errorf("could not load client certificate: %w", err)
+		}
+		ret.Certificates = []tls.Certificate{cert}
 	}
+	return ret, nil
 }
 
 func cleanUp() {
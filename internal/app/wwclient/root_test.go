@@ -0,0 +1,49 @@
+package wwclient
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_printDiff(t *testing.T) {
+	var buf bytes.Buffer
+	printDiff(&buf, []string{"etc/motd"}, []string{"etc/hosts", "etc/slurm/slurm.conf"}, []string{"etc/old"})
+	assert.Equal(t, `added    /etc/motd
+changed  /etc/hosts
+changed  /etc/slurm/slurm.conf
+removed  /etc/old
+`, buf.String())
+
+	buf.Reset()
+	printDiff(&buf, nil, nil, nil)
+	assert.Empty(t, buf.String())
+}
+
+func Test_dialPrivileged(t *testing.T) {
+	server, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer server.Close()
+	// the port of the daemon
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer busy.Close()
+	busyPort := busy.Addr().(*net.TCPAddr).Port
+
+	defer func(first, last int) {
+		privilegedPortFirst, privilegedPortLast = first, last
+	}(privilegedPortFirst, privilegedPortLast)
+	privilegedPortFirst, privilegedPortLast = busyPort, busyPort-100
+
+	dial := dialPrivileged(&net.Dialer{})
+	conn, err := dial(context.Background(), "tcp", server.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	port := conn.LocalAddr().(*net.TCPAddr).Port
+	assert.Less(t, port, busyPort)
+	assert.GreaterOrEqual(t, port, busyPort-100)
+}
@@ -14,7 +14,7 @@ func CobraRunE(cmd *cobra.Command, args []string) error {
 
 	conf := warewulfconf.Get()
 	if conf.Autodetected() && conf.InitializedFromFile() {
-		if err = conf.PersistToFile(conf.GetWarewulfConf()); err != nil {
+		if err = persistConf(conf); err != nil {
 			wwlog.Warn("error when persisting auto-detected settings: %s", err)
 		}
 	}
@@ -56,3 +56,15 @@ func CobraRunE(cmd *cobra.Command, args []string) error {
 
 	return nil
 }
+
+/*
+Persists the auto-detected settings to warewulf.conf, holding its lock
+*/
+func persistConf(conf *warewulfconf.WarewulfYaml) error {
+	lock, err := warewulfconf.Lock(conf.GetWarewulfConf())
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	return conf.PersistToFile(conf.GetWarewulfConf())
+}
@@ -2,6 +2,7 @@ package list
 
 import (
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -26,7 +27,11 @@ func CobraRunE(vars *variables) func(cmd *cobra.Command, args []string) (err err
 			}
 
 			if vars.full {
-				t.AddHeader("IMAGE NAME", "NODES", "KERNEL VERSION", "CREATION TIME", "MODIFICATION TIME", "SIZE")
+				header := []string{"IMAGE NAME", "NODES", "KERNEL VERSION", "CREATION TIME", "MODIFICATION TIME", "SIZE"}
+				if vars.compressed {
+					header = append(header, compressedHeader()...)
+				}
+				t.AddHeader(table.Prep(header)...)
 				for i := 0; i < len(imageInfo); i++ {
 					if len(args) > 0 && !util.InSlice(args, imageInfo[i].Name) {
 						continue
@@ -34,9 +39,6 @@ func CobraRunE(vars *variables) func(cmd *cobra.Command, args []string) (err err
 					createTime := time.Unix(int64(imageInfo[i].CreateDate), 0)
 					modTime := time.Unix(int64(imageInfo[i].ModDate), 0)
 					sz := util.ByteToString(int64(imageInfo[i].ImgSize))
-					if vars.compressed {
-						sz = util.ByteToString(int64(imageInfo[i].ImgSizeComp))
-					}
 					if vars.chroot {
 						size, err := util.DirSize(image.SourceDir(imageInfo[i].Name))
 						if err != nil {
@@ -45,14 +47,18 @@ func CobraRunE(vars *variables) func(cmd *cobra.Command, args []string) (err err
 						}
 						sz = util.ByteToString(int64(size))
 					}
-					t.AddLine(
+					line := []string{
 						imageInfo[i].Name,
 						strconv.FormatUint(uint64(imageInfo[i].NodeCount), 10),
 						imageInfo[i].KernelVersion,
 						createTime.Format(time.RFC822),
 						modTime.Format(time.RFC822),
 						sz,
-					)
+					}
+					if vars.compressed {
+						line = append(line, compressedSizes(imageInfo[i].Name)...)
+					}
+					t.AddLine(table.Prep(line)...)
 				}
 			} else if vars.kernel {
 				t.AddHeader("IMAGE NAME", "NODES", "KERNEL VERSION")
@@ -67,15 +73,16 @@ func CobraRunE(vars *variables) func(cmd *cobra.Command, args []string) (err err
 					)
 				}
 			} else if showSize {
-				t.AddHeader("IMAGE NAME", "NODES", "SIZE")
+				header := []string{"IMAGE NAME", "NODES", "SIZE"}
+				if vars.compressed {
+					header = append(header, compressedHeader()...)
+				}
+				t.AddHeader(table.Prep(header)...)
 				for i := 0; i < len(imageInfo); i++ {
 					if len(args) > 0 && !util.InSlice(args, imageInfo[i].Name) {
 						continue
 					}
 					sz := util.ByteToString(int64(imageInfo[i].ImgSize))
-					if vars.compressed {
-						sz = util.ByteToString(int64(imageInfo[i].ImgSizeComp))
-					}
 					if vars.chroot {
 						size, err := util.DirSize(image.SourceDir(imageInfo[i].Name))
 						if err != nil {
@@ -85,11 +92,15 @@ func CobraRunE(vars *variables) func(cmd *cobra.Command, args []string) (err err
 						sz = util.ByteToString(size)
 					}
 
-					t.AddLine(
+					line := []string{
 						imageInfo[i].Name,
 						strconv.FormatUint(uint64(imageInfo[i].NodeCount), 10),
 						sz,
-					)
+					}
+					if vars.compressed {
+						line = append(line, compressedSizes(imageInfo[i].Name)...)
+					}
+					t.AddLine(table.Prep(line)...)
 				}
 			}
 		} else {
@@ -109,3 +120,30 @@ func CobraRunE(vars *variables) func(cmd *cobra.Command, args []string) (err err
 		return
 	}
 }
+
+/*
+Header of the columns with the size of each compressed variant of an
+image
+*/
+func compressedHeader() (header []string) {
+	for _, format := range util.CompressFormats {
+		header = append(header, strings.ToUpper(format)+" SIZE")
+	}
+	return header
+}
+
+/*
+Sizes of the compressed variants of an image, "--" if the image hasn't
+been compressed in a format
+*/
+func compressedSizes(name string) (sizes []string) {
+	compressed := image.CompressedSizes(name)
+	for _, format := range util.CompressFormats {
+		if size, ok := compressed[format]; ok {
+			sizes = append(sizes, util.ByteToString(size))
+		} else {
+			sizes = append(sizes, "--")
+		}
+	}
+	return sizes
+}
@@ -19,6 +19,7 @@ func Test_List(t *testing.T) {
 		args     []string
 		stdout   string
 		inDb     string
+		files    map[string]string
 		mockFunc func()
 	}{
 		{
@@ -50,6 +51,37 @@ nodes:
 				}
 			},
 		},
+		{
+			name: "image list compressed sizes",
+			args: []string{"--compressed"},
+			stdout: `
+IMAGE NAME  NODES  SIZE  GZIP SIZE  ZSTD SIZE
+----------  -----  ----  ---------  ---------
+test        1      6 B   --         4 B
+`,
+			inDb: `
+nodeprofiles:
+  default: {}
+nodes:
+  n01:
+    profiles:
+    - default
+`,
+			files: map[string]string{
+				"srv/warewulf/images/test.img":     "cpio..",
+				"srv/warewulf/images/test.img.zst": "zstd",
+			},
+			mockFunc: func() {
+				imageList = func() (imageInfo []*wwapiv1.ImageInfo, err error) {
+					imageInfo = append(imageInfo, &wwapiv1.ImageInfo{
+						Name:      "test",
+						NodeCount: 1,
+						ImgSize:   6,
+					})
+					return
+				}
+			},
+		},
 	}
 
 	warewulfd.SetNoDaemon()
@@ -57,6 +89,9 @@ nodes:
 		env := testenv.New(t)
 		defer env.RemoveAll()
 		env.WriteFile("etc/warewulf/nodes.conf", tt.inDb)
+		for fileName, content := range tt.files {
+			env.WriteFile(fileName, content)
+		}
 
 		t.Logf("Running test: %s\n", tt.name)
 		t.Run(tt.name, func(t *testing.T) {
@@ -29,6 +29,6 @@ func GetCommand() *cobra.Command {
 	baseCmd.PersistentFlags().BoolVarP(&vars.kernel, "kernel", "k", false, "show kernel version")
 	baseCmd.PersistentFlags().BoolVarP(&vars.size, "size", "s", false, "show size information")
 	baseCmd.PersistentFlags().BoolVarP(&vars.chroot, "chroot", "c", false, "show size of chroot")
-	baseCmd.PersistentFlags().BoolVar(&vars.compressed, "compressed", false, "show size of the compressed image")
+	baseCmd.PersistentFlags().BoolVar(&vars.compressed, "compressed", false, "show size of each compressed image")
 	return baseCmd
 }
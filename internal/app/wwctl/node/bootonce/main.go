@@ -0,0 +1,71 @@
+package bootonce
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/spf13/cobra"
+
+	"github.com/warewulf/warewulf/internal/pkg/bootonce"
+	warewulfconf "github.com/warewulf/warewulf/internal/pkg/config"
+	"github.com/warewulf/warewulf/internal/pkg/hostlist"
+	"github.com/warewulf/warewulf/internal/pkg/image"
+	"github.com/warewulf/warewulf/internal/pkg/node"
+	"github.com/warewulf/warewulf/internal/pkg/util"
+	"github.com/warewulf/warewulf/internal/pkg/wwlog"
+)
+
+func CobraRunE(vars *variables) func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		override := bootonce.Override{
+			Ipxe:       vars.ipxe,
+			ImageName:  vars.image,
+			KernelArgs: vars.kernelArgs,
+		}
+		if vars.clear && !override.Empty() {
+			return fmt.Errorf("--clear can't be combined with overrides")
+		} else if !vars.clear && override.Empty() {
+			return fmt.Errorf("one of --ipxe, --image, --kernel-args or --clear is required")
+		}
+		if override.Ipxe != "" {
+			if warewulfconf.Get().Warewulf.GrubBoot() {
+				return fmt.Errorf("--ipxe has no effect on nodes booting with grub")
+			}
+			template := path.Join(warewulfconf.Get().Paths.Sysconfdir, "warewulf/ipxe", override.Ipxe+".ipxe")
+			if !util.IsFile(template) {
+				return fmt.Errorf("iPXE template not found: %s", template)
+			}
+		}
+		if override.ImageName != "" && !image.ValidSource(override.ImageName) {
+			return fmt.Errorf("image not found: %s", override.ImageName)
+		}
+
+		nodeDB, err := node.New()
+		if err != nil {
+			return fmt.Errorf("failed to open node database: %w", err)
+		}
+		nodeNames := hostlist.Expand(args)
+		for _, nodeName := range nodeNames {
+			if _, err := nodeDB.GetNode(nodeName); err != nil {
+				return fmt.Errorf("invalid node: %s", nodeName)
+			}
+		}
+
+		for _, nodeName := range nodeNames {
+			if vars.clear {
+				err = bootonce.Clear(nodeName)
+			} else {
+				err = bootonce.Set(nodeName, override)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if vars.clear {
+			wwlog.Info("Cleared boot overrides of %d node(s)", len(nodeNames))
+		} else {
+			wwlog.Info("Set boot override of %d node(s) for their next boot: %s", len(nodeNames), override)
+		}
+		return nil
+	}
+}
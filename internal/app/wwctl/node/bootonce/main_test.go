@@ -0,0 +1,59 @@
+package bootonce
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/warewulf/warewulf/internal/pkg/bootonce"
+	warewulfconf "github.com/warewulf/warewulf/internal/pkg/config"
+	"github.com/warewulf/warewulf/internal/pkg/testenv"
+)
+
+func Test_BootOnce(t *testing.T) {
+	env := testenv.New(t)
+	defer env.RemoveAll()
+	env.WriteFile("etc/warewulf/nodes.conf", `nodes:
+  n1: {}
+  n2: {}`)
+	env.WriteFile("etc/warewulf/ipxe/localdisk.ipxe", "#!ipxe")
+
+	run := func(args ...string) error {
+		baseCmd := GetCommand()
+		baseCmd.SetArgs(args)
+		buf := new(bytes.Buffer)
+		baseCmd.SetOut(buf)
+		baseCmd.SetErr(buf)
+		return baseCmd.Execute()
+	}
+
+	require.NoError(t, run("n[1-2]", "--ipxe", "localdisk", "--kernel-args", "quiet,single"))
+	overrides, err := bootonce.List()
+	require.NoError(t, err)
+	assert.Len(t, overrides, 2)
+	assert.Equal(t, "localdisk", overrides["n2"].Ipxe)
+	assert.Equal(t, []string{"quiet", "single"}, overrides["n2"].KernelArgs)
+
+	require.NoError(t, run("n1", "--clear"))
+	overrides, err = bootonce.List()
+	require.NoError(t, err)
+	assert.NotContains(t, overrides, "n1")
+	assert.Contains(t, overrides, "n2")
+
+	for name, args := range map[string][]string{
+		"no override":      {"n1"},
+		"clear override":   {"n1", "--clear", "--ipxe", "localdisk"},
+		"unknown template": {"n1", "--ipxe", "memtest"},
+		"unknown image":    {"n1", "--image", "rescue"},
+		"unknown node":     {"n3", "--ipxe", "localdisk"},
+	} {
+		assert.Error(t, run(args...), name)
+	}
+
+	grubBoot := true
+	warewulfconf.Get().Warewulf.GrubBootP = &grubBoot
+	assert.Error(t, run("n1", "--ipxe", "localdisk"), "ipxe template with grub")
+	assert.NoError(t, run("n1", "--kernel-args", "single"))
+}
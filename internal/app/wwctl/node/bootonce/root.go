@@ -0,0 +1,38 @@
+package bootonce
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/warewulf/warewulf/internal/app/wwctl/completions"
+)
+
+type variables struct {
+	ipxe       string
+	image      string
+	kernelArgs []string
+	clear      bool
+}
+
+// GetRootCommand returns the root cobra.Command for the application.
+func GetCommand() *cobra.Command {
+	vars := variables{}
+	baseCmd := &cobra.Command{
+		DisableFlagsInUseLine: true,
+		Use:                   "boot-once [OPTIONS] PATTERN",
+		Short:                 "Override boot settings for the next boot of nodes",
+		Long: "This command overrides the iPXE template, image or kernel arguments of nodes\n" +
+			"matching PATTERN for their next boot only. warewulfd clears the override once\n" +
+			"it has rendered the boot script of a node. Pending overrides are shown by\n" +
+			"'wwctl node status'.",
+		Args:              cobra.MinimumNArgs(1),
+		RunE:              CobraRunE(&vars),
+		ValidArgsFunction: completions.Nodes,
+	}
+	baseCmd.PersistentFlags().StringVar(&vars.ipxe, "ipxe", "", "iPXE template for the next boot, e.g. localdisk")
+	baseCmd.PersistentFlags().StringVar(&vars.image, "image", "", "Image for the next boot")
+	baseCmd.PersistentFlags().StringSliceVar(&vars.kernelArgs, "kernel-args", nil, "Kernel arguments for the next boot")
+	baseCmd.PersistentFlags().BoolVar(&vars.clear, "clear", false, "Remove pending overrides")
+	if err := baseCmd.RegisterFlagCompletionFunc("image", completions.Images); err != nil {
+		panic(err)
+	}
+	return baseCmd
+}
@@ -0,0 +1,40 @@
+package approve
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	apinode "github.com/warewulf/warewulf/internal/pkg/api/node"
+	"github.com/warewulf/warewulf/internal/pkg/wwlog"
+)
+
+var discoverList = apinode.NodeDiscoverList
+
+func CobraRunE(cmd *cobra.Command, args []string) error {
+	nodeName, hwaddr := args[0], strings.ToLower(args[1])
+	if _, err := net.ParseMAC(hwaddr); err != nil {
+		return fmt.Errorf("invalid hardware address: %s", args[1])
+	}
+	queue, err := discoverList()
+	if err != nil {
+		return err
+	}
+	queued := false
+	for _, n := range queue {
+		if n.Hwaddr == hwaddr {
+			queued = true
+			break
+		}
+	}
+	if !queued {
+		return fmt.Errorf("%s is not in the discovery queue", hwaddr)
+	}
+	if err := apinode.NodeDiscoverApprove(map[string]string{nodeName: hwaddr}); err != nil {
+		return err
+	}
+	wwlog.Info("Assigned %s to node %s", hwaddr, nodeName)
+	return nil
+}
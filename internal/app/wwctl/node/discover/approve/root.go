@@ -0,0 +1,22 @@
+package approve
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/warewulf/warewulf/internal/app/wwctl/completions"
+)
+
+// GetRootCommand returns the root cobra.Command for the application.
+func GetCommand() *cobra.Command {
+	baseCmd := &cobra.Command{
+		DisableFlagsInUseLine: true,
+		Use:                   "approve NODENAME HWADDR",
+		Short:                 "Assign a queued hardware address to a node",
+		Long: "This command assigns a hardware address from the discovery queue to the\n" +
+			"primary network device of a node, or its first network device without a\n" +
+			"hardware address, and persists the node configuration.",
+		Args:              cobra.ExactArgs(2),
+		RunE:              CobraRunE,
+		ValidArgsFunction: completions.Nodes,
+	}
+	return baseCmd
+}
@@ -0,0 +1,54 @@
+package assign
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/warewulf/warewulf/internal/app/wwctl/table"
+	apinode "github.com/warewulf/warewulf/internal/pkg/api/node"
+	"github.com/warewulf/warewulf/internal/pkg/hostlist"
+	"github.com/warewulf/warewulf/internal/pkg/node"
+	"github.com/warewulf/warewulf/internal/pkg/util"
+	"github.com/warewulf/warewulf/internal/pkg/wwlog"
+)
+
+var discoverList = apinode.NodeDiscoverList
+
+func CobraRunE(vars *variables) func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		queue, err := discoverList()
+		if err != nil {
+			return err
+		}
+		if err := apinode.SortDiscovered(queue, vars.order); err != nil {
+			return err
+		}
+		nodeDB, err := node.New()
+		if err != nil {
+			return fmt.Errorf("failed to open node database: %w", err)
+		}
+		targets := apinode.DiscoverTargets(&nodeDB, hostlist.Expand(args))
+		if len(queue) == 0 || len(targets) == 0 {
+			wwlog.Info("No queued nodes to assign")
+			return nil
+		}
+
+		assignments := make(map[string]string)
+		t := table.New(cmd.OutOrStdout())
+		t.AddHeader("NODE NAME", "HWADDR", "IPADDR")
+		for i := 0; i < len(queue) && i < len(targets); i++ {
+			assignments[targets[i]] = queue[i].Hwaddr
+			t.AddLine(table.Prep([]string{targets[i], queue[i].Hwaddr, queue[i].Ipaddr})...)
+		}
+		t.Print()
+		if len(queue) > len(targets) {
+			wwlog.Warn("%d queued nodes remain unassigned", len(queue)-len(targets))
+		}
+
+		if !vars.yes && !util.Confirm(fmt.Sprintf("Are you sure you want to assign %d nodes", len(assignments))) {
+			return nil
+		}
+		return apinode.NodeDiscoverApprove(assignments)
+	}
+}
@@ -0,0 +1,119 @@
+package assign
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	apinode "github.com/warewulf/warewulf/internal/pkg/api/node"
+	"github.com/warewulf/warewulf/internal/pkg/node"
+	"github.com/warewulf/warewulf/internal/pkg/testenv"
+	"github.com/warewulf/warewulf/internal/pkg/warewulfd"
+)
+
+func Test_Assign(t *testing.T) {
+	queue := []apinode.DiscoveredNode{
+		{Hwaddr: "00:00:00:00:00:03", Ipaddr: "10.0.1.3", FirstSeen: 30, LastSeen: 30},
+		{Hwaddr: "00:00:00:00:00:01", Ipaddr: "10.0.1.1", FirstSeen: 10, LastSeen: 40},
+		{Hwaddr: "00:00:00:00:00:02", Ipaddr: "10.0.1.2", FirstSeen: 20, LastSeen: 20},
+	}
+	prevList := discoverList
+	discoverList = func() ([]apinode.DiscoveredNode, error) {
+		return append([]apinode.DiscoveredNode(nil), queue...), nil
+	}
+	defer func() {
+		discoverList = prevList
+	}()
+	warewulfd.SetNoDaemon()
+
+	tests := map[string]struct {
+		args    []string
+		hwaddrs map[string]string
+		wantErr bool
+	}{
+		"first seen": {
+			args: []string{"n[1-4]", "--yes"},
+			hwaddrs: map[string]string{
+				"n1": "00:00:00:00:00:01",
+				"n2": "00:00:00:ff:ff:ff",
+				"n3": "00:00:00:00:00:02",
+				"n4": "00:00:00:00:00:03",
+			},
+		},
+		"last seen": {
+			args: []string{"n[3-4]", "--order", "last-seen", "--yes"},
+			hwaddrs: map[string]string{
+				"n1": "",
+				"n2": "00:00:00:ff:ff:ff",
+				"n3": "00:00:00:00:00:02",
+				"n4": "00:00:00:00:00:03",
+			},
+		},
+		"unknown order": {
+			args:    []string{"n1", "--order", "random", "--yes"},
+			wantErr: true,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			env := testenv.New(t)
+			defer env.RemoveAll()
+			env.WriteFile("etc/warewulf/nodes.conf", `nodeprofiles:
+  default:
+    network devices:
+      default:
+        device: eth0
+nodes:
+  n1:
+    profiles:
+    - default
+  n2:
+    profiles:
+    - default
+    network devices:
+      default:
+        hwaddr: 00:00:00:ff:ff:ff
+  n3:
+    discoverable: true
+    profiles:
+    - default
+  n4:
+    network devices:
+      ib0:
+        device: ib0
+        hwaddr: 00:00:00:00:ff:ff
+      eth0:
+        device: eth0`)
+
+			baseCmd := GetCommand()
+			baseCmd.SetArgs(tt.args)
+			buf := new(bytes.Buffer)
+			baseCmd.SetOut(buf)
+			baseCmd.SetErr(buf)
+			err := baseCmd.Execute()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			registry, err := node.New()
+			require.NoError(t, err)
+			for nodeName, hwaddr := range tt.hwaddrs {
+				n, err := registry.GetNode(nodeName)
+				require.NoError(t, err)
+				netdev := "default"
+				if nodeName == "n4" {
+					netdev = "eth0"
+				}
+				assert.Equal(t, hwaddr, n.NetDevs[netdev].Hwaddr, nodeName)
+			}
+			n3, err := registry.GetNode("n3")
+			require.NoError(t, err)
+			assert.False(t, n3.Discoverable.Bool())
+		})
+	}
+}
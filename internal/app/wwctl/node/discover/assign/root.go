@@ -0,0 +1,35 @@
+package assign
+
+import (
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/warewulf/warewulf/internal/app/wwctl/completions"
+	apinode "github.com/warewulf/warewulf/internal/pkg/api/node"
+)
+
+type variables struct {
+	order string
+	yes   bool
+}
+
+// GetRootCommand returns the root cobra.Command for the application.
+func GetCommand() *cobra.Command {
+	vars := variables{}
+	baseCmd := &cobra.Command{
+		DisableFlagsInUseLine: true,
+		Use:                   "assign [OPTIONS] NODES",
+		Short:                 "Assign queued nodes to a list of nodes",
+		Long: "This command assigns the hardware addresses in the discovery queue, in the\n" +
+			"given order, to the nodes of the hostlist which don't have a hardware\n" +
+			"address yet. For example, 'assign n[001-040] --order first-seen' assigns\n" +
+			"the node which was seen first to n001.",
+		Args:              cobra.MinimumNArgs(1),
+		RunE:              CobraRunE(&vars),
+		ValidArgsFunction: completions.Nodes,
+	}
+	baseCmd.PersistentFlags().StringVar(&vars.order, "order", "first-seen",
+		"Order of the queued nodes ("+strings.Join(apinode.DiscoverOrders, ", ")+")")
+	baseCmd.PersistentFlags().BoolVarP(&vars.yes, "yes", "y", false, "Set 'yes' to all questions asked")
+	return baseCmd
+}
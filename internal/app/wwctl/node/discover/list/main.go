@@ -0,0 +1,33 @@
+package list
+
+import (
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/warewulf/warewulf/internal/app/wwctl/table"
+	apinode "github.com/warewulf/warewulf/internal/pkg/api/node"
+)
+
+var discoverList = apinode.NodeDiscoverList
+
+func CobraRunE(cmd *cobra.Command, args []string) error {
+	nodes, err := discoverList()
+	if err != nil {
+		return err
+	}
+	t := table.New(cmd.OutOrStdout())
+	t.AddHeader("HWADDR", "IPADDR", "FIRST SEEN", "LAST SEEN", "ASSET KEY", "UUID")
+	for _, n := range nodes {
+		t.AddLine(table.Prep([]string{
+			n.Hwaddr,
+			n.Ipaddr,
+			time.Unix(n.FirstSeen, 0).Format(time.DateTime),
+			time.Unix(n.LastSeen, 0).Format(time.DateTime),
+			n.AssetKey,
+			n.UUID,
+		})...)
+	}
+	t.Print()
+	return nil
+}
@@ -0,0 +1,19 @@
+package list
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// GetRootCommand returns the root cobra.Command for the application.
+func GetCommand() *cobra.Command {
+	baseCmd := &cobra.Command{
+		DisableFlagsInUseLine: true,
+		Use:                   "list",
+		Short:                 "List the discovery queue",
+		Long:                  "This command lists the unknown nodes which are waiting in the discovery queue of warewulfd.",
+		Args:                  cobra.NoArgs,
+		RunE:                  CobraRunE,
+		Aliases:               []string{"ls"},
+	}
+	return baseCmd
+}
@@ -0,0 +1,28 @@
+package discover
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/warewulf/warewulf/internal/app/wwctl/node/discover/approve"
+	"github.com/warewulf/warewulf/internal/app/wwctl/node/discover/assign"
+	"github.com/warewulf/warewulf/internal/app/wwctl/node/discover/list"
+)
+
+var baseCmd = &cobra.Command{
+	DisableFlagsInUseLine: true,
+	Use:                   "discover COMMAND [OPTIONS]",
+	Short:                 "Manage the discovery queue",
+	Long: "With warewulf.conf:warewulf.discovery queue, warewulfd queues unknown nodes\n" +
+		"which request to be provisioned instead of assigning them to the first\n" +
+		"discoverable node. These commands list the queue and assign queued nodes.",
+}
+
+func init() {
+	baseCmd.AddCommand(list.GetCommand())
+	baseCmd.AddCommand(approve.GetCommand())
+	baseCmd.AddCommand(assign.GetCommand())
+}
+
+// GetRootCommand returns the root cobra.Command for the application.
+func GetCommand() *cobra.Command {
+	return baseCmd
+}
@@ -100,11 +100,13 @@ func CobraRunE(cmd *cobra.Command, args []string) error {
 				}
 			}
 
+			// changed nodes by name, nil for deleted nodes
+			changes := make(map[string]*node.Node)
 			var added, deleted, updated int
 			for nodeID := range origNodes {
 				if editNode, ok := editNodes[nodeID]; !ok || editNode == nil {
 					wwlog.Verbose("delete node: %s", nodeID)
-					delete(registry.Nodes, nodeID)
+					changes[nodeID] = nil
 					deleted += 1
 				}
 			}
@@ -112,18 +114,18 @@ func CobraRunE(cmd *cobra.Command, args []string) error {
 				if _, ok := origNodes[nodeID]; !ok {
 					wwlog.Verbose("add node: %s", nodeID)
 					added += 1
-					registry.Nodes[nodeID] = editNodes[nodeID]
+					changes[nodeID] = editNodes[nodeID]
 				} else if equalYaml, err := util.EqualYaml(origNodes[nodeID], editNodes[nodeID]); err != nil {
 					return err
 				} else if !equalYaml {
 					wwlog.Verbose("update node: %s", nodeID)
 					updated += 1
-					registry.Nodes[nodeID] = editNodes[nodeID]
+					changes[nodeID] = editNodes[nodeID]
 				}
 			}
 
 			if util.Confirm(fmt.Sprintf("Are you sure you want to add %d, delete %d, and update %d nodes", added, deleted, updated)) {
-				if err := registry.Persist(); err != nil {
+				if err := persistChanges(origNodes, changes); err != nil {
 					return err
 				}
 
@@ -140,3 +142,35 @@ func CobraRunE(cmd *cobra.Command, args []string) error {
 
 	return nil
 }
+
+/*
+Applies the changes, with nil deleting a node, to the current node
+configuration while holding its lock, so that the lock isn't held while
+editing. Nodes which were changed by someone else meanwhile are not
+overwritten.
+*/
+func persistChanges(origNodes map[string]*node.Node, changes map[string]*node.Node) error {
+	lock, err := node.Lock()
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	registry, err := node.New()
+	if err != nil {
+		return err
+	}
+	for nodeID, changed := range changes {
+		if equal, err := util.EqualYaml(origNodes[nodeID], registry.Nodes[nodeID]); err != nil {
+			return err
+		} else if !equal {
+			return fmt.Errorf("node %s was changed while editing, not saving any changes", nodeID)
+		}
+		if changed == nil {
+			delete(registry.Nodes, nodeID)
+		} else {
+			registry.Nodes[nodeID] = changed
+		}
+	}
+	return registry.Persist()
+}
@@ -0,0 +1,50 @@
+package edit
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/warewulf/warewulf/internal/pkg/node"
+	"github.com/warewulf/warewulf/internal/pkg/testenv"
+)
+
+func Test_persistChanges(t *testing.T) {
+	env := testenv.New(t)
+	defer env.RemoveAll()
+	env.WriteFile("etc/warewulf/nodes.conf", `nodes:
+  n1:
+    comment: one
+  n2:
+    comment: two`)
+
+	registry, err := node.New()
+	require.NoError(t, err)
+	orig := map[string]*node.Node{"n1": registry.Nodes["n1"], "n2": registry.Nodes["n2"]}
+
+	// n2 is changed by someone else while n1 is edited
+	env.WriteFile("etc/warewulf/nodes.conf", `nodes:
+  n1:
+    comment: one
+  n2:
+    comment: changed
+  n3: {}`)
+	edited := node.NewNode("n1")
+	edited.Comment = "edited"
+	added := node.NewNode("n4")
+	added.Comment = "added"
+	require.NoError(t, persistChanges(orig, map[string]*node.Node{"n1": &edited, "n4": &added}))
+	registry, err = node.New()
+	require.NoError(t, err)
+	assert.Equal(t, "edited", registry.Nodes["n1"].Comment)
+	assert.Equal(t, "changed", registry.Nodes["n2"].Comment)
+	assert.Contains(t, registry.Nodes, "n3")
+	assert.Equal(t, "added", registry.Nodes["n4"].Comment)
+
+	// changes of n2 would overwrite the concurrent change
+	assert.Error(t, persistChanges(orig, map[string]*node.Node{"n2": nil}))
+	registry, err = node.New()
+	require.NoError(t, err)
+	assert.Contains(t, registry.Nodes, "n2")
+}
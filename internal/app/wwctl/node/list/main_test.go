@@ -449,6 +449,7 @@ nodes:
   "n01": {
     "Discoverable": "",
     "AssetKey": "",
+    "UUID": "",
     "Profiles": [
       "default"
     ],
@@ -456,6 +457,7 @@ nodes:
     "ClusterName": "",
     "ImageName": "",
     "Ipxe": "",
+    "UUIDBinding": "",
     "RuntimeOverlay": null,
     "SystemOverlay": null,
     "Kernel": null,
@@ -488,6 +490,7 @@ nodes:
   "n01": {
     "Discoverable": "",
     "AssetKey": "",
+    "UUID": "",
     "Profiles": [
       "default"
     ],
@@ -495,6 +498,7 @@ nodes:
     "ClusterName": "",
     "ImageName": "",
     "Ipxe": "",
+    "UUIDBinding": "",
     "RuntimeOverlay": null,
     "SystemOverlay": null,
     "Kernel": null,
@@ -511,6 +515,7 @@ nodes:
   "n02": {
     "Discoverable": "",
     "AssetKey": "",
+    "UUID": "",
     "Profiles": [
       "default"
     ],
@@ -518,6 +523,7 @@ nodes:
     "ClusterName": "",
     "ImageName": "",
     "Ipxe": "",
+    "UUIDBinding": "",
     "RuntimeOverlay": null,
     "SystemOverlay": null,
     "Kernel": null,
@@ -3,8 +3,10 @@ package node
 import (
 	"github.com/spf13/cobra"
 	"github.com/warewulf/warewulf/internal/app/wwctl/node/add"
+	"github.com/warewulf/warewulf/internal/app/wwctl/node/bootonce"
 	"github.com/warewulf/warewulf/internal/app/wwctl/node/console"
 	"github.com/warewulf/warewulf/internal/app/wwctl/node/delete"
+	"github.com/warewulf/warewulf/internal/app/wwctl/node/discover"
 	"github.com/warewulf/warewulf/internal/app/wwctl/node/edit"
 	"github.com/warewulf/warewulf/internal/app/wwctl/node/export"
 	"github.com/warewulf/warewulf/internal/app/wwctl/node/imprt"
@@ -12,6 +14,7 @@ import (
 	"github.com/warewulf/warewulf/internal/app/wwctl/node/sensors"
 	"github.com/warewulf/warewulf/internal/app/wwctl/node/set"
 	nodestatus "github.com/warewulf/warewulf/internal/app/wwctl/node/status"
+	"github.com/warewulf/warewulf/internal/app/wwctl/node/token"
 )
 
 var (
@@ -37,6 +40,9 @@ func init() {
 	baseCmd.AddCommand(edit.GetCommand())
 	baseCmd.AddCommand(imprt.GetCommand())
 	baseCmd.AddCommand(export.GetCommand())
+	baseCmd.AddCommand(discover.GetCommand())
+	baseCmd.AddCommand(bootonce.GetCommand())
+	baseCmd.AddCommand(token.GetCommand())
 }
 
 // GetRootCommand returns the root cobra.Command for the application.
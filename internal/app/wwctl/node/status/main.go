@@ -1,6 +1,7 @@
 package nodestatus
 
 import (
+	"context"
 	"fmt"
 	"sort"
 	"strings"
@@ -10,12 +11,18 @@ import (
 	"github.com/spf13/cobra"
 	apinode "github.com/warewulf/warewulf/internal/pkg/api/node"
 	"github.com/warewulf/warewulf/internal/pkg/api/routes/wwapiv1"
+	"github.com/warewulf/warewulf/internal/pkg/bootonce"
 	warewulfconf "github.com/warewulf/warewulf/internal/pkg/config"
 	"github.com/warewulf/warewulf/internal/pkg/hostlist"
+	"github.com/warewulf/warewulf/internal/pkg/nodehealth"
 	"github.com/warewulf/warewulf/internal/pkg/wwlog"
 	"golang.org/x/term"
 )
 
+// interval in which the watch view is redrawn without status updates, to
+// refresh the time since the nodes were last seen
+const watchRefresh = time.Second
+
 func CobraRunE(cmd *cobra.Command, args []string) (err error) {
 
 	controller := warewulfconf.Get()
@@ -25,109 +32,321 @@ func CobraRunE(cmd *cobra.Command, args []string) (err error) {
 
 	}
 
-	for {
-		var elipsis bool
-		var height int
-		var count int
-		rightnow := time.Now().Unix()
+	if SetHistory {
+		return printHistory(args)
+	}
+
+	var nodeStatusResponse *wwapiv1.NodeStatusResponse
+	nodeStatusResponse, err = apinode.NodeStatus([]string{})
+	if err != nil {
+		return err
+	}
 
-		var nodeStatusResponse *wwapiv1.NodeStatusResponse
-		nodeStatusResponse, err = apinode.NodeStatus([]string{})
+	// health reports of the nodes are shown in additional columns
+	var health map[string]*nodehealth.Health
+	if showHealth() {
+		health, err = apinode.NodeHealth()
 		if err != nil {
-			return err
+			wwlog.Warn("Could not read node health: %s", err)
 		}
+	}
+	if health == nil {
+		health = make(map[string]*nodehealth.Health)
+	}
 
-		if SetWatch {
-			fmt.Print("\033[H\033[2J")
-			_, height, err = term.GetSize(0)
-			if err != nil {
-				wwlog.Warn("Could not get terminal height, using 24")
-				height = 24
-			}
+	if !SetWatch {
+		printStatus(controller, nodeStatusResponse.NodeStatus, args, 0, health, pendingBootOnce())
+		return nil
+	}
+
+	statuses := make(map[string]*wwapiv1.NodeStatus)
+	for _, s := range nodeStatusResponse.NodeStatus {
+		statuses[s.NodeName] = s
+	}
+
+	// status updates carry the last health report of the node
+	type statusEvent struct {
+		status *wwapiv1.NodeStatus
+		health *nodehealth.Health
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := make(chan statusEvent, 1024)
+	streamErr := make(chan error, 1)
+	go func() {
+		streamErr <- apinode.NodeStatusHealthWatch(ctx, args, func(s *wwapiv1.NodeStatus, h *nodehealth.Health) error {
+			events <- statusEvent{s, h}
+			return nil
+		})
+	}()
+	streaming := true
+	update := func(e statusEvent) {
+		statuses[e.status.NodeName] = e.status
+		if e.health != nil {
+			health[e.status.NodeName] = e.health
 		}
+	}
 
-		fmt.Printf("%-20s %-20s %-25s %-10s\n", "NODENAME", "STAGE", "SENT", "LASTSEEN (s)")
-		fmt.Printf("%s\n", strings.Repeat("=", 80))
+	for {
+		var height int
+		fmt.Print("\033[H\033[2J")
+		_, height, err = term.GetSize(0)
+		if err != nil {
+			wwlog.Warn("Could not get terminal height, using 24")
+			height = 24
+		}
+		list := make([]*wwapiv1.NodeStatus, 0, len(statuses))
+		for _, s := range statuses {
+			list = append(list, s)
+		}
+		// overrides are used up by warewulfd, so they are read on every
+		// redraw
+		printStatus(controller, list, args, height, health, pendingBootOnce())
 
-		wwlog.Verbose("Building sort index")
-		var statuses []*wwapiv1.NodeStatus
-		if len(args) > 0 {
-			nodeList := hostlist.Expand(args)
-			for i := 0; i < len(nodeStatusResponse.NodeStatus); i++ {
-				for j := 0; j < len(nodeList); j++ {
-					if nodeStatusResponse.NodeStatus[i].NodeName == nodeList[j] {
-						statuses = append(statuses, nodeStatusResponse.NodeStatus[i])
-						break
-					}
+		if streaming {
+			select {
+			case e := <-events:
+				update(e)
+			case err = <-streamErr:
+				wwlog.Warn("Status stream unavailable, polling instead: %s", err)
+				streaming = false
+			case <-time.After(watchRefresh):
+			}
+			// Limit the redraws to the update frequency and apply all
+			// updates received in the meantime.
+			time.Sleep(time.Duration(SetUpdate) * time.Millisecond)
+		drain:
+			for {
+				select {
+				case e := <-events:
+					update(e)
+				default:
+					break drain
 				}
 			}
 		} else {
-			for i := 0; i < len(nodeStatusResponse.NodeStatus); i++ {
-				statuses = append(statuses, nodeStatusResponse.NodeStatus[i])
+			time.Sleep(time.Duration(SetUpdate) * time.Millisecond)
+			nodeStatusResponse, err = apinode.NodeStatus([]string{})
+			if err != nil {
+				return err
 			}
-		}
-
-		wwlog.Verbose("Sorting index")
-		if SetSortLast {
-			sort.Slice(statuses, func(i, j int) bool {
-				if statuses[i].Lastseen > statuses[j].Lastseen {
-					return true
-				} else if statuses[i].Lastseen < statuses[j].Lastseen {
-					return false
+			statuses = make(map[string]*wwapiv1.NodeStatus)
+			for _, s := range nodeStatusResponse.NodeStatus {
+				statuses[s.NodeName] = s
+			}
+			if showHealth() {
+				if polled, err := apinode.NodeHealth(); err != nil {
+					wwlog.Warn("Could not read node health: %s", err)
 				} else {
-					return statuses[i].NodeName < statuses[j].NodeName
+					health = polled
 				}
-			})
-		} else if SetSortReverse {
-			wwlog.Verbose("Reversing sort order")
-			sort.Slice(statuses, func(i, j int) bool {
-				return statuses[i].NodeName > statuses[j].NodeName
-			})
+			}
+		}
+	}
+}
 
-		} else {
-			sort.Slice(statuses, func(i, j int) bool {
-				return statuses[i].NodeName < statuses[j].NodeName
-			})
+/*
+Returns the pending one-shot boot overrides, which are shown in an
+additional column
+*/
+func pendingBootOnce() map[string]bootonce.Override {
+	pending, err := bootonce.List()
+	if err != nil {
+		wwlog.Warn("Could not read boot overrides: %s", err)
+	}
+	return pending
+}
+
+// whether the health columns are shown
+func showHealth() bool {
+	return SetHealth || SetFailedUnits || SetKernelMismatch || SetFailedHooks
+}
+
+/*
+Prints the status of the nodes matching args with their health reports
+and pending boot overrides. If height is not zero the output is cut off
+to fit a terminal of that height.
+*/
+func printStatus(controller *warewulfconf.WarewulfYaml, nodeStatus []*wwapiv1.NodeStatus, args []string, height int, health map[string]*nodehealth.Health, pending map[string]bootonce.Override) {
+	var elipsis bool
+	var count int
+	rightnow := time.Now().Unix()
+
+	header := fmt.Sprintf("%-20s %-20s %-25s %-12s", "NODENAME", "STAGE", "SENT", "LASTSEEN (s)")
+	width := 80
+	if showHealth() {
+		header += fmt.Sprintf(" %-30s %-16s %-12s %s", "KERNEL", "LOAD", "UPTIME", "FAILED UNITS")
+		width += 80
+		if SetFailedHooks {
+			header = fmt.Sprintf("%s%*s FAILED HOOKS", header, 30-len("FAILED UNITS"), "")
+			width += 30
 		}
+	}
+	if len(pending) > 0 {
+		header += " BOOT ONCE"
+		width += 20
+	}
+	fmt.Printf("%s\n", header)
+	fmt.Printf("%s\n", strings.Repeat("=", width))
 
-		wwlog.Verbose("Printing results")
-		for i := 0; i < len(statuses); i++ {
-			o := statuses[i]
-			if SetTime > 0 && o.Lastseen < SetTime {
-				continue
+	wwlog.Verbose("Building sort index")
+	var statuses []*wwapiv1.NodeStatus
+	if len(args) > 0 {
+		nodeList := hostlist.Expand(args)
+		for i := 0; i < len(nodeStatus); i++ {
+			for j := 0; j < len(nodeList); j++ {
+				if nodeStatus[i].NodeName == nodeList[j] {
+					statuses = append(statuses, nodeStatus[i])
+					break
+				}
 			}
+		}
+	} else {
+		statuses = append(statuses, nodeStatus...)
+	}
 
-			if o.Lastseen > 0 {
-				if SetUnknown {
-					continue
-				}
-				if rightnow-o.Lastseen >= int64(controller.Warewulf.UpdateInterval*2) {
-					color.Red("%-20s %-20s %-25s %-10d\n", o.NodeName, o.Stage, o.Sent, rightnow-o.Lastseen)
-				} else if rightnow-o.Lastseen >= int64(controller.Warewulf.UpdateInterval+5) {
-					color.Yellow("%-20s %-20s %-25s %-10d\n", o.NodeName, o.Stage, o.Sent, rightnow-o.Lastseen)
-				} else {
-					fmt.Printf("%-20s %-20s %-25s %-10d\n", o.NodeName, o.Stage, o.Sent, rightnow-o.Lastseen)
-				}
+	wwlog.Verbose("Sorting index")
+	if SetSortLast {
+		sort.Slice(statuses, func(i, j int) bool {
+			if statuses[i].Lastseen > statuses[j].Lastseen {
+				return true
+			} else if statuses[i].Lastseen < statuses[j].Lastseen {
+				return false
 			} else {
-				color.HiBlack("%-20s %-20s %-25s %-10s\n", o.NodeName, "--", "--", "--")
+				return statuses[i].NodeName < statuses[j].NodeName
 			}
-			if count+4 >= height && SetWatch {
-				if count+1 != len(statuses) {
-					elipsis = true
-				}
-				break
+		})
+	} else if SetSortReverse {
+		wwlog.Verbose("Reversing sort order")
+		sort.Slice(statuses, func(i, j int) bool {
+			return statuses[i].NodeName > statuses[j].NodeName
+		})
+
+	} else {
+		sort.Slice(statuses, func(i, j int) bool {
+			return statuses[i].NodeName < statuses[j].NodeName
+		})
+	}
+
+	wwlog.Verbose("Printing results")
+	for i := 0; i < len(statuses); i++ {
+		o := statuses[i]
+		if SetTime > 0 && o.Lastseen < SetTime {
+			continue
+		}
+		h := health[o.NodeName]
+		if SetFailedUnits && (h == nil || len(h.FailedUnits) == 0) {
+			continue
+		}
+		if SetKernelMismatch && (h == nil || !h.KernelMismatch()) {
+			continue
+		}
+		if SetFailedHooks && (h == nil || len(h.FailedHooks()) == 0) {
+			continue
+		}
+
+		var columns string
+		if showHealth() {
+			columns += " " + healthColumns(h, rightnow, SetFailedHooks)
+		}
+		if len(pending) > 0 {
+			override := "--"
+			if p, ok := pending[o.NodeName]; ok {
+				override = p.String()
 			}
-			count++
+			columns += " " + override
 		}
 
-		if SetWatch {
-			if elipsis {
-				fmt.Printf("... ")
+		if o.Lastseen > 0 {
+			if SetUnknown {
+				continue
+			}
+			line := strings.TrimRight(fmt.Sprintf("%-20s %-20s %-25s %-12d", o.NodeName, o.Stage, o.Sent, rightnow-o.Lastseen)+columns, " ")
+			if rightnow-o.Lastseen >= int64(controller.Warewulf.UpdateInterval*2) {
+				color.Red("%s\n", line)
+			} else if rightnow-o.Lastseen >= int64(controller.Warewulf.UpdateInterval+5) {
+				color.Yellow("%s\n", line)
+			} else {
+				fmt.Printf("%s\n", line)
 			}
-			time.Sleep(time.Duration(SetUpdate) * time.Millisecond)
 		} else {
+			color.HiBlack("%s\n", strings.TrimRight(fmt.Sprintf("%-20s %-20s %-25s %-12s", o.NodeName, "--", "--", "--")+columns, " "))
+		}
+		if height > 0 && count+4 >= height {
+			if count+1 != len(statuses) {
+				elipsis = true
+			}
 			break
 		}
+		count++
+	}
+
+	if elipsis {
+		fmt.Printf("... ")
+	}
+}
+
+/*
+Returns the health columns of a node, with a column of the failed
+post-update hooks if hooks is set. A kernel which differs from the kernel
+configured for the node is marked with the expected version.
+*/
+func healthColumns(h *nodehealth.Health, rightnow int64, hooks bool) string {
+	if h == nil {
+		if hooks {
+			return fmt.Sprintf("%-30s %-16s %-12s %-30s %s", "--", "--", "--", "--", "--")
+		}
+		return fmt.Sprintf("%-30s %-16s %-12s %s", "--", "--", "--", "--")
+	}
+	kernel := h.Kernel
+	if h.KernelMismatch() {
+		kernel = fmt.Sprintf("%s (!= %s)", h.Kernel, h.ExpectedKernel)
+	}
+	load := fmt.Sprintf("%.2f %.2f %.2f", h.Load[0], h.Load[1], h.Load[2])
+	// the uptime as of now rather than as of the report
+	uptime := time.Duration(h.Uptime+rightnow-h.Received) * time.Second
+	failed := "--"
+	if len(h.FailedUnits) > 0 {
+		failed = strings.Join(h.FailedUnits, ",")
+	}
+	if hooks {
+		failedHooks := "--"
+		if names := h.FailedHooks(); len(names) > 0 {
+			failedHooks = strings.Join(names, ",")
+		}
+		return fmt.Sprintf("%-30s %-16s %-12s %-30s %s", kernel, load, uptime.String(), failed, failedHooks)
+	}
+	return fmt.Sprintf("%-30s %-16s %-12s %s", kernel, load, uptime.String(), failed)
+}
+
+/*
+Prints the provisioning requests recorded by warewulfd for the given
+nodes.
+*/
+func printHistory(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("--history requires at least one node name")
+	}
+	for i, nodeName := range hostlist.Expand(args) {
+		events, err := apinode.NodeStatusHistory(nodeName)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("%-20s %-20s %-20s %-25s %-12s %-6s %-16s %-10s\n",
+			"NODENAME", "TIME", "STAGE", "SENT", "BYTES", "STATUS", "IPADDR", "DURATION (s)")
+		fmt.Printf("%s\n", strings.Repeat("=", 140))
+		for _, e := range events {
+			line := fmt.Sprintf("%-20s %-20s %-20s %-25s %-12d %-6d %-16s %-10.3f",
+				nodeName, time.Unix(e.Time, 0).Format(time.DateTime), e.Stage, e.Sent, e.Bytes, e.Status, e.Ipaddr, e.Duration)
+			if e.Status >= 400 {
+				color.Red("%s\n", line)
+			} else {
+				fmt.Println(line)
+			}
+		}
 	}
-	return
+	return nil
 }
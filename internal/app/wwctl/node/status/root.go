@@ -14,12 +14,17 @@ var (
 		RunE:                  CobraRunE,
 		ValidArgsFunction:     completions.Nodes,
 	}
-	SetWatch       bool
-	SetUpdate      int
-	SetTime        int64
-	SetSortLast    bool
-	SetSortReverse bool
-	SetUnknown     bool
+	SetWatch          bool
+	SetUpdate         int
+	SetTime           int64
+	SetSortLast       bool
+	SetSortReverse    bool
+	SetUnknown        bool
+	SetHistory        bool
+	SetHealth         bool
+	SetFailedUnits    bool
+	SetKernelMismatch bool
+	SetFailedHooks    bool
 )
 
 func init() {
@@ -29,6 +34,11 @@ func init() {
 	baseCmd.PersistentFlags().BoolVarP(&SetSortLast, "last", "l", false, "Sort by the last check-in time")
 	baseCmd.PersistentFlags().BoolVarP(&SetSortReverse, "reverse", "r", false, "Reverse the sort order")
 	baseCmd.PersistentFlags().BoolVarP(&SetUnknown, "unknown", "u", false, "Only show nodes of unknown status")
+	baseCmd.PersistentFlags().BoolVar(&SetHistory, "history", false, "Show the recent provisioning requests of the given nodes")
+	baseCmd.PersistentFlags().BoolVar(&SetHealth, "health", false, "Show the health reported by wwclient")
+	baseCmd.PersistentFlags().BoolVar(&SetFailedUnits, "failed-units", false, "Only show nodes with failed systemd units")
+	baseCmd.PersistentFlags().BoolVar(&SetKernelMismatch, "kernel-mismatch", false, "Only show nodes running another kernel than configured")
+	baseCmd.PersistentFlags().BoolVar(&SetFailedHooks, "failed-hooks", false, "Only show nodes with failed post-update hooks")
 }
 
 // GetRootCommand returns the root cobra.Command for the application.
@@ -0,0 +1,49 @@
+package list
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/warewulf/warewulf/internal/app/wwctl/table"
+	"github.com/warewulf/warewulf/internal/pkg/hostlist"
+	"github.com/warewulf/warewulf/internal/pkg/node"
+	"github.com/warewulf/warewulf/internal/pkg/nodetoken"
+)
+
+func CobraRunE(cmd *cobra.Command, args []string) error {
+	nodeDB, err := node.New()
+	if err != nil {
+		return fmt.Errorf("failed to open node database: %w", err)
+	}
+	nodes, err := nodeDB.FindAllNodes()
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		nodes = node.FilterNodeListByName(nodes, hostlist.Expand(args))
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].Id() < nodes[j].Id()
+	})
+	tokens, err := nodetoken.List()
+	if err != nil {
+		return err
+	}
+
+	t := table.New(cmd.OutOrStdout())
+	t.AddHeader("NODE", "CREATED", "ROTATION PENDING")
+	for _, n := range nodes {
+		created := "--"
+		pending := "--"
+		if token, ok := tokens[n.Id()]; ok {
+			created = time.Unix(token.Created, 0).Format(time.DateTime)
+			pending = fmt.Sprint(token.Previous != "")
+		}
+		t.AddLine(table.Prep([]string{n.Id(), created, pending})...)
+	}
+	t.Print()
+	return nil
+}
@@ -0,0 +1,21 @@
+package list
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/warewulf/warewulf/internal/app/wwctl/completions"
+)
+
+// GetRootCommand returns the root cobra.Command for the application.
+func GetCommand() *cobra.Command {
+	baseCmd := &cobra.Command{
+		DisableFlagsInUseLine: true,
+		Use:                   "list [PATTERN]",
+		Short:                 "List the tokens of nodes",
+		Long: "This command lists when the tokens of nodes were created and whether a\n" +
+			"rotation is pending, i.e. the previous token of a node is still valid.",
+		RunE:              CobraRunE,
+		Aliases:           []string{"ls"},
+		ValidArgsFunction: completions.Nodes,
+	}
+	return baseCmd
+}
@@ -0,0 +1,26 @@
+package token
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/warewulf/warewulf/internal/app/wwctl/node/token/list"
+	"github.com/warewulf/warewulf/internal/app/wwctl/node/token/rotate"
+)
+
+var baseCmd = &cobra.Command{
+	DisableFlagsInUseLine: true,
+	Use:                   "token COMMAND [OPTIONS]",
+	Short:                 "Manage the secret tokens of nodes",
+	Long: "With warewulf.conf:warewulf.node tokens, nodes sign their requests for the\n" +
+		"runtime overlay and overlay files with a secret token, which is delivered in\n" +
+		"their system overlay. These commands list and rotate the tokens.",
+}
+
+func init() {
+	baseCmd.AddCommand(list.GetCommand())
+	baseCmd.AddCommand(rotate.GetCommand())
+}
+
+// GetRootCommand returns the root cobra.Command for the application.
+func GetCommand() *cobra.Command {
+	return baseCmd
+}
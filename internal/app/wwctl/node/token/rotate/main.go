@@ -0,0 +1,52 @@
+package rotate
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/warewulf/warewulf/internal/pkg/hostlist"
+	"github.com/warewulf/warewulf/internal/pkg/node"
+	"github.com/warewulf/warewulf/internal/pkg/nodetoken"
+	"github.com/warewulf/warewulf/internal/pkg/overlay"
+	"github.com/warewulf/warewulf/internal/pkg/wwlog"
+)
+
+var buildOverlay = overlay.BuildOverlay
+
+func CobraRunE(vars *variables) func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		nodeDB, err := node.New()
+		if err != nil {
+			return fmt.Errorf("failed to open node database: %w", err)
+		}
+		allNodes, err := nodeDB.FindAllNodes()
+		if err != nil {
+			return err
+		}
+		nodeNames := hostlist.Expand(args)
+		nodes := node.FilterNodeListByName(allNodes, nodeNames)
+		if len(nodes) != len(nodeNames) {
+			for _, nodeName := range nodeNames {
+				if _, err := nodeDB.GetNode(nodeName); err != nil {
+					return fmt.Errorf("invalid node: %s", nodeName)
+				}
+			}
+		}
+
+		for _, n := range nodes {
+			if err := nodetoken.Rotate(n.Id(), vars.revoke); err != nil {
+				return err
+			}
+			if err := buildOverlay(n, allNodes, "system", n.SystemOverlay); err != nil {
+				return fmt.Errorf("could not build system overlays of node %s: %w", n.Id(), err)
+			}
+		}
+		if vars.revoke {
+			wwlog.Info("Rotated and revoked the tokens of %d node(s)", len(nodes))
+		} else {
+			wwlog.Info("Rotated the tokens of %d node(s), the new tokens are used after the next boot", len(nodes))
+		}
+		return nil
+	}
+}
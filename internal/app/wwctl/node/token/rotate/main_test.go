@@ -0,0 +1,60 @@
+package rotate
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/warewulf/warewulf/internal/pkg/node"
+	"github.com/warewulf/warewulf/internal/pkg/nodetoken"
+	"github.com/warewulf/warewulf/internal/pkg/testenv"
+)
+
+func Test_Rotate(t *testing.T) {
+	env := testenv.New(t)
+	defer env.RemoveAll()
+	env.WriteFile("etc/warewulf/nodes.conf", `nodes:
+  n1:
+    system overlay:
+    - wwinit
+  n2: {}`)
+
+	var built []string
+	origBuildOverlay := buildOverlay
+	buildOverlay = func(n node.Node, allNodes []node.Node, context string, overlayNames []string) error {
+		assert.Equal(t, "system", context)
+		built = append(built, n.Id())
+		return nil
+	}
+	defer func() {
+		buildOverlay = origBuildOverlay
+	}()
+
+	run := func(args ...string) error {
+		baseCmd := GetCommand()
+		baseCmd.SetArgs(args)
+		buf := new(bytes.Buffer)
+		baseCmd.SetOut(buf)
+		baseCmd.SetErr(buf)
+		return baseCmd.Execute()
+	}
+
+	old, err := nodetoken.Get("n1")
+	require.NoError(t, err)
+	require.NoError(t, run("n[1-2]"))
+	assert.ElementsMatch(t, []string{"n1", "n2"}, built)
+	tokens, err := nodetoken.List()
+	require.NoError(t, err)
+	assert.NotEqual(t, old, tokens["n1"].Secret)
+	assert.Equal(t, old, tokens["n1"].Previous)
+	assert.Empty(t, tokens["n2"].Previous)
+
+	require.NoError(t, run("--revoke", "n1"))
+	tokens, err = nodetoken.List()
+	require.NoError(t, err)
+	assert.Empty(t, tokens["n1"].Previous)
+
+	assert.Error(t, run("n3"), "unknown node")
+}
@@ -0,0 +1,29 @@
+package rotate
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/warewulf/warewulf/internal/app/wwctl/completions"
+)
+
+type variables struct {
+	revoke bool
+}
+
+// GetRootCommand returns the root cobra.Command for the application.
+func GetCommand() *cobra.Command {
+	vars := variables{}
+	baseCmd := &cobra.Command{
+		DisableFlagsInUseLine: true,
+		Use:                   "rotate [OPTIONS] PATTERN",
+		Short:                 "Rotate the tokens of nodes",
+		Long: "This command replaces the tokens of nodes matching PATTERN and rebuilds their\n" +
+			"system overlays, which deliver the new token at the next boot. Until a node\n" +
+			"signs a request with its new token, the previous token stays valid, unless\n" +
+			"it is revoked with --revoke.",
+		Args:              cobra.MinimumNArgs(1),
+		RunE:              CobraRunE(&vars),
+		ValidArgsFunction: completions.Nodes,
+	}
+	baseCmd.PersistentFlags().BoolVar(&vars.revoke, "revoke", false, "Invalidate the previous token immediately")
+	return baseCmd
+}
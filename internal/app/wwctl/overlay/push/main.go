@@ -0,0 +1,42 @@
+package push
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/spf13/cobra"
+	apinode "github.com/warewulf/warewulf/internal/pkg/api/node"
+	"github.com/warewulf/warewulf/internal/pkg/warewulfd"
+)
+
+func CobraRunE(cmd *cobra.Command, args []string) error {
+	if Timeout <= 0 {
+		return fmt.Errorf("timeout must be positive: %d", Timeout)
+	}
+	results, err := apinode.NodeOverlayPush(args, Timeout)
+	if err != nil {
+		return err
+	}
+	failed := printResults(cmd.OutOrStdout(), results)
+	if failed > 0 {
+		return fmt.Errorf("runtime overlay not updated on %d of %d nodes", failed, len(results))
+	}
+	return nil
+}
+
+/*
+Prints the outcome for each node and returns the number of nodes which
+were not updated
+*/
+func printResults(w io.Writer, results []warewulfd.PushResult) (failed int) {
+	fmt.Fprintf(w, "%-20s %-15s %s\n", "NODENAME", "STATUS", "ERROR")
+	fmt.Fprintln(w, strings.Repeat("=", 60))
+	for _, result := range results {
+		fmt.Fprintf(w, "%-20s %-15s %s\n", result.Node, result.Status, result.Error)
+		if result.Status != warewulfd.PushUpdated {
+			failed++
+		}
+	}
+	return failed
+}
@@ -0,0 +1,30 @@
+package push
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/warewulf/warewulf/internal/app/wwctl/completions"
+)
+
+var (
+	baseCmd = &cobra.Command{
+		DisableFlagsInUseLine: true,
+		Use:                   "push [OPTIONS] NODENAME...",
+		Short:                 "Push runtime overlay updates to nodes",
+		Long: `This command tells wwclient on the given nodes to update the runtime
+overlay immediately and reports whether the update succeeded on each node.
+It requires warewulfd and wwclient:notify.`,
+		Args:              cobra.MinimumNArgs(1),
+		RunE:              CobraRunE,
+		ValidArgsFunction: completions.Nodes,
+	}
+	Timeout int
+)
+
+func init() {
+	baseCmd.PersistentFlags().IntVar(&Timeout, "timeout", 60, "Seconds to wait for the nodes to report back")
+}
+
+// GetRootCommand returns the root cobra.Command for the application.
+func GetCommand() *cobra.Command {
+	return baseCmd
+}
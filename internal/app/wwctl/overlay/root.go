@@ -11,6 +11,7 @@ import (
 	"github.com/warewulf/warewulf/internal/app/wwctl/overlay/imprt"
 	"github.com/warewulf/warewulf/internal/app/wwctl/overlay/list"
 	"github.com/warewulf/warewulf/internal/app/wwctl/overlay/mkdir"
+	"github.com/warewulf/warewulf/internal/app/wwctl/overlay/push"
 	"github.com/warewulf/warewulf/internal/app/wwctl/overlay/show"
 )
 
@@ -34,6 +35,7 @@ func init() {
 	baseCmd.AddCommand(imprt.GetCommand())
 	baseCmd.AddCommand(chmod.GetCommand())
 	baseCmd.AddCommand(chown.GetCommand())
+	baseCmd.AddCommand(push.GetCommand())
 }
 
 // GetRootCommand returns the root cobra.Command for the application.
@@ -16,6 +16,12 @@ func CobraRunE(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("can't delete the `default` profile ")
 	}
 
+	lock, err := node.Lock()
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
 	nodeDB, err := node.New()
 	if err != nil {
 		return fmt.Errorf("failed to open node database: %s", err)
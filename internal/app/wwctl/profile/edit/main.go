@@ -97,11 +97,13 @@ func CobraRunE(cmd *cobra.Command, args []string) error {
 				}
 			}
 
+			// changed profiles by name, nil for deleted profiles
+			changes := make(map[string]*node.Profile)
 			var added, deleted, updated int
 			for profileID := range origProfiles {
 				if editProfile, ok := editProfiles[profileID]; !ok || editProfile == nil {
 					wwlog.Verbose("delete profile: %s", profileID)
-					delete(registry.NodeProfiles, profileID)
+					changes[profileID] = nil
 					deleted += 1
 				}
 			}
@@ -109,18 +111,18 @@ func CobraRunE(cmd *cobra.Command, args []string) error {
 				if _, ok := origProfiles[profileID]; !ok {
 					wwlog.Verbose("add profile: %s", profileID)
 					added += 1
-					registry.NodeProfiles[profileID] = editProfiles[profileID]
+					changes[profileID] = editProfiles[profileID]
 				} else if equalYaml, err := util.EqualYaml(origProfiles[profileID], editProfiles[profileID]); err != nil {
 					return err
 				} else if !equalYaml {
 					wwlog.Verbose("update profile: %s", profileID)
 					updated += 1
-					registry.NodeProfiles[profileID] = editProfiles[profileID]
+					changes[profileID] = editProfiles[profileID]
 				}
 			}
 
 			if util.Confirm(fmt.Sprintf("Are you sure you want to add %d, delete %d, and update %d profiles", added, deleted, updated)) {
-				if err := registry.Persist(); err != nil {
+				if err := persistChanges(origProfiles, changes); err != nil {
 					return err
 				}
 
@@ -137,3 +139,35 @@ func CobraRunE(cmd *cobra.Command, args []string) error {
 
 	return nil
 }
+
+/*
+Applies the changes, with nil deleting a profile, to the current node
+configuration while holding its lock, so that the lock isn't held while
+editing. Profiles which were changed by someone else meanwhile are not
+overwritten.
+*/
+func persistChanges(origProfiles map[string]*node.Profile, changes map[string]*node.Profile) error {
+	lock, err := node.Lock()
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	registry, err := node.New()
+	if err != nil {
+		return err
+	}
+	for profileID, changed := range changes {
+		if equal, err := util.EqualYaml(origProfiles[profileID], registry.NodeProfiles[profileID]); err != nil {
+			return err
+		} else if !equal {
+			return fmt.Errorf("profile %s was changed while editing, not saving any changes", profileID)
+		}
+		if changed == nil {
+			delete(registry.NodeProfiles, profileID)
+		} else {
+			registry.NodeProfiles[profileID] = changed
+		}
+	}
+	return registry.Persist()
+}
@@ -159,6 +159,7 @@ nodes:
     "ClusterName": "",
     "ImageName": "",
     "Ipxe": "",
+    "UUIDBinding": "",
     "RuntimeOverlay": null,
     "SystemOverlay": null,
     "Kernel": null,
@@ -211,6 +212,7 @@ nodes:
     "ClusterName": "",
     "ImageName": "",
     "Ipxe": "",
+    "UUIDBinding": "",
     "RuntimeOverlay": null,
     "SystemOverlay": null,
     "Kernel": null,
@@ -230,6 +232,7 @@ nodes:
     "ClusterName": "",
     "ImageName": "",
     "Ipxe": "",
+    "UUIDBinding": "",
     "RuntimeOverlay": null,
     "SystemOverlay": null,
     "Kernel": null,
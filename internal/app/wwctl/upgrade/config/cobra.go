@@ -40,6 +40,13 @@ func UpgradeNodesConf(cmd *cobra.Command, args []string) error {
 	if outputPath == "" {
 		outputPath = config.ConfigFile
 	}
+	if outputPath != "-" {
+		lock, err := config.Lock(outputPath)
+		if err != nil {
+			return err
+		}
+		defer lock.Unlock()
+	}
 	data, err := os.ReadFile(inputPath)
 	if err != nil {
 		return err
@@ -7,6 +7,7 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/warewulf/warewulf/internal/app/wwctl/completions"
+	"github.com/warewulf/warewulf/internal/pkg/conffile"
 	"github.com/warewulf/warewulf/internal/pkg/config"
 	"github.com/warewulf/warewulf/internal/pkg/upgrade"
 	"github.com/warewulf/warewulf/internal/pkg/util"
@@ -57,6 +58,13 @@ func UpgradeNodesConf(cmd *cobra.Command, args []string) error {
 	if inputConfPath == "" {
 		inputConfPath = config.ConfigFile
 	}
+	if outputPath != "-" {
+		lock, err := conffile.Lock(outputPath, conffile.LockTimeout)
+		if err != nil {
+			return err
+		}
+		defer lock.Unlock()
+	}
 
 	confData, err := os.ReadFile(inputConfPath)
 	if err != nil {
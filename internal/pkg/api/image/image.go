@@ -10,6 +10,7 @@ import (
 
 	"github.com/containers/image/v5/types"
 	"github.com/warewulf/warewulf/internal/pkg/api/routes/wwapiv1"
+	warewulfconf "github.com/warewulf/warewulf/internal/pkg/config"
 	"github.com/warewulf/warewulf/internal/pkg/image"
 	"github.com/warewulf/warewulf/internal/pkg/kernel"
 	"github.com/warewulf/warewulf/internal/pkg/node"
@@ -265,10 +266,8 @@ func ImageList() (imageInfo []*wwapiv1.ImageInfo, err error) {
 		if imgF, err := os.Stat(image.ImageFile(source)); err == nil {
 			imgSize = int(imgF.Size())
 		}
-		imgCSize := 0
-		if imgFC, err := os.Stat(image.ImageFile(source) + ".gz"); err == nil {
-			imgCSize = int(imgFC.Size())
-		}
+		// the size of the variant in the configured compression format
+		imgCSize := image.CompressedSizes(source)[warewulfconf.Get().Warewulf.CompressionFormat()]
 		imageInfo = append(imageInfo, &wwapiv1.ImageInfo{
 			Name:          source,
 			NodeCount:     uint32(nodemap[source]),
@@ -350,6 +349,11 @@ func ImageRename(crp *wwapiv1.ImageRenameParameter) (err error) {
 	}
 
 	// update the nodes profiles image name
+	lock, err := node.Lock()
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
 	nodeDB, err := node.New()
 	if err != nil {
 		return err
@@ -21,6 +21,12 @@ func NodeAdd(nap *wwapiv1.NodeAddParameter) (err error) {
 		return fmt.Errorf("NodeAddParameter is nil")
 	}
 
+	lock, err := node.Lock()
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
 	nodeDB, err := node.New()
 	if err != nil {
 		return fmt.Errorf("failed to open node database: %w", err)
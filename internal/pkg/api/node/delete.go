@@ -15,6 +15,12 @@ import (
 // NodeDelete adds nodes for management by Warewulf.
 func NodeDelete(ndp *wwapiv1.NodeDeleteParameter) (err error) {
 
+	lock, err := node.Lock()
+	if err != nil {
+		return
+	}
+	defer lock.Unlock()
+
 	var nodeList []node.Node
 	nodeList, err = NodeDeleteParameterCheck(ndp, false)
 	if err != nil {
@@ -0,0 +1,191 @@
+package apinode
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+
+	warewulfconf "github.com/warewulf/warewulf/internal/pkg/config"
+	"github.com/warewulf/warewulf/internal/pkg/node"
+	"github.com/warewulf/warewulf/internal/pkg/warewulfd"
+	"github.com/warewulf/warewulf/internal/pkg/wwlog"
+)
+
+// DiscoveredNode is an unknown node in the discovery queue of warewulfd.
+type DiscoveredNode struct {
+	Hwaddr    string `json:"hwaddr"`
+	Ipaddr    string `json:"ipaddr"`
+	FirstSeen int64  `json:"first seen"`
+	LastSeen  int64  `json:"last seen"`
+	AssetKey  string `json:"asset key,omitempty"`
+	UUID      string `json:"uuid,omitempty"`
+}
+
+// DiscoverOrders are the orders in which queued nodes can be assigned.
+var DiscoverOrders = []string{"first-seen", "last-seen", "hwaddr", "ipaddr"}
+
+// NodeDiscoverList returns the unknown nodes in the discovery queue of
+// warewulfd, in the order in which they were first seen.
+// This requires warewulfd.
+func NodeDiscoverList() (nodes []DiscoveredNode, err error) {
+	type discoveryStatus struct {
+		Nodes []DiscoveredNode `json:"nodes"`
+	}
+
+	controller := warewulfconf.Get()
+
+	if controller.Ipaddr == "" {
+		return nodes, fmt.Errorf("the Warewulf Server IP Address is not properly configured")
+	}
+
+	discoveryURL := fmt.Sprintf("http://%s:%d/discovery", controller.Ipaddr, controller.Warewulf.Port)
+	wwlog.Verbose("Connecting to: %s", discoveryURL)
+
+	resp, err := http.Get(discoveryURL)
+	if err != nil {
+		return nodes, fmt.Errorf("could not connect to Warewulf server: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nodes, fmt.Errorf("could not get discovery queue: %s", resp.Status)
+	}
+
+	var status discoveryStatus
+	err = json.NewDecoder(resp.Body).Decode(&status)
+	if err != nil {
+		return nodes, fmt.Errorf("could not decode JSON: %w", err)
+	}
+	return status.Nodes, nil
+}
+
+// SortDiscovered sorts queued nodes in one of DiscoverOrders.
+func SortDiscovered(nodes []DiscoveredNode, order string) error {
+	var less func(a, b DiscoveredNode) bool
+	switch order {
+	case "first-seen":
+		less = func(a, b DiscoveredNode) bool { return a.FirstSeen < b.FirstSeen }
+	case "last-seen":
+		less = func(a, b DiscoveredNode) bool { return a.LastSeen < b.LastSeen }
+	case "hwaddr":
+		less = func(a, b DiscoveredNode) bool { return a.Hwaddr < b.Hwaddr }
+	case "ipaddr":
+		less = func(a, b DiscoveredNode) bool {
+			return bytes.Compare(net.ParseIP(a.Ipaddr).To16(), net.ParseIP(b.Ipaddr).To16()) < 0
+		}
+	default:
+		return fmt.Errorf("unknown order: %s (valid: %s)", order, strings.Join(DiscoverOrders, ", "))
+	}
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return less(nodes[i], nodes[j])
+	})
+	return nil
+}
+
+// NodeDiscoverApprove sets the hardware address of the discovery
+// interface of each node in assignments, which maps node names to
+// hardware addresses, and persists the node configuration.
+func NodeDiscoverApprove(assignments map[string]string) (err error) {
+	lock, err := node.Lock()
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	nodeDB, err := node.New()
+	if err != nil {
+		return fmt.Errorf("failed to open node database: %w", err)
+	}
+	if err = DiscoverApproveCheck(&nodeDB, assignments); err != nil {
+		return err
+	}
+	if err = nodeDB.Persist(); err != nil {
+		return fmt.Errorf("failed to persist nodedb: %w", err)
+	}
+	if err = warewulfd.DaemonReload(); err != nil {
+		return fmt.Errorf("failed to reload warewulf daemon: %w", err)
+	}
+	return nil
+}
+
+// DiscoverApproveCheck applies assignments to nodeDB without persisting
+// it. The hardware address is set on the primary network device of a
+// node, or on its first network device without a hardware address.
+func DiscoverApproveCheck(nodeDB *node.NodesYaml, assignments map[string]string) error {
+	nodeNames := make([]string, 0, len(assignments))
+	for nodeName := range assignments {
+		nodeNames = append(nodeNames, nodeName)
+	}
+	sort.Strings(nodeNames)
+	for _, nodeName := range nodeNames {
+		hwaddr := strings.ToLower(assignments[nodeName])
+		if existing, err := nodeDB.FindByHwaddr(hwaddr); err == nil {
+			return fmt.Errorf("%s is already assigned to node %s", hwaddr, existing.Id())
+		} else if err != node.ErrNotFound {
+			return err
+		}
+		merged, err := nodeDB.GetNode(nodeName)
+		if err != nil {
+			return fmt.Errorf("invalid node: %s", nodeName)
+		}
+		netdev := discoveryNetDev(merged)
+		if dev, ok := merged.NetDevs[netdev]; ok && dev.Hwaddr != "" {
+			return fmt.Errorf("node %s already has hardware address %s on %s", nodeName, dev.Hwaddr, netdev)
+		}
+		nodePtr, err := nodeDB.GetNodeOnlyPtr(nodeName)
+		if err != nil {
+			return fmt.Errorf("invalid node: %s", nodeName)
+		}
+		if nodePtr.NetDevs == nil {
+			nodePtr.NetDevs = make(map[string]*node.NetDev)
+		}
+		if _, ok := nodePtr.NetDevs[netdev]; !ok {
+			nodePtr.NetDevs[netdev] = new(node.NetDev)
+		}
+		nodePtr.NetDevs[netdev].Hwaddr = hwaddr
+		nodePtr.Discoverable = "UNDEF"
+		wwlog.Verbose("Assigning %s to node %s (%s)", hwaddr, nodeName, netdev)
+	}
+	return nil
+}
+
+// DiscoverTargets returns the nodes of nodeNames, in the given order,
+// which don't have a hardware address on their discovery interface yet.
+func DiscoverTargets(nodeDB *node.NodesYaml, nodeNames []string) (targets []string) {
+	for _, nodeName := range nodeNames {
+		n, err := nodeDB.GetNode(nodeName)
+		if err != nil {
+			wwlog.Warn("invalid node: %s", nodeName)
+			continue
+		}
+		if dev, ok := n.NetDevs[discoveryNetDev(n)]; ok && dev.Hwaddr != "" {
+			wwlog.Verbose("node %s already has hardware address %s", nodeName, dev.Hwaddr)
+			continue
+		}
+		targets = append(targets, nodeName)
+	}
+	return targets
+}
+
+/*
+Returns the network device of a node which gets the discovered hardware
+address
+*/
+func discoveryNetDev(n node.Node) string {
+	if _, ok := n.NetDevs[n.PrimaryNetDev]; ok {
+		return n.PrimaryNetDev
+	}
+	var netdevs []string
+	for name, dev := range n.NetDevs {
+		if dev.Hwaddr == "" {
+			netdevs = append(netdevs, name)
+		}
+	}
+	sort.Strings(netdevs)
+	if len(netdevs) > 0 {
+		return netdevs[0]
+	}
+	return "default"
+}
@@ -12,6 +12,11 @@ import (
 Add nodes from yaml
 */
 func NodeAddFromYaml(nodeList *wwapiv1.NodeYaml) (err error) {
+	lock, err := node.Lock()
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
 	nodeDB, err := node.New()
 	if err != nil {
 		return fmt.Errorf("could not open NodeDB: %w", err)
@@ -0,0 +1,51 @@
+package apinode
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	warewulfconf "github.com/warewulf/warewulf/internal/pkg/config"
+	"github.com/warewulf/warewulf/internal/pkg/warewulfd"
+	"github.com/warewulf/warewulf/internal/pkg/wwlog"
+)
+
+// NodeOverlayPush tells the wwclients of the nodes to update their runtime
+// overlay immediately and returns the outcome for each node once all
+// nodes reported back or timeout seconds passed.
+// This requires warewulfd.
+func NodeOverlayPush(nodeNames []string, timeout int) (results []warewulfd.PushResult, err error) {
+	controller := warewulfconf.Get()
+
+	if controller.Ipaddr == "" {
+		return results, fmt.Errorf("the Warewulf Server IP Address is not properly configured")
+	}
+
+	query := url.Values{}
+	for _, n := range nodeNames {
+		query.Add("node", n)
+	}
+	query.Set("timeout", strconv.Itoa(timeout))
+	pushURL := fmt.Sprintf("http://%s:%d/push?%s", controller.Ipaddr, controller.Warewulf.Port, query.Encode())
+	wwlog.Verbose("Connecting to: %s", pushURL)
+
+	// warewulfd answers once the nodes reported back
+	client := &http.Client{Timeout: time.Duration(timeout+10) * time.Second}
+	resp, err := client.Post(pushURL, "", nil)
+	if err != nil {
+		return results, fmt.Errorf("could not connect to Warewulf server: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return results, fmt.Errorf("could not push runtime overlay update: %s", resp.Status)
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&results)
+	if err != nil {
+		return results, fmt.Errorf("could not decode JSON: %w", err)
+	}
+	return results, nil
+}
@@ -17,6 +17,11 @@ func NodeSet(set *wwapiv1.ConfSetParameter) (err error) {
 	if set == nil {
 		return fmt.Errorf("NodeSetParameter is nil")
 	}
+	lock, err := node.Lock()
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
 	var nodeDB node.NodesYaml
 	nodeDB, _, err = NodeSetParameterCheck(set)
 	if err != nil {
@@ -1,30 +1,37 @@
 package apinode
 
 import (
+	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strings"
 
 	warewulfconf "github.com/warewulf/warewulf/internal/pkg/config"
 
 	"github.com/warewulf/warewulf/internal/pkg/api/routes/wwapiv1"
 	"github.com/warewulf/warewulf/internal/pkg/hostlist"
+	"github.com/warewulf/warewulf/internal/pkg/nodehealth"
 	"github.com/warewulf/warewulf/internal/pkg/wwlog"
 )
 
+// Local struct for translating json from warewulfd.
+type nodeStatusInternal struct {
+	NodeName string `json:"node name"`
+	Stage    string `json:"stage"`
+	Sent     string `json:"sent"`
+	Ipaddr   string `json:"ipaddr"`
+	Lastseen int64  `json:"last seen"`
+
+	Health *nodehealth.Health `json:"health,omitempty"`
+}
+
 // NodeStatus returns the imaging state for nodes.
 // This requires warewulfd.
 func NodeStatus(nodeNames []string) (nodeStatusResponse *wwapiv1.NodeStatusResponse, err error) {
 
-	// Local structs for translating json from warewulfd.
-	type nodeStatusInternal struct {
-		NodeName string `json:"node name"`
-		Stage    string `json:"stage"`
-		Sent     string `json:"sent"`
-		Ipaddr   string `json:"ipaddr"`
-		Lastseen int64  `json:"last seen"`
-	}
-
 	// all status is a map with one key (nodes)
 	// and maps of [nodeName]NodeStatus underneath.
 	type allStatus struct {
@@ -92,3 +99,163 @@ func NodeStatus(nodeNames []string) (nodeStatusResponse *wwapiv1.NodeStatusRespo
 	}
 	return
 }
+
+// NodeStatusWatch calls fn with the new status of a node each time
+// warewulfd records a status update, until ctx is canceled, the stream
+// ends, or fn returns an error. An empty nodeNames watches all nodes.
+// This requires warewulfd.
+func NodeStatusWatch(ctx context.Context, nodeNames []string, fn func(*wwapiv1.NodeStatus) error) (err error) {
+	return NodeStatusHealthWatch(ctx, nodeNames, func(status *wwapiv1.NodeStatus, _ *nodehealth.Health) error {
+		return fn(status)
+	})
+}
+
+// NodeStatusHealthWatch is like NodeStatusWatch, and also passes the last
+// health report of the node to fn, which is nil if the node sent none.
+// This requires warewulfd.
+func NodeStatusHealthWatch(ctx context.Context, nodeNames []string, fn func(*wwapiv1.NodeStatus, *nodehealth.Health) error) (err error) {
+	controller := warewulfconf.Get()
+
+	if controller.Ipaddr == "" {
+		return fmt.Errorf("the Warewulf Server IP Address is not properly configured")
+	}
+
+	query := url.Values{}
+	for _, n := range nodeNames {
+		query.Add("node", n)
+	}
+	streamURL := fmt.Sprintf("http://%s:%d/status/stream", controller.Ipaddr, controller.Warewulf.Port)
+	if len(query) > 0 {
+		streamURL += "?" + query.Encode()
+	}
+	wwlog.Verbose("Connecting to: %s", streamURL)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, streamURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not connect to Warewulf server: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("could not open status stream: %s", resp.Status)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var status nodeStatusInternal
+		if err := json.Unmarshal([]byte(data), &status); err != nil {
+			return fmt.Errorf("could not decode JSON: %w", err)
+		}
+		err = fn(&wwapiv1.NodeStatus{
+			NodeName: status.NodeName,
+			Stage:    status.Stage,
+			Sent:     status.Sent,
+			Ipaddr:   status.Ipaddr,
+			Lastseen: status.Lastseen,
+		}, status.Health)
+		if err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil && ctx.Err() == nil {
+		return err
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	return fmt.Errorf("status stream closed by Warewulf server")
+}
+
+// NodeStatusEvent is a provisioning request of a node as recorded by
+// warewulfd.
+type NodeStatusEvent struct {
+	Time     int64   `json:"time"`
+	Stage    string  `json:"stage"`
+	Sent     string  `json:"sent"`
+	Bytes    int64   `json:"bytes"`
+	Status   int     `json:"status"`
+	Ipaddr   string  `json:"ipaddr"`
+	Duration float64 `json:"duration"`
+}
+
+// NodeStatusHistory returns the recent provisioning requests of a node,
+// from the oldest to the newest.
+// This requires warewulfd.
+func NodeStatusHistory(nodeName string) (events []NodeStatusEvent, err error) {
+	type nodeHistory struct {
+		NodeName string            `json:"node name"`
+		Events   []NodeStatusEvent `json:"events"`
+	}
+
+	controller := warewulfconf.Get()
+
+	if controller.Ipaddr == "" {
+		return events, fmt.Errorf("the Warewulf Server IP Address is not properly configured")
+	}
+
+	historyURL := fmt.Sprintf("http://%s:%d/status/%s/history", controller.Ipaddr, controller.Warewulf.Port, url.PathEscape(nodeName))
+	wwlog.Verbose("Connecting to: %s", historyURL)
+
+	resp, err := http.Get(historyURL)
+	if err != nil {
+		return events, fmt.Errorf("could not connect to Warewulf server: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return events, fmt.Errorf("no status history for node: %s", nodeName)
+	} else if resp.StatusCode != http.StatusOK {
+		return events, fmt.Errorf("could not get status history of node %s: %s", nodeName, resp.Status)
+	}
+
+	var history nodeHistory
+	err = json.NewDecoder(resp.Body).Decode(&history)
+	if err != nil {
+		return events, fmt.Errorf("could not decode JSON: %w", err)
+	}
+	return history.Events, nil
+}
+
+// NodeHealth returns the last health report of each node which sent
+// one, by node name.
+// This requires warewulfd.
+func NodeHealth() (health map[string]*nodehealth.Health, err error) {
+	type allStatus struct {
+		Nodes map[string]*nodeStatusInternal `json:"nodes"`
+	}
+
+	controller := warewulfconf.Get()
+
+	if controller.Ipaddr == "" {
+		return health, fmt.Errorf("the Warewulf Server IP Address is not properly configured")
+	}
+
+	statusURL := fmt.Sprintf("http://%s:%d/status", controller.Ipaddr, controller.Warewulf.Port)
+	wwlog.Verbose("Connecting to: %s", statusURL)
+
+	resp, err := http.Get(statusURL)
+	if err != nil {
+		return health, fmt.Errorf("could not connect to Warewulf server: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var wwNodeStatus allStatus
+	err = json.NewDecoder(resp.Body).Decode(&wwNodeStatus)
+	if err != nil {
+		return health, fmt.Errorf("could not decode JSON: %w", err)
+	}
+
+	health = make(map[string]*nodehealth.Health)
+	for _, v := range wwNodeStatus.Nodes {
+		if v.Health != nil {
+			health[v.NodeName] = v.Health
+		}
+	}
+	return health, nil
+}
@@ -17,6 +17,11 @@ func ProfileAdd(nsp *wwapiv1.NodeAddParameter) error {
 	if nsp == nil {
 		return fmt.Errorf("NodeAddParameter is nill")
 	}
+	lock, err := node.Lock()
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
 	nodeDB, err := node.New()
 	if err != nil {
 		return fmt.Errorf("could not open database: %w", err)
@@ -18,6 +18,11 @@ func ProfileSet(set *wwapiv1.ConfSetParameter) (err error) {
 	if set == nil {
 		return fmt.Errorf("ProfileAddParameter is nil")
 	}
+	lock, err := node.Lock()
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
 	nodeDB, _, err := ProfileSetParameterCheck(set)
 	if err != nil {
 		return fmt.Errorf("profile set parameters are wrong: %w", err)
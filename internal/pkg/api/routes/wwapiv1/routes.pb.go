@@ -2100,7 +2100,7 @@ var file_routes_proto_rawDesc = string([]byte{
 	0x6e, 0x22, 0x38, 0x0a, 0x0e, 0x43, 0x61, 0x6e, 0x57, 0x72, 0x69, 0x74, 0x65, 0x43, 0x6f, 0x6e,
 	0x66, 0x69, 0x67, 0x12, 0x26, 0x0a, 0x0e, 0x63, 0x61, 0x6e, 0x57, 0x72, 0x69, 0x74, 0x65, 0x43,
 	0x6f, 0x6e, 0x66, 0x69, 0x67, 0x18, 0x01, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0e, 0x63, 0x61, 0x6e,
-	0x57, 0x72, 0x69, 0x74, 0x65, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x32, 0x9e, 0x09, 0x0a, 0x05,
+	0x57, 0x72, 0x69, 0x74, 0x65, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x32, 0xde, 0x09, 0x0a, 0x05,
 	0x57, 0x57, 0x41, 0x70, 0x69, 0x12, 0x63, 0x0a, 0x0a, 0x49, 0x6d, 0x61, 0x67, 0x65, 0x42, 0x75,
 	0x69, 0x6c, 0x64, 0x12, 0x1d, 0x2e, 0x77, 0x77, 0x61, 0x70, 0x69, 0x2e, 0x76, 0x31, 0x2e, 0x49,
 	0x6d, 0x61, 0x67, 0x65, 0x42, 0x75, 0x69, 0x6c, 0x64, 0x50, 0x61, 0x72, 0x61, 0x6d, 0x65, 0x74,
@@ -2169,7 +2169,11 @@ var file_routes_proto_rawDesc = string([]byte{
 	0x65, 0x4e, 0x61, 0x6d, 0x65, 0x73, 0x1a, 0x1c, 0x2e, 0x77, 0x77, 0x61, 0x70, 0x69, 0x2e, 0x76,
 	0x31, 0x2e, 0x4e, 0x6f, 0x64, 0x65, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x52, 0x65, 0x73, 0x70,
 	0x6f, 0x6e, 0x73, 0x65, 0x22, 0x16, 0x82, 0xd3, 0xe4, 0x93, 0x02, 0x10, 0x12, 0x0e, 0x2f, 0x76,
-	0x31, 0x2f, 0x6e, 0x6f, 0x64, 0x65, 0x73, 0x74, 0x61, 0x74, 0x75, 0x73, 0x12, 0x4e, 0x0a, 0x07,
+	0x31, 0x2f, 0x6e, 0x6f, 0x64, 0x65, 0x73, 0x74, 0x61, 0x74, 0x75, 0x73, 0x12, 0x3e, 0x0a, 0x0f,
+	0x4e, 0x6f, 0x64, 0x65, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x57, 0x61, 0x74, 0x63, 0x68, 0x12,
+	0x13, 0x2e, 0x77, 0x77, 0x61, 0x70, 0x69, 0x2e, 0x76, 0x31, 0x2e, 0x4e, 0x6f, 0x64, 0x65, 0x4e,
+	0x61, 0x6d, 0x65, 0x73, 0x1a, 0x14, 0x2e, 0x77, 0x77, 0x61, 0x70, 0x69, 0x2e, 0x76, 0x31, 0x2e,
+	0x4e, 0x6f, 0x64, 0x65, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x30, 0x01, 0x12, 0x4e, 0x0a, 0x07,
 	0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x16, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65,
 	0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x1a,
 	0x19, 0x2e, 0x77, 0x77, 0x61, 0x70, 0x69, 0x2e, 0x76, 0x31, 0x2e, 0x56, 0x65, 0x72, 0x73, 0x69,
@@ -2267,22 +2271,24 @@ var file_routes_proto_depIdxs = []int32{
 	12, // 28: wwapi.v1.WWApi.NodeList:input_type -> wwapi.v1.NodeNames
 	24, // 29: wwapi.v1.WWApi.NodeSet:input_type -> wwapi.v1.ConfSetParameter
 	12, // 30: wwapi.v1.WWApi.NodeStatus:input_type -> wwapi.v1.NodeNames
-	38, // 31: wwapi.v1.WWApi.Version:input_type -> google.protobuf.Empty
-	7,  // 32: wwapi.v1.WWApi.ImageBuild:output_type -> wwapi.v1.ImageListResponse
-	38, // 33: wwapi.v1.WWApi.ImageDelete:output_type -> google.protobuf.Empty
-	38, // 34: wwapi.v1.WWApi.ImageCopy:output_type -> google.protobuf.Empty
-	7,  // 35: wwapi.v1.WWApi.ImageImport:output_type -> wwapi.v1.ImageListResponse
-	7,  // 36: wwapi.v1.WWApi.ImageList:output_type -> wwapi.v1.ImageListResponse
-	9,  // 37: wwapi.v1.WWApi.ImageShow:output_type -> wwapi.v1.ImageShowResponse
-	38, // 38: wwapi.v1.WWApi.ImageRename:output_type -> google.protobuf.Empty
-	16, // 39: wwapi.v1.WWApi.NodeAdd:output_type -> wwapi.v1.NodeListResponse
-	38, // 40: wwapi.v1.WWApi.NodeDelete:output_type -> google.protobuf.Empty
-	16, // 41: wwapi.v1.WWApi.NodeList:output_type -> wwapi.v1.NodeListResponse
-	16, // 42: wwapi.v1.WWApi.NodeSet:output_type -> wwapi.v1.NodeListResponse
-	26, // 43: wwapi.v1.WWApi.NodeStatus:output_type -> wwapi.v1.NodeStatusResponse
-	27, // 44: wwapi.v1.WWApi.Version:output_type -> wwapi.v1.VersionResponse
-	32, // [32:45] is the sub-list for method output_type
-	19, // [19:32] is the sub-list for method input_type
+	12, // 31: wwapi.v1.WWApi.NodeStatusWatch:input_type -> wwapi.v1.NodeNames
+	38, // 32: wwapi.v1.WWApi.Version:input_type -> google.protobuf.Empty
+	7,  // 33: wwapi.v1.WWApi.ImageBuild:output_type -> wwapi.v1.ImageListResponse
+	38, // 34: wwapi.v1.WWApi.ImageDelete:output_type -> google.protobuf.Empty
+	38, // 35: wwapi.v1.WWApi.ImageCopy:output_type -> google.protobuf.Empty
+	7,  // 36: wwapi.v1.WWApi.ImageImport:output_type -> wwapi.v1.ImageListResponse
+	7,  // 37: wwapi.v1.WWApi.ImageList:output_type -> wwapi.v1.ImageListResponse
+	9,  // 38: wwapi.v1.WWApi.ImageShow:output_type -> wwapi.v1.ImageShowResponse
+	38, // 39: wwapi.v1.WWApi.ImageRename:output_type -> google.protobuf.Empty
+	16, // 40: wwapi.v1.WWApi.NodeAdd:output_type -> wwapi.v1.NodeListResponse
+	38, // 41: wwapi.v1.WWApi.NodeDelete:output_type -> google.protobuf.Empty
+	16, // 42: wwapi.v1.WWApi.NodeList:output_type -> wwapi.v1.NodeListResponse
+	16, // 43: wwapi.v1.WWApi.NodeSet:output_type -> wwapi.v1.NodeListResponse
+	26, // 44: wwapi.v1.WWApi.NodeStatus:output_type -> wwapi.v1.NodeStatusResponse
+	25, // 45: wwapi.v1.WWApi.NodeStatusWatch:output_type -> wwapi.v1.NodeStatus
+	27, // 46: wwapi.v1.WWApi.Version:output_type -> wwapi.v1.VersionResponse
+	33, // [33:47] is the sub-list for method output_type
+	19, // [19:33] is the sub-list for method input_type
 	19, // [19:19] is the sub-list for extension type_name
 	19, // [19:19] is the sub-list for extension extendee
 	0,  // [0:19] is the sub-list for field type_name
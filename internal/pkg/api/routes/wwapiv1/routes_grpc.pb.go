@@ -23,19 +23,20 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	WWApi_ImageBuild_FullMethodName  = "/wwapi.v1.WWApi/ImageBuild"
-	WWApi_ImageDelete_FullMethodName = "/wwapi.v1.WWApi/ImageDelete"
-	WWApi_ImageCopy_FullMethodName   = "/wwapi.v1.WWApi/ImageCopy"
-	WWApi_ImageImport_FullMethodName = "/wwapi.v1.WWApi/ImageImport"
-	WWApi_ImageList_FullMethodName   = "/wwapi.v1.WWApi/ImageList"
-	WWApi_ImageShow_FullMethodName   = "/wwapi.v1.WWApi/ImageShow"
-	WWApi_ImageRename_FullMethodName = "/wwapi.v1.WWApi/ImageRename"
-	WWApi_NodeAdd_FullMethodName     = "/wwapi.v1.WWApi/NodeAdd"
-	WWApi_NodeDelete_FullMethodName  = "/wwapi.v1.WWApi/NodeDelete"
-	WWApi_NodeList_FullMethodName    = "/wwapi.v1.WWApi/NodeList"
-	WWApi_NodeSet_FullMethodName     = "/wwapi.v1.WWApi/NodeSet"
-	WWApi_NodeStatus_FullMethodName  = "/wwapi.v1.WWApi/NodeStatus"
-	WWApi_Version_FullMethodName     = "/wwapi.v1.WWApi/Version"
+	WWApi_ImageBuild_FullMethodName      = "/wwapi.v1.WWApi/ImageBuild"
+	WWApi_ImageDelete_FullMethodName     = "/wwapi.v1.WWApi/ImageDelete"
+	WWApi_ImageCopy_FullMethodName       = "/wwapi.v1.WWApi/ImageCopy"
+	WWApi_ImageImport_FullMethodName     = "/wwapi.v1.WWApi/ImageImport"
+	WWApi_ImageList_FullMethodName       = "/wwapi.v1.WWApi/ImageList"
+	WWApi_ImageShow_FullMethodName       = "/wwapi.v1.WWApi/ImageShow"
+	WWApi_ImageRename_FullMethodName     = "/wwapi.v1.WWApi/ImageRename"
+	WWApi_NodeAdd_FullMethodName         = "/wwapi.v1.WWApi/NodeAdd"
+	WWApi_NodeDelete_FullMethodName      = "/wwapi.v1.WWApi/NodeDelete"
+	WWApi_NodeList_FullMethodName        = "/wwapi.v1.WWApi/NodeList"
+	WWApi_NodeSet_FullMethodName         = "/wwapi.v1.WWApi/NodeSet"
+	WWApi_NodeStatus_FullMethodName      = "/wwapi.v1.WWApi/NodeStatus"
+	WWApi_NodeStatusWatch_FullMethodName = "/wwapi.v1.WWApi/NodeStatusWatch"
+	WWApi_Version_FullMethodName         = "/wwapi.v1.WWApi/Version"
 )
 
 // WWApiClient is the client API for WWApi service.
@@ -69,6 +70,9 @@ type WWApiClient interface {
 	// NodeStatus returns the imaging state for nodes.
 	// This requires warewulfd.
 	NodeStatus(ctx context.Context, in *NodeNames, opts ...grpc.CallOption) (*NodeStatusResponse, error)
+	// NodeStatusWatch streams a NodeStatus each time warewulfd records a
+	// stage change. This requires warewulfd.
+	NodeStatusWatch(ctx context.Context, in *NodeNames, opts ...grpc.CallOption) (grpc.ServerStreamingClient[NodeStatus], error)
 	// Version returns the wwapi version, the api prefix, and the Warewulf
 	// version. This is also useful for testing if the service is up.
 	Version(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*VersionResponse, error)
@@ -202,6 +206,25 @@ func (c *wWApiClient) NodeStatus(ctx context.Context, in *NodeNames, opts ...grp
 	return out, nil
 }
 
+func (c *wWApiClient) NodeStatusWatch(ctx context.Context, in *NodeNames, opts ...grpc.CallOption) (grpc.ServerStreamingClient[NodeStatus], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &WWApi_ServiceDesc.Streams[0], WWApi_NodeStatusWatch_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[NodeNames, NodeStatus]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type WWApi_NodeStatusWatchClient = grpc.ServerStreamingClient[NodeStatus]
+
 func (c *wWApiClient) Version(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*VersionResponse, error) {
 	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
 	out := new(VersionResponse)
@@ -243,6 +266,9 @@ type WWApiServer interface {
 	// NodeStatus returns the imaging state for nodes.
 	// This requires warewulfd.
 	NodeStatus(context.Context, *NodeNames) (*NodeStatusResponse, error)
+	// NodeStatusWatch streams a NodeStatus each time warewulfd records a
+	// stage change. This requires warewulfd.
+	NodeStatusWatch(*NodeNames, grpc.ServerStreamingServer[NodeStatus]) error
 	// Version returns the wwapi version, the api prefix, and the Warewulf
 	// version. This is also useful for testing if the service is up.
 	Version(context.Context, *emptypb.Empty) (*VersionResponse, error)
@@ -292,6 +318,9 @@ func (UnimplementedWWApiServer) NodeSet(context.Context, *ConfSetParameter) (*No
 func (UnimplementedWWApiServer) NodeStatus(context.Context, *NodeNames) (*NodeStatusResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method NodeStatus not implemented")
 }
+func (UnimplementedWWApiServer) NodeStatusWatch(*NodeNames, grpc.ServerStreamingServer[NodeStatus]) error {
+	return status.Errorf(codes.Unimplemented, "method NodeStatusWatch not implemented")
+}
 func (UnimplementedWWApiServer) Version(context.Context, *emptypb.Empty) (*VersionResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Version not implemented")
 }
@@ -532,6 +561,17 @@ func _WWApi_NodeStatus_Handler(srv interface{}, ctx context.Context, dec func(in
 	return interceptor(ctx, in, info, handler)
 }
 
+func _WWApi_NodeStatusWatch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(NodeNames)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(WWApiServer).NodeStatusWatch(m, &grpc.GenericServerStream[NodeNames, NodeStatus]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type WWApi_NodeStatusWatchServer = grpc.ServerStreamingServer[NodeStatus]
+
 func _WWApi_Version_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(emptypb.Empty)
 	if err := dec(in); err != nil {
@@ -610,6 +650,12 @@ var WWApi_ServiceDesc = grpc.ServiceDesc{
 			Handler:    _WWApi_Version_Handler,
 		},
 	},
-	Streams:  []grpc.StreamDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "NodeStatusWatch",
+			Handler:       _WWApi_NodeStatusWatch_Handler,
+			ServerStreams: true,
+		},
+	},
 	Metadata: "routes.proto",
 }
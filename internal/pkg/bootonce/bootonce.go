@@ -0,0 +1,155 @@
+/*
+Package bootonce keeps one-shot boot overrides of nodes, which are set
+with wwctl and applied by warewulfd to the next boot of a node only.
+*/
+package bootonce
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/warewulf/warewulf/internal/pkg/conffile"
+	warewulfconf "github.com/warewulf/warewulf/internal/pkg/config"
+	"github.com/warewulf/warewulf/internal/pkg/node"
+)
+
+// Override replaces settings of a node for a single boot. Empty fields
+// keep the settings of the node.
+type Override struct {
+	Ipxe       string   `json:"ipxe,omitempty"`
+	ImageName  string   `json:"image,omitempty"`
+	KernelArgs []string `json:"kernel args,omitempty"`
+	Created    int64    `json:"created"`
+}
+
+func (o Override) Empty() bool {
+	return o.Ipxe == "" && o.ImageName == "" && len(o.KernelArgs) == 0
+}
+
+/*
+Returns a short description of the override, e.g. for status output
+*/
+func (o Override) String() string {
+	var parts []string
+	if o.Ipxe != "" {
+		parts = append(parts, "ipxe="+o.Ipxe)
+	}
+	if o.ImageName != "" {
+		parts = append(parts, "image="+o.ImageName)
+	}
+	if len(o.KernelArgs) > 0 {
+		parts = append(parts, "kernelargs="+strings.Join(o.KernelArgs, " "))
+	}
+	return strings.Join(parts, ",")
+}
+
+/*
+Returns a copy of n with the override applied
+*/
+func (o Override) Apply(n node.Node) node.Node {
+	if o.Ipxe != "" {
+		n.Ipxe = o.Ipxe
+	}
+	if o.ImageName != "" {
+		n.ImageName = o.ImageName
+	}
+	if len(o.KernelArgs) > 0 {
+		kernel := node.KernelConf{}
+		if n.Kernel != nil {
+			kernel = *n.Kernel
+		}
+		kernel.Args = o.KernelArgs
+		n.Kernel = &kernel
+	}
+	return n
+}
+
+/*
+Runs fn with the overrides of all nodes while holding the lock of the
+file, and writes the overrides back if fn returns true
+*/
+func update(fn func(overrides map[string]Override) (write bool)) error {
+	return conffile.UpdateJSON(warewulfconf.Get().Paths.BootOnceFile(), 0o600, read, func(overrides map[string]Override) (bool, error) {
+		return fn(overrides), nil
+	})
+}
+
+func read(fileName string) (overrides map[string]Override, err error) {
+	overrides = make(map[string]Override)
+	data, err := os.ReadFile(fileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return overrides, nil
+	} else if err != nil {
+		return overrides, fmt.Errorf("could not read boot overrides: %w", err)
+	}
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return overrides, fmt.Errorf("could not parse boot overrides: %s: %w", fileName, err)
+	}
+	return overrides, nil
+}
+
+/*
+Sets the override for the next boot of a node, replacing a pending one
+*/
+func Set(nodeID string, override Override) error {
+	if override.Created == 0 {
+		override.Created = time.Now().Unix()
+	}
+	return update(func(overrides map[string]Override) bool {
+		overrides[nodeID] = override
+		return true
+	})
+}
+
+/*
+Removes the pending override of a node
+*/
+func Clear(nodeID string) error {
+	return update(func(overrides map[string]Override) bool {
+		if _, ok := overrides[nodeID]; !ok {
+			return false
+		}
+		delete(overrides, nodeID)
+		return true
+	})
+}
+
+/*
+Returns the pending overrides of all nodes
+*/
+func List() (map[string]Override, error) {
+	return read(warewulfconf.Get().Paths.BootOnceFile())
+}
+
+// overrides last read by Pending
+var cache conffile.Cache[map[string]Override]
+
+/*
+Returns the pending override of a node without taking the lock. The
+overrides are only read again once the file changed, so that checking
+for an override is cheap for nodes without one.
+*/
+func Pending(nodeID string) (override Override, ok bool, err error) {
+	overrides, err := cache.Get(warewulfconf.Get().Paths.BootOnceFile(), read)
+	if err != nil {
+		return override, false, err
+	}
+	override, ok = overrides[nodeID]
+	return override, ok, nil
+}
+
+/*
+Returns and removes the pending override of a node
+*/
+func Take(nodeID string) (override Override, ok bool, err error) {
+	err = update(func(overrides map[string]Override) bool {
+		override, ok = overrides[nodeID]
+		delete(overrides, nodeID)
+		return ok
+	})
+	return override, ok, err
+}
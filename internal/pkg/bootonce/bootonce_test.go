@@ -0,0 +1,70 @@
+package bootonce
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/warewulf/warewulf/internal/pkg/node"
+	"github.com/warewulf/warewulf/internal/pkg/testenv"
+)
+
+func Test_SetTakeClear(t *testing.T) {
+	env := testenv.New(t)
+	defer env.RemoveAll()
+
+	overrides, err := List()
+	require.NoError(t, err)
+	assert.Empty(t, overrides)
+
+	require.NoError(t, Set("n1", Override{Ipxe: "localdisk"}))
+	require.NoError(t, Set("n2", Override{ImageName: "rescue", KernelArgs: []string{"quiet", "single"}}))
+	overrides, err = List()
+	require.NoError(t, err)
+	assert.Len(t, overrides, 2)
+	assert.Equal(t, "localdisk", overrides["n1"].Ipxe)
+	assert.NotZero(t, overrides["n1"].Created)
+	assert.Equal(t, "image=rescue,kernelargs=quiet single", overrides["n2"].String())
+
+	override, ok, err := Pending("n1")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "localdisk", override.Ipxe)
+
+	override, ok, err = Take("n1")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "localdisk", override.Ipxe)
+	_, ok, err = Take("n1")
+	require.NoError(t, err)
+	assert.False(t, ok, "overrides are taken once")
+	_, ok, err = Pending("n1")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	require.NoError(t, Clear("n2"))
+	require.NoError(t, Clear("n3"))
+	overrides, err = List()
+	require.NoError(t, err)
+	assert.Empty(t, overrides)
+}
+
+func Test_Apply(t *testing.T) {
+	n := node.NewNode("n1")
+	n.Ipxe = "default"
+	n.ImageName = "rocky"
+	n.Kernel = &node.KernelConf{Version: "5.14", Args: []string{"quiet"}}
+
+	applied := Override{KernelArgs: []string{"single"}}.Apply(n)
+	assert.Equal(t, "default", applied.Ipxe)
+	assert.Equal(t, "rocky", applied.ImageName)
+	assert.Equal(t, []string{"single"}, applied.Kernel.Args)
+	assert.Equal(t, "5.14", applied.Kernel.Version)
+	assert.Equal(t, []string{"quiet"}, n.Kernel.Args, "the node is not modified")
+
+	applied = Override{Ipxe: "localdisk", ImageName: "rescue"}.Apply(n)
+	assert.Equal(t, "localdisk", applied.Ipxe)
+	assert.Equal(t, "rescue", applied.ImageName)
+	assert.Equal(t, []string{"quiet"}, applied.Kernel.Args)
+}
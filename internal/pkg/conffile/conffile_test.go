@@ -0,0 +1,135 @@
+package conffile
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_WriteFile(t *testing.T) {
+	dir := t.TempDir()
+	fileName := path.Join(dir, "nodes.conf")
+
+	require.NoError(t, WriteFile(fileName, []byte("nodes: {}\n"), 0o600))
+	data, err := os.ReadFile(fileName)
+	require.NoError(t, err)
+	assert.Equal(t, "nodes: {}\n", string(data))
+	info, err := os.Stat(fileName)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	// the mode of an existing file is kept
+	require.NoError(t, os.Chmod(fileName, 0o640))
+	require.NoError(t, WriteFile(fileName, []byte("nodes:\n  n1: {}\n"), 0o644))
+	data, err = os.ReadFile(fileName)
+	require.NoError(t, err)
+	assert.Equal(t, "nodes:\n  n1: {}\n", string(data))
+	info, err = os.Stat(fileName)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o640), info.Mode().Perm())
+
+	// no temporary files are left behind
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	assert.Error(t, WriteFile(path.Join(dir, "missing", "nodes.conf"), []byte{}, 0o644))
+}
+
+func Test_Lock(t *testing.T) {
+	fileName := path.Join(t.TempDir(), "nodes.conf")
+
+	lock, err := Lock(fileName, 0)
+	require.NoError(t, err)
+	_, err = Lock(fileName, 0)
+	assert.ErrorIs(t, err, ErrLocked)
+	assert.ErrorContains(t, err, fmt.Sprintf("held by process %d", os.Getpid()))
+	require.NoError(t, lock.Unlock())
+
+	// a held lock is waited for
+	lock, err = Lock(fileName, 0)
+	require.NoError(t, err)
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		assert.NoError(t, lock.Unlock())
+	}()
+	lock2, err := Lock(fileName, 5*time.Second)
+	require.NoError(t, err)
+	assert.NoError(t, lock2.Unlock())
+}
+
+func readCounts(fileName string) (counts map[string]int, err error) {
+	counts = make(map[string]int)
+	data, err := os.ReadFile(fileName)
+	if os.IsNotExist(err) {
+		return counts, nil
+	} else if err != nil {
+		return counts, err
+	}
+	return counts, json.Unmarshal(data, &counts)
+}
+
+func Test_UpdateJSON(t *testing.T) {
+	fileName := path.Join(t.TempDir(), "state", "counts.json")
+	increment := func(counts map[string]int) (bool, error) {
+		counts["n1"]++
+		return true, nil
+	}
+	require.NoError(t, UpdateJSON(fileName, 0o600, readCounts, increment))
+	require.NoError(t, UpdateJSON(fileName, 0o600, readCounts, increment))
+	counts, err := readCounts(fileName)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"n1": 2}, counts)
+	info, err := os.Stat(fileName)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	// nothing is written unless fn asks for it
+	require.NoError(t, UpdateJSON(fileName, 0o600, readCounts, func(counts map[string]int) (bool, error) {
+		counts["n1"]++
+		return false, nil
+	}))
+	assert.ErrorIs(t, UpdateJSON(fileName, 0o600, readCounts, func(counts map[string]int) (bool, error) {
+		counts["n1"]++
+		return true, os.ErrInvalid
+	}), os.ErrInvalid)
+	counts, err = readCounts(fileName)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"n1": 2}, counts)
+}
+
+func Test_Cache(t *testing.T) {
+	fileName := path.Join(t.TempDir(), "counts.json")
+	reads := 0
+	read := func(fileName string) (map[string]int, error) {
+		reads++
+		return readCounts(fileName)
+	}
+	var cache Cache[map[string]int]
+
+	counts, err := cache.Get(fileName, read)
+	require.NoError(t, err)
+	assert.Empty(t, counts)
+
+	require.NoError(t, WriteFile(fileName, []byte(`{"n1": 1}`), 0o600))
+	reads = 0
+	for i := 0; i < 3; i++ {
+		counts, err = cache.Get(fileName, read)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]int{"n1": 1}, counts)
+	}
+	assert.Equal(t, 1, reads)
+
+	// a replaced file is read again
+	require.NoError(t, WriteFile(fileName, []byte(`{"n1": 2}`), 0o600))
+	counts, err = cache.Get(fileName, read)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"n1": 2}, counts)
+	assert.Equal(t, 2, reads)
+}
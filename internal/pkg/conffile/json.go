@@ -0,0 +1,80 @@
+package conffile
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+/*
+Runs fn with the value read from the JSON file fileName while holding
+the lock of the file, and writes the value back atomically if fn returns
+true. read must return a usable value for a missing file.
+*/
+func UpdateJSON[T any](fileName string, perm os.FileMode, read func(fileName string) (T, error), fn func(value T) (write bool, err error)) error {
+	if err := os.MkdirAll(filepath.Dir(fileName), 0o755); err != nil {
+		return err
+	}
+	lock, err := Lock(fileName, LockTimeout)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	value, err := read(fileName)
+	if err != nil {
+		return err
+	}
+	if write, err := fn(value); err != nil || !write {
+		return err
+	}
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not marshal %s: %w", fileName, err)
+	}
+	if err := WriteFile(fileName, data, perm); err != nil {
+		return fmt.Errorf("could not write %s: %w", fileName, err)
+	}
+	return nil
+}
+
+/*
+Cache holds the value read from a file, which is only read again once
+the file was changed or replaced, so that files which are read for every
+request aren't read each time.
+*/
+type Cache[T any] struct {
+	lock     sync.Mutex
+	fileName string
+	stat     os.FileInfo
+	value    T
+}
+
+/*
+Returns the value read from fileName with read, which is called again
+only if the file changed since it was read last. The returned value is
+shared and must not be modified.
+*/
+func (c *Cache[T]) Get(fileName string, read func(fileName string) (T, error)) (value T, err error) {
+	stat, err := os.Stat(fileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return read(fileName)
+	} else if err != nil {
+		return value, err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.stat == nil || c.fileName != fileName || !os.SameFile(c.stat, stat) || !c.stat.ModTime().Equal(stat.ModTime()) || c.stat.Size() != stat.Size() {
+		value, err := read(fileName)
+		if err != nil {
+			return value, err
+		}
+		c.fileName = fileName
+		c.stat = stat
+		c.value = value
+	}
+	return c.value, nil
+}
@@ -0,0 +1,85 @@
+package conffile
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrLocked is returned by Lock if another process holds the lock.
+var ErrLocked = errors.New("file is locked")
+
+// LockTimeout is the time to wait for another process to release the lock
+// of a configuration file.
+var LockTimeout = 10 * time.Second
+
+// interval in which a held lock is tried again
+var lockRetryInterval = 100 * time.Millisecond
+
+/*
+FileLock is an advisory lock of a file, which is held in a separate lock
+file next to it, as the file itself is replaced when it is written
+atomically.
+*/
+type FileLock struct {
+	file *os.File
+}
+
+/*
+Takes the advisory lock of fileName, waiting up to timeout for another
+process to release it. The lock file records the process holding the
+lock, which is named in the error if the lock can't be taken.
+*/
+func Lock(fileName string, timeout time.Duration) (*FileLock, error) {
+	lockName := fileName + ".lock"
+	file, err := os.OpenFile(lockName, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("could not open lock file: %w", err)
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, syscall.EWOULDBLOCK) {
+			file.Close()
+			return nil, fmt.Errorf("could not lock %s: %w", fileName, err)
+		}
+		if time.Now().After(deadline) {
+			holder := "another process"
+			if data, err := os.ReadFile(lockName); err == nil {
+				if pid, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil {
+					holder = fmt.Sprintf("process %d", pid)
+				}
+			}
+			file.Close()
+			return nil, fmt.Errorf("%w: %s is held by %s", ErrLocked, fileName, holder)
+		}
+		time.Sleep(lockRetryInterval)
+	}
+	if err := file.Truncate(0); err == nil {
+		_, _ = file.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+	return &FileLock{file: file}, nil
+}
+
+/*
+Releases the lock
+*/
+func (lock *FileLock) Unlock() error {
+	if lock == nil || lock.file == nil {
+		return nil
+	}
+	if err := lock.file.Truncate(0); err != nil {
+		_ = lock.file.Close()
+		return err
+	}
+	err := lock.file.Close()
+	lock.file = nil
+	return err
+}
@@ -0,0 +1,74 @@
+/*
+Package conffile writes configuration and state files, like nodes.conf,
+warewulf.conf and the node tokens, atomically and locks them while they
+are changed.
+*/
+package conffile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+/*
+Writes data to fileName atomically: the data is written to a temporary
+file in the same directory, synced to disk and renamed over fileName, so
+that readers and a crash never see a partially written file. The mode and
+ownership of an existing file are kept, perm is used for new files.
+*/
+func WriteFile(fileName string, data []byte, perm os.FileMode) (err error) {
+	dir := filepath.Dir(fileName)
+	uid, gid := -1, -1
+	if info, err := os.Stat(fileName); err == nil {
+		perm = info.Mode().Perm()
+		if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+			uid, gid = int(stat.Uid), int(stat.Gid)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(fileName)+".*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+	if _, err = tmp.Write(data); err != nil {
+		return err
+	}
+	if err = tmp.Chmod(perm); err != nil {
+		return err
+	}
+	if uid != -1 && os.Geteuid() == 0 {
+		if err = tmp.Chown(uid, gid); err != nil {
+			return err
+		}
+	}
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), fileName); err != nil {
+		return err
+	}
+
+	// sync the directory, so that the rename survives a crash
+	dirFD, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("could not sync %s: %w", dir, err)
+	}
+	defer dirFD.Close()
+	if err = dirFD.Sync(); err != nil {
+		return fmt.Errorf("could not sync %s: %w", dir, err)
+	}
+	return nil
+}
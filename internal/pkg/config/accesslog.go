@@ -0,0 +1,28 @@
+package config
+
+// AccessLogConf configures the structured access log of the Warewulf
+// server, which records one JSON object per provisioning request.
+type AccessLogConf struct {
+	Path       string `yaml:"path,omitempty"`
+	MaxSize    int    `yaml:"max size,omitempty"`
+	MaxBackups int    `yaml:"max backups,omitempty"`
+}
+
+// Enabled returns true if an access log file is configured.
+func (conf AccessLogConf) Enabled() bool {
+	return conf.Path != ""
+}
+
+// MaxSizeBytes returns the size in bytes at which the access log is
+// rotated, which is configured in megabytes. 0 disables the rotation.
+func (conf AccessLogConf) MaxSizeBytes() int64 {
+	return int64(conf.MaxSize) * 1000 * 1000
+}
+
+// Backups returns the number of rotated access logs to keep.
+func (conf AccessLogConf) Backups() int {
+	if conf.MaxBackups > 0 {
+		return conf.MaxBackups
+	}
+	return 5
+}
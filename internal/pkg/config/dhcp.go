@@ -8,8 +8,22 @@ type DHCPConf struct {
 	RangeStart  string `yaml:"range start,omitempty"`
 	RangeEnd    string `yaml:"range end,omitempty"`
 	SystemdName string `yaml:"systemd name,omitempty" default:"dhcpd"`
+	ProxyP      *bool  `yaml:"proxy,omitempty"`
+	HTTPBootP   *bool  `yaml:"http boot,omitempty"`
 }
 
 func (conf DHCPConf) Enabled() bool {
 	return BoolP(conf.EnabledP)
 }
+
+// Proxy returns true if warewulfd answers PXE clients as a proxyDHCP
+// server alongside a DHCP server which is not managed by Warewulf.
+func (conf DHCPConf) Proxy() bool {
+	return BoolP(conf.ProxyP)
+}
+
+// HTTPBoot returns true if UEFI HTTP Boot clients are offered shim and
+// GRUB from warewulfd, without TFTP or iPXE.
+func (conf DHCPConf) HTTPBoot() bool {
+	return BoolP(conf.HTTPBootP)
+}
@@ -11,14 +11,17 @@ import (
 	"fmt"
 	"net"
 	"os"
-	"reflect"
+	"sync/atomic"
 
 	"github.com/creasty/defaults"
+	"github.com/warewulf/warewulf/internal/pkg/conffile"
 	"github.com/warewulf/warewulf/internal/pkg/wwlog"
 	"gopkg.in/yaml.v3"
 )
 
-var cachedConf WarewulfYaml
+// the cached configuration, which is replaced as a whole on reloads so
+// that concurrent readers see either the old or the new configuration
+var cachedConf atomic.Pointer[WarewulfYaml]
 
 // WarewulfYaml is the main Warewulf configuration structure. It stores
 // some information about the Warewulf server locally, and has
@@ -47,18 +50,22 @@ type WarewulfYaml struct {
 // New caches and returns a new [WarewulfYaml] initialized with empty
 // values, clearing replacing any previously cached value.
 func New() *WarewulfYaml {
-	cachedConf = WarewulfYaml{}
-	cachedConf.warewulfconf = ""
-	cachedConf.Warewulf = new(WarewulfConf)
-	cachedConf.DHCP = new(DHCPConf)
-	cachedConf.TFTP = new(TFTPConf)
-	cachedConf.NFS = new(NFSConf)
-	cachedConf.SSH = new(SSHConf)
-	cachedConf.Paths = new(BuildConfig)
-	if err := defaults.Set(&cachedConf); err != nil {
+	conf := newWarewulfYaml()
+	cachedConf.Store(&conf)
+	return &conf
+}
+
+func newWarewulfYaml() (conf WarewulfYaml) {
+	conf.Warewulf = new(WarewulfConf)
+	conf.DHCP = new(DHCPConf)
+	conf.TFTP = new(TFTPConf)
+	conf.NFS = new(NFSConf)
+	conf.SSH = new(SSHConf)
+	conf.Paths = new(BuildConfig)
+	if err := defaults.Set(&conf); err != nil {
 		panic(err)
 	}
-	return &cachedConf
+	return conf
 }
 
 // Get returns a previously cached [WarewulfYaml] if it exists, or returns
@@ -66,10 +73,36 @@ func New() *WarewulfYaml {
 func Get() *WarewulfYaml {
 	// NOTE: This function can be called before any log level is set
 	//       so using wwlog.Verbose or wwlog.Debug won't work
-	if reflect.ValueOf(cachedConf).IsZero() {
-		cachedConf = *New()
+	if conf := cachedConf.Load(); conf != nil {
+		return conf
+	}
+	conf := newWarewulfYaml()
+	if cachedConf.CompareAndSwap(nil, &conf) {
+		return &conf
+	}
+	return cachedConf.Load()
+}
+
+// Reload re-reads the configuration file of the cached [WarewulfYaml].
+// The cached value is only replaced if the file could be read and
+// parsed, otherwise it is left unchanged. If prepare is not nil, it is
+// called with the old and the new configuration before the new one is
+// published, e.g. to keep settings which can't change at runtime.
+func Reload(autodetect bool, prepare func(old, conf *WarewulfYaml)) error {
+	old := Get()
+	confFileName := old.warewulfconf
+	if confFileName == "" {
+		return fmt.Errorf("configuration was not read from a file")
+	}
+	conf := newWarewulfYaml()
+	if err := conf.Read(confFileName, autodetect); err != nil {
+		return err
 	}
-	return &cachedConf
+	if prepare != nil {
+		prepare(old, &conf)
+	}
+	cachedConf.Store(&conf)
+	return nil
 }
 
 // Read populates [WarewulfYaml] with the values from a configuration
@@ -138,6 +171,18 @@ func (conf *WarewulfYaml) Parse(data []byte, autodetect bool) error {
 		}
 	}
 
+	for _, addr := range conf.Warewulf.Listen {
+		if net.ParseIP(addr) == nil {
+			return fmt.Errorf("invalid listen address: must be an ip address: %s", addr)
+		}
+	}
+
+	switch conf.Warewulf.Compression {
+	case "", "gzip", "zstd", "none":
+	default:
+		return fmt.Errorf("invalid compression: must be gzip, zstd or none: %s", conf.Warewulf.Compression)
+	}
+
 	if conf.Ipaddr6 != "" {
 		if _, network, err := net.ParseCIDR(conf.Ipaddr6); err == nil {
 			if conf.Ipv6net == "" {
@@ -201,22 +246,24 @@ func (config *WarewulfYaml) Dump() ([]byte, error) {
 	return buf.Bytes(), err
 }
 
+/*
+Takes the advisory lock of the given warewulf.conf, which is held while
+it is changed
+*/
+func Lock(configFile string) (*conffile.FileLock, error) {
+	return conffile.Lock(configFile, conffile.LockTimeout)
+}
+
 func (config *WarewulfYaml) PersistToFile(configFile string) error {
 	out, dumpErr := config.Dump()
 	if dumpErr != nil {
 		wwlog.Error("%s", dumpErr)
 		return dumpErr
 	}
-	file, err := os.OpenFile(configFile, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
-	if err != nil {
+	if err := conffile.WriteFile(configFile, out, 0o644); err != nil {
 		wwlog.Error("%s", err)
 		return err
 	}
-	defer file.Close()
-	_, err = file.WriteString(string(out))
-	if err != nil {
-		return err
-	}
 	wwlog.Debug("persisted: %s", configFile)
 	return nil
 }
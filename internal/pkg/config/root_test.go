@@ -21,6 +21,9 @@ warewulf:
   host overlay: true
   port: 9873
   secure: true
+  tls:
+    enabled: false
+    port: 9874
   update interval: 60
 nfs:
   enabled: true
@@ -62,6 +65,9 @@ warewulf:
   host overlay: true
   port: 9873
   secure: true
+  tls:
+    enabled: false
+    port: 9874
   update interval: 60
 nfs:
   enabled: true
@@ -105,6 +111,9 @@ warewulf:
   host overlay: true
   port: 9873
   secure: true
+  tls:
+    enabled: false
+    port: 9874
   update interval: 60
 nfs:
   enabled: true
@@ -145,6 +154,9 @@ warewulf:
   host overlay: true
   port: 9873
   secure: true
+  tls:
+    enabled: false
+    port: 9874
   update interval: 60
 nfs:
   enabled: true
@@ -186,6 +198,9 @@ warewulf:
   host overlay: true
   port: 9873
   secure: true
+  tls:
+    enabled: false
+    port: 9874
   update interval: 60
 nfs:
   enabled: true
@@ -255,6 +270,9 @@ warewulf:
   host overlay: true
   port: 9873
   secure: false
+  tls:
+    enabled: false
+    port: 9874
   update interval: 60
 nfs:
   enabled: true
@@ -343,6 +361,72 @@ func TestCache(t *testing.T) {
 	assert.NotEqual(t, 9999, Get().Warewulf.Port)
 }
 
+func TestReload(t *testing.T) {
+	tempWarewulfConf, warewulfConfErr := os.CreateTemp("", "warewulf.conf-")
+	assert.NoError(t, warewulfConfErr)
+	defer os.Remove(tempWarewulfConf.Name())
+	assert.NoError(t, os.WriteFile(tempWarewulfConf.Name(), []byte("warewulf:\n  secure: false\n"), 0o644))
+
+	New()
+	assert.Error(t, Reload(false, nil))
+
+	conf := New()
+	assert.NoError(t, conf.Read(tempWarewulfConf.Name(), false))
+	assert.False(t, Get().Warewulf.Secure())
+
+	assert.NoError(t, os.WriteFile(tempWarewulfConf.Name(), []byte("warewulf:\n  update interval: 30\n"), 0o644))
+	assert.NoError(t, Reload(false, nil))
+	assert.True(t, Get().Warewulf.Secure())
+	assert.Equal(t, 30, Get().Warewulf.UpdateInterval)
+	assert.Equal(t, tempWarewulfConf.Name(), Get().GetWarewulfConf())
+
+	assert.NoError(t, os.WriteFile(tempWarewulfConf.Name(), []byte("warewulf:\n  listen:\n  - eth0\n"), 0o644))
+	assert.Error(t, Reload(false, nil))
+	assert.Equal(t, 30, Get().Warewulf.UpdateInterval)
+	assert.Empty(t, Get().Warewulf.Listen)
+
+	assert.NoError(t, os.WriteFile(tempWarewulfConf.Name(), []byte("warewulf:\n  listen:\n  - 10.0.0.1\n  - fd00::1\n"), 0o644))
+	assert.NoError(t, Reload(false, nil))
+	assert.Equal(t, []string{"10.0.0.1", "fd00::1"}, Get().Warewulf.Listen)
+}
+
+func TestCompression(t *testing.T) {
+	tests := map[string]struct {
+		conf   string
+		format string
+		err    bool
+	}{
+		"default": {
+			conf:   "warewulf: {}",
+			format: "gzip",
+		},
+		"zstd": {
+			conf:   "warewulf:\n  compression: zstd",
+			format: "zstd",
+		},
+		"none": {
+			conf:   "warewulf:\n  compression: none",
+			format: "none",
+		},
+		"invalid": {
+			conf: "warewulf:\n  compression: xz",
+			err:  true,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			conf := New()
+			err := conf.Parse([]byte(tt.conf), false)
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.format, conf.Warewulf.CompressionFormat())
+		})
+	}
+}
+
 func TestIpCIDR(t *testing.T) {
 	tests := map[string]struct {
 		ipaddr  string
@@ -0,0 +1,30 @@
+package config
+
+// TLSConf configures an optional TLS listener for the Warewulf server,
+// which is served alongside the plain HTTP listener.
+type TLSConf struct {
+	EnabledP *bool    `yaml:"enabled,omitempty" default:"false"`
+	Port     int      `yaml:"port,omitempty" default:"9874"`
+	Cert     string   `yaml:"cert,omitempty"`
+	Key      string   `yaml:"key,omitempty"`
+	ClientCA string   `yaml:"client ca,omitempty"`
+	Stages   []string `yaml:"stages,omitempty"`
+}
+
+func (conf TLSConf) Enabled() bool {
+	return BoolP(conf.EnabledP)
+}
+
+// Required returns true if requests for the given provisioning stage
+// must be made over the TLS listener.
+func (conf TLSConf) Required(stage string) bool {
+	if !conf.Enabled() {
+		return false
+	}
+	for _, s := range conf.Stages {
+		if s == stage {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,40 @@
+package config
+
+// TransfersConf configures admission control for the transfers of
+// kernels, images and overlays by the Warewulf server, so that a boot
+// storm doesn't slow down all nodes at once. Limits of 0 are unlimited.
+type TransfersConf struct {
+	MaxConcurrent int            `yaml:"max concurrent,omitempty"`
+	Stages        map[string]int `yaml:"stages,omitempty"`
+	MaxQueue      int            `yaml:"max queue,omitempty"`
+	MaxBandwidth  int            `yaml:"max bandwidth,omitempty"`
+	RetryAfter    int            `yaml:"retry after,omitempty"`
+}
+
+// Limited returns true if any limit on concurrent transfers is set.
+func (conf TransfersConf) Limited() bool {
+	if conf.MaxConcurrent > 0 {
+		return true
+	}
+	for _, limit := range conf.Stages {
+		if limit > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// BandwidthBytes returns the aggregate bandwidth cap in bytes per
+// second, which is configured in megabytes per second.
+func (conf TransfersConf) BandwidthBytes() int64 {
+	return int64(conf.MaxBandwidth) * 1000 * 1000
+}
+
+// RetryAfterSeconds returns the delay clients are asked to wait before
+// retrying a refused transfer.
+func (conf TransfersConf) RetryAfterSeconds() int {
+	if conf.RetryAfter > 0 {
+		return conf.RetryAfter
+	}
+	return 10
+}
@@ -1,5 +1,30 @@
 package config
 
 type WWClientConf struct {
-	Port uint16 `yaml:"port,omitempty" default:"0"`
+	Port           uint16   `yaml:"port,omitempty" default:"0"`
+	TLSP           *bool    `yaml:"tls,omitempty"`
+	TLSCA          string   `yaml:"tls ca,omitempty"`
+	TLSCert        string   `yaml:"tls cert,omitempty"`
+	TLSKey         string   `yaml:"tls key,omitempty"`
+	CleanupP       *bool    `yaml:"cleanup,omitempty"`
+	CleanupDryRunP *bool    `yaml:"cleanup dry run,omitempty"`
+	CleanupPaths   []string `yaml:"cleanup paths,omitempty"`
+	CleanupProtect []string `yaml:"cleanup protect,omitempty"`
+	NotifyP        *bool    `yaml:"notify,omitempty"`
+}
+
+func (conf WWClientConf) TLS() bool {
+	return BoolP(conf.TLSP)
+}
+
+func (conf WWClientConf) Cleanup() bool {
+	return BoolP(conf.CleanupP)
+}
+
+func (conf WWClientConf) CleanupDryRun() bool {
+	return BoolP(conf.CleanupDryRunP)
+}
+
+func (conf WWClientConf) Notify() bool {
+	return BoolP(conf.NotifyP)
 }
@@ -4,6 +4,8 @@ import (
 	"fmt"
 
 	warewulfconf "github.com/warewulf/warewulf/internal/pkg/config"
+	"github.com/warewulf/warewulf/internal/pkg/image"
+	"github.com/warewulf/warewulf/internal/pkg/node"
 	"github.com/warewulf/warewulf/internal/pkg/overlay"
 	"github.com/warewulf/warewulf/internal/pkg/util"
 	"github.com/warewulf/warewulf/internal/pkg/wwlog"
@@ -17,6 +19,15 @@ func DHCP() (err error) {
 
 	controller := warewulfconf.Get()
 
+	if controller.DHCP.HTTPBoot() {
+		if err := checkHTTPBoot(); err != nil {
+			wwlog.Warn("could not check images for UEFI HTTP Boot: %s", err)
+		}
+	}
+	if controller.DHCP.Proxy() {
+		wwlog.Info("PXE clients are answered by warewulfd (dhcp:proxy), not configuring the DHCP service")
+		return
+	}
 	if !controller.DHCP.Enabled() {
 		wwlog.Warn("This system is not configured as a Warewulf DHCP controller")
 		return
@@ -37,3 +48,34 @@ func DHCP() (err error) {
 
 	return
 }
+
+/*
+Checks that the images of all nodes provide shim and grub, which UEFI
+HTTP Boot clients load from warewulfd instead of TFTP.
+*/
+func checkHTTPBoot() error {
+	controller := warewulfconf.Get()
+	wwlog.Info("UEFI HTTP Boot clients are offered http://%s:%d/efiboot/shim.efi", controller.Ipaddr, controller.Warewulf.Port)
+	nodeDB, err := node.New()
+	if err != nil {
+		return err
+	}
+	nodes, err := nodeDB.FindAllNodes()
+	if err != nil {
+		return err
+	}
+	checked := make(map[string]bool)
+	for _, n := range nodes {
+		if n.ImageName == "" || checked[n.ImageName] {
+			continue
+		}
+		checked[n.ImageName] = true
+		if image.ShimFind(n.ImageName) == "" {
+			wwlog.Warn("image %s has no shim, its nodes can't use UEFI HTTP Boot", n.ImageName)
+		}
+		if image.GrubFind(n.ImageName) == "" {
+			wwlog.Warn("image %s has no grub, its nodes can't use UEFI HTTP Boot", n.ImageName)
+		}
+	}
+	return nil
+}
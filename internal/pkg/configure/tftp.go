@@ -13,6 +13,10 @@ import (
 
 func TFTP() (err error) {
 	controller := warewulfconf.Get()
+	if controller.TFTP.Builtin() {
+		wwlog.Info("TFTP is served by warewulfd (tftp:builtin), not copying boot files")
+		return nil
+	}
 	var tftpdir string = path.Join(controller.TFTP.TftpRoot, "warewulf")
 	oldMask := unix.Umask(0)
 	defer unix.Umask(oldMask)
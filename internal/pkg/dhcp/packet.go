@@ -0,0 +1,222 @@
+/*
+Package dhcp implements the DHCP packet format (RFC 2131, 2132) and a
+proxyDHCP responder (PXE specification 2.1), which hands out boot files
+to PXE clients without assigning addresses.
+*/
+package dhcp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+)
+
+// BOOTP operations
+const (
+	opRequest = 1
+	opReply   = 2
+)
+
+// DHCP message types
+const (
+	MsgDiscover = 1
+	MsgOffer    = 2
+	MsgRequest  = 3
+	MsgAck      = 5
+)
+
+// DHCP options
+const (
+	OptPad             = 0
+	OptVendorSpecific  = 43
+	OptMessageType     = 53
+	OptServerID        = 54
+	OptVendorClass     = 60
+	OptUserClass       = 77
+	OptClientArch      = 93
+	OptClientMachineID = 97
+	OptEnd             = 255
+	optOverload        = 52
+)
+
+var magicCookie = []byte{99, 130, 83, 99}
+
+const (
+	// size of the fixed BOOTP header including the magic cookie
+	headerSize = 240
+	// minimum size of a BOOTP message
+	minPacketSize = 300
+)
+
+/*
+Packet is a DHCP message. Options are kept by their code; the order of
+the options isn't preserved.
+*/
+type Packet struct {
+	Op     byte
+	Hops   byte
+	Xid    uint32
+	Secs   uint16
+	Flags  uint16
+	Ciaddr net.IP
+	Yiaddr net.IP
+	Siaddr net.IP
+	Giaddr net.IP
+	Chaddr net.HardwareAddr
+	Sname  string
+	File   string
+
+	Options map[byte][]byte
+}
+
+func cString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
+
+/*
+Parses a DHCP message
+*/
+func Parse(data []byte) (*Packet, error) {
+	if len(data) < headerSize {
+		return nil, fmt.Errorf("short packet: %d bytes", len(data))
+	}
+	if !bytes.Equal(data[236:240], magicCookie) {
+		return nil, fmt.Errorf("not a dhcp packet: missing magic cookie")
+	}
+	hlen := int(data[2])
+	if hlen > 16 {
+		return nil, fmt.Errorf("invalid hardware address length: %d", hlen)
+	}
+	p := &Packet{
+		Op:      data[0],
+		Hops:    data[3],
+		Xid:     binary.BigEndian.Uint32(data[4:]),
+		Secs:    binary.BigEndian.Uint16(data[8:]),
+		Flags:   binary.BigEndian.Uint16(data[10:]),
+		Ciaddr:  net.IPv4(data[12], data[13], data[14], data[15]),
+		Yiaddr:  net.IPv4(data[16], data[17], data[18], data[19]),
+		Siaddr:  net.IPv4(data[20], data[21], data[22], data[23]),
+		Giaddr:  net.IPv4(data[24], data[25], data[26], data[27]),
+		Chaddr:  net.HardwareAddr(append([]byte(nil), data[28:28+hlen]...)),
+		Sname:   cString(data[44:108]),
+		File:    cString(data[108:236]),
+		Options: make(map[byte][]byte),
+	}
+	opts := data[headerSize:]
+	for i := 0; i < len(opts); {
+		code := opts[i]
+		if code == OptEnd {
+			break
+		}
+		if code == OptPad {
+			i++
+			continue
+		}
+		if i+1 >= len(opts) || i+2+int(opts[i+1]) > len(opts) {
+			return nil, fmt.Errorf("truncated option %d", code)
+		}
+		length := int(opts[i+1])
+		// options longer than 255 bytes are split (RFC 3396)
+		p.Options[code] = append(p.Options[code], opts[i+2:i+2+length]...)
+		i += 2 + length
+	}
+	if _, ok := p.Options[optOverload]; ok {
+		return nil, fmt.Errorf("option overload is not supported")
+	}
+	return p, nil
+}
+
+func putIP(b []byte, ip net.IP) {
+	if ip4 := ip.To4(); ip4 != nil {
+		copy(b, ip4)
+	}
+}
+
+/*
+Encodes the message. Options are written in the order of their codes,
+except the message type, which comes first.
+*/
+func (p *Packet) Marshal() []byte {
+	data := make([]byte, headerSize, minPacketSize)
+	data[0] = p.Op
+	data[1] = 1 // ethernet
+	data[2] = byte(len(p.Chaddr))
+	data[3] = p.Hops
+	binary.BigEndian.PutUint32(data[4:], p.Xid)
+	binary.BigEndian.PutUint16(data[8:], p.Secs)
+	binary.BigEndian.PutUint16(data[10:], p.Flags)
+	putIP(data[12:], p.Ciaddr)
+	putIP(data[16:], p.Yiaddr)
+	putIP(data[20:], p.Siaddr)
+	putIP(data[24:], p.Giaddr)
+	copy(data[28:44], p.Chaddr)
+	copy(data[44:107], p.Sname)
+	copy(data[108:235], p.File)
+	copy(data[236:], magicCookie)
+
+	writeOption := func(code byte, value []byte) {
+		for {
+			chunk := value[:min(len(value), 255)]
+			data = append(data, code, byte(len(chunk)))
+			data = append(data, chunk...)
+			value = value[len(chunk):]
+			if len(value) == 0 {
+				return
+			}
+		}
+	}
+	if value, ok := p.Options[OptMessageType]; ok {
+		writeOption(OptMessageType, value)
+	}
+	for code := 1; code < OptEnd; code++ {
+		if value, ok := p.Options[byte(code)]; ok && code != OptMessageType {
+			writeOption(byte(code), value)
+		}
+	}
+	data = append(data, OptEnd)
+	for len(data) < minPacketSize {
+		data = append(data, OptPad)
+	}
+	return data
+}
+
+/*
+Returns the DHCP message type, or 0 for plain BOOTP messages
+*/
+func (p *Packet) MessageType() byte {
+	if value := p.Options[OptMessageType]; len(value) == 1 {
+		return value[0]
+	}
+	return 0
+}
+
+/*
+Returns the client system architecture (option 93), as assigned by
+RFC 4578 and IANA
+*/
+func (p *Packet) Arch() (arch uint16, ok bool) {
+	if value := p.Options[OptClientArch]; len(value) >= 2 {
+		return binary.BigEndian.Uint16(value), true
+	}
+	return 0, false
+}
+
+func (p *Packet) VendorClass() string {
+	return string(p.Options[OptVendorClass])
+}
+
+/*
+Returns the user class (option 77). iPXE sends it as a plain string,
+while RFC 3004 user classes are length-prefixed.
+*/
+func (p *Packet) UserClass() string {
+	value := p.Options[OptUserClass]
+	if len(value) > 1 && int(value[0]) == len(value)-1 {
+		return string(value[1:])
+	}
+	return string(value)
+}
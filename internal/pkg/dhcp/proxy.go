@@ -0,0 +1,149 @@
+package dhcp
+
+import (
+	"errors"
+	"net"
+	"strings"
+)
+
+const (
+	// port of DHCP servers and relays
+	ServerPort = 67
+	// port of DHCP clients
+	ClientPort = 68
+	// port of PXE boot servers, to which clients send their requests
+	// after a proxyDHCP offer
+	PXEPort = 4011
+)
+
+// PXE vendor options (option 43) which tell the client to download the
+// boot file of the offer without boot server discovery or menus
+var pxeVendorOptions = []byte{6, 1, 8, OptEnd}
+
+/*
+BootFile returns the boot file for a PXE client, or false if the client
+should not be answered.
+*/
+type BootFile func(req *Packet) (filename string, ok bool)
+
+/*
+ProxyServer answers DHCPDISCOVER and DHCPREQUEST messages of PXE and
+UEFI HTTP Boot clients with the address of the boot server and the boot
+file, and leaves the
+assignment of addresses to the regular DHCP server.
+*/
+type ProxyServer struct {
+	// address of the boot server, announced as server identifier and
+	// next server
+	ServerIP net.IP
+	BootFile BootFile
+	// destination of replies to clients which don't have an address yet,
+	// defaults to the broadcast address on the client port
+	Broadcast net.Addr
+}
+
+/*
+Returns true if the message was sent by PXE firmware or iPXE
+*/
+func isPXEClient(req *Packet) bool {
+	return req.Op == opRequest && strings.HasPrefix(req.VendorClass(), "PXEClient")
+}
+
+/*
+Returns true if the message was sent by UEFI HTTP Boot firmware, which
+expects an URL as boot file
+*/
+func IsHTTPClient(req *Packet) bool {
+	return req.Op == opRequest && strings.HasPrefix(req.VendorClass(), "HTTPClient")
+}
+
+/*
+Returns the reply to req, or nil if req is not answered
+*/
+func (s *ProxyServer) Reply(req *Packet) *Packet {
+	if !isPXEClient(req) && !IsHTTPClient(req) {
+		return nil
+	}
+	var msgType byte
+	switch req.MessageType() {
+	case MsgDiscover:
+		msgType = MsgOffer
+	case MsgRequest:
+		// requests to the regular DHCP server carry its identifier
+		if id := req.Options[OptServerID]; id != nil && !net.IP(id).Equal(s.ServerIP) {
+			return nil
+		}
+		msgType = MsgAck
+	default:
+		return nil
+	}
+	filename, ok := s.BootFile(req)
+	if !ok {
+		return nil
+	}
+	reply := &Packet{
+		Op:     opReply,
+		Xid:    req.Xid,
+		Flags:  req.Flags,
+		Ciaddr: req.Ciaddr,
+		Siaddr: s.ServerIP,
+		Giaddr: req.Giaddr,
+		Chaddr: req.Chaddr,
+		File:   filename,
+		Options: map[byte][]byte{
+			OptMessageType:    {msgType},
+			OptServerID:       s.ServerIP.To4(),
+			OptVendorClass:    []byte("PXEClient"),
+			OptVendorSpecific: pxeVendorOptions,
+		},
+	}
+	if IsHTTPClient(req) {
+		// HTTP Boot firmware only accepts offers which echo its class
+		reply.Options[OptVendorClass] = []byte("HTTPClient")
+		delete(reply.Options, OptVendorSpecific)
+	}
+	if id, ok := req.Options[OptClientMachineID]; ok {
+		reply.Options[OptClientMachineID] = id
+	}
+	return reply
+}
+
+/*
+Returns the address to which the reply to a message received from remote
+is sent
+*/
+func (s *ProxyServer) replyAddr(req *Packet, remote net.Addr) net.Addr {
+	if req.Giaddr != nil && !req.Giaddr.IsUnspecified() {
+		return &net.UDPAddr{IP: req.Giaddr, Port: ServerPort}
+	}
+	if req.MessageType() == MsgRequest {
+		return remote
+	}
+	if s.Broadcast != nil {
+		return s.Broadcast
+	}
+	return &net.UDPAddr{IP: net.IPv4bcast, Port: ClientPort}
+}
+
+/*
+Serves requests received on conn until it is closed
+*/
+func (s *ProxyServer) Serve(conn net.PacketConn) error {
+	buf := make([]byte, 1500)
+	for {
+		n, remote, err := conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		req, err := Parse(buf[:n])
+		if err != nil {
+			continue
+		}
+		if reply := s.Reply(req); reply != nil {
+			_, _ = conn.WriteTo(reply.Marshal(), s.replyAddr(req, remote))
+		}
+	}
+}
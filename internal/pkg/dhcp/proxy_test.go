@@ -0,0 +1,172 @@
+package dhcp
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var serverIP = net.ParseIP("10.0.0.1")
+
+func discover(vendorClass string, arch uint16) *Packet {
+	hwaddr, _ := net.ParseMAC("00:00:00:ff:ff:ff")
+	return &Packet{
+		Op:     opRequest,
+		Xid:    0x12345678,
+		Flags:  0x8000,
+		Chaddr: hwaddr,
+		Options: map[byte][]byte{
+			OptMessageType:     {MsgDiscover},
+			OptVendorClass:     []byte(vendorClass),
+			OptClientArch:      {byte(arch >> 8), byte(arch)},
+			OptClientMachineID: {0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
+		},
+	}
+}
+
+func bootFile(req *Packet) (string, bool) {
+	if req.UserClass() == "iPXE" {
+		return "http://10.0.0.1:9873/ipxe/${mac:hexhyp}", true
+	}
+	arch, _ := req.Arch()
+	switch arch {
+	case 0:
+		return "warewulf/undionly.kpxe", true
+	case 7:
+		return "warewulf/ipxe-snponly-x86_64.efi", true
+	}
+	return "", false
+}
+
+func Test_Parse(t *testing.T) {
+	req := discover("PXEClient:Arch:00007:UNDI:003016", 7)
+	req.Options[OptUserClass] = []byte("iPXE")
+	req.Options[250] = make([]byte, 300)
+	req.Ciaddr, req.Yiaddr, req.Siaddr = net.IPv4zero, net.IPv4zero, net.IPv4zero
+	req.Giaddr = net.IPv4(10, 0, 0, 254)
+	parsed, err := Parse(req.Marshal())
+	require.NoError(t, err)
+	assert.Equal(t, req, parsed)
+	assert.Equal(t, byte(MsgDiscover), parsed.MessageType())
+	arch, ok := parsed.Arch()
+	assert.True(t, ok)
+	assert.Equal(t, uint16(7), arch)
+	assert.Equal(t, "iPXE", parsed.UserClass())
+
+	for name, data := range map[string][]byte{
+		"short":            make([]byte, 100),
+		"no magic cookie":  make([]byte, 300),
+		"truncated option": append(req.Marshal()[:headerSize], OptVendorClass, 10, 'P'),
+	} {
+		_, err := Parse(data)
+		assert.Error(t, err, name)
+	}
+}
+
+func Test_UserClass(t *testing.T) {
+	p := &Packet{Options: map[byte][]byte{OptUserClass: append([]byte{4}, "iPXE"...)}}
+	assert.Equal(t, "iPXE", p.UserClass())
+}
+
+func Test_Reply(t *testing.T) {
+	s := &ProxyServer{ServerIP: serverIP, BootFile: bootFile}
+
+	t.Run("offer", func(t *testing.T) {
+		req := discover("PXEClient:Arch:00000:UNDI:002001", 0)
+		reply := s.Reply(req)
+		require.NotNil(t, reply)
+		assert.Equal(t, byte(MsgOffer), reply.MessageType())
+		assert.Equal(t, "warewulf/undionly.kpxe", reply.File)
+		assert.Equal(t, req.Xid, reply.Xid)
+		assert.Equal(t, req.Chaddr, reply.Chaddr)
+		assert.True(t, serverIP.Equal(reply.Siaddr))
+		assert.Nil(t, reply.Yiaddr)
+		assert.Equal(t, []byte(serverIP.To4()), reply.Options[OptServerID])
+		assert.Equal(t, "PXEClient", reply.VendorClass())
+		assert.Equal(t, req.Options[OptClientMachineID], reply.Options[OptClientMachineID])
+	})
+
+	t.Run("request", func(t *testing.T) {
+		req := discover("PXEClient:Arch:00007:UNDI:003016", 7)
+		req.Options[OptMessageType] = []byte{MsgRequest}
+		reply := s.Reply(req)
+		require.NotNil(t, reply)
+		assert.Equal(t, byte(MsgAck), reply.MessageType())
+		assert.Equal(t, "warewulf/ipxe-snponly-x86_64.efi", reply.File)
+	})
+
+	t.Run("ipxe", func(t *testing.T) {
+		req := discover("PXEClient:Arch:00007:UNDI:003016", 7)
+		req.Options[OptUserClass] = []byte("iPXE")
+		reply := s.Reply(req)
+		require.NotNil(t, reply)
+		assert.Equal(t, "http://10.0.0.1:9873/ipxe/${mac:hexhyp}", reply.File)
+	})
+
+	t.Run("http boot", func(t *testing.T) {
+		s := &ProxyServer{ServerIP: serverIP, BootFile: func(req *Packet) (string, bool) {
+			return "http://10.0.0.1:9873/efiboot/shim.efi", true
+		}}
+		reply := s.Reply(discover("HTTPClient:Arch:00016:UNDI:003016", 16))
+		require.NotNil(t, reply)
+		assert.Equal(t, "http://10.0.0.1:9873/efiboot/shim.efi", reply.File)
+		assert.Equal(t, "HTTPClient", reply.VendorClass())
+		assert.NotContains(t, reply.Options, byte(OptVendorSpecific))
+	})
+
+	t.Run("ignored", func(t *testing.T) {
+		assert.Nil(t, s.Reply(discover("MSFT 5.0", 0)), "not a pxe client")
+		assert.Nil(t, s.Reply(discover("PXEClient:Arch:00011:UNDI:003016", 11)), "unknown architecture")
+		req := discover("PXEClient:Arch:00000:UNDI:002001", 0)
+		req.Options[OptMessageType] = []byte{MsgRequest}
+		req.Options[OptServerID] = net.ParseIP("10.0.0.2").To4()
+		assert.Nil(t, s.Reply(req), "request to another server")
+		req = discover("PXEClient:Arch:00000:UNDI:002001", 0)
+		req.Op = opReply
+		assert.Nil(t, s.Reply(req), "reply")
+	})
+}
+
+func Test_Serve(t *testing.T) {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+	client, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer client.Close()
+
+	s := &ProxyServer{ServerIP: serverIP, BootFile: bootFile, Broadcast: client.LocalAddr()}
+	go func() {
+		_ = s.Serve(conn)
+	}()
+
+	receive := func() *Packet {
+		buf := make([]byte, 1500)
+		require.NoError(t, client.SetReadDeadline(time.Now().Add(2*time.Second)))
+		n, _, err := client.ReadFrom(buf)
+		require.NoError(t, err)
+		reply, err := Parse(buf[:n])
+		require.NoError(t, err)
+		return reply
+	}
+
+	// the offer is broadcast, as the client has no address yet
+	_, err = client.WriteTo(discover("PXEClient:Arch:00000:UNDI:002001", 0).Marshal(), conn.LocalAddr())
+	require.NoError(t, err)
+	offer := receive()
+	assert.Equal(t, byte(MsgOffer), offer.MessageType())
+	assert.Equal(t, "warewulf/undionly.kpxe", offer.File)
+
+	// the acknowledgement goes back to the sender
+	req := discover("PXEClient:Arch:00007:UNDI:003016", 7)
+	req.Options[OptMessageType] = []byte{MsgRequest}
+	req.Ciaddr = net.ParseIP("127.0.0.1")
+	_, err = client.WriteTo(req.Marshal(), conn.LocalAddr())
+	require.NoError(t, err)
+	ack := receive()
+	assert.Equal(t, byte(MsgAck), ack.MessageType())
+	assert.Equal(t, "warewulf/ipxe-snponly-x86_64.efi", ack.File)
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/pkg/errors"
 
+	warewulfconf "github.com/warewulf/warewulf/internal/pkg/config"
 	"github.com/warewulf/warewulf/internal/pkg/util"
 	"github.com/warewulf/warewulf/internal/pkg/wwlog"
 )
@@ -24,6 +25,9 @@ func Build(name string, buildForce bool) error {
 		wwlog.Debug("Checking if there have been any updates to the image source directory")
 		if util.PathIsNewer(rootfsPath, imagePath) {
 			wwlog.Info("Skipping (Image is current)")
+			if !util.IsFile(ImageDigestFile(name)) {
+				return WriteDigest(name)
+			}
 			return nil
 		}
 	}
@@ -46,7 +50,11 @@ func Build(name string, buildForce bool) error {
 		ignore,
 		// ignore cross-device files
 		true,
-		"newc")
+		"newc",
+		warewulfconf.Get().Warewulf.CompressionFormat())
+	if err != nil {
+		return err
+	}
 
-	return err
+	return WriteDigest(name)
 }
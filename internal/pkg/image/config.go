@@ -1,9 +1,11 @@
 package image
 
 import (
+	"os"
 	"path"
 
 	warewulfconf "github.com/warewulf/warewulf/internal/pkg/config"
+	"github.com/warewulf/warewulf/internal/pkg/util"
 )
 
 func SourceParentDir() string {
@@ -31,3 +33,21 @@ func ImageParentDir() string {
 func ImageFile(name string) string {
 	return path.Join(ImageParentDir(), name+".img")
 }
+
+func ImageDigestFile(name string) string {
+	return ImageFile(name) + ".sha256"
+}
+
+/*
+Returns the sizes of the compressed variants of an image by compression
+format. Formats in which the image hasn't been compressed are left out.
+*/
+func CompressedSizes(name string) map[string]int64 {
+	sizes := make(map[string]int64)
+	for _, format := range util.CompressFormats {
+		if stat, err := os.Stat(util.CompressedFile(ImageFile(name), format)); err == nil {
+			sizes[format] = stat.Size()
+		}
+	}
+	return sizes
+}
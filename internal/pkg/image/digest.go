@@ -0,0 +1,39 @@
+package image
+
+import (
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/warewulf/warewulf/internal/pkg/util"
+)
+
+/*
+Writes the SHA-256 digest of the image of an image next to it, so that
+nodes can report which image they booted
+*/
+func WriteDigest(name string) error {
+	file, err := os.Open(ImageFile(name))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	digest, err := util.HashFile(file)
+	if err != nil {
+		return errors.Wrapf(err, "could not hash image %s", name)
+	}
+	return os.WriteFile(ImageDigestFile(name), []byte(digest+"\n"), 0o644)
+}
+
+/*
+Returns the digest of the image of an image, or an empty string if it is
+unknown
+*/
+func Digest(name string) string {
+	data, err := os.ReadFile(ImageDigestFile(name))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
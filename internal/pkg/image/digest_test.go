@@ -0,0 +1,26 @@
+package image
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warewulf/warewulf/internal/pkg/testenv"
+)
+
+func Test_Digest(t *testing.T) {
+	env := testenv.New(t)
+	defer env.RemoveAll()
+
+	assert.Equal(t, "", Digest("suse"))
+	assert.Error(t, WriteDigest("suse"))
+
+	env.WriteFile("srv/warewulf/images/suse.img", "image")
+	require.NoError(t, WriteDigest("suse"))
+	assert.Equal(t, "6105d6cc76af400325e94d588ce511be5bfdbb73b437dc51eca43917d7a43e3d", Digest("suse"))
+
+	require.NoError(t, DeleteImage("suse"))
+	_, err := os.Stat(ImageDigestFile("suse"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -98,13 +98,18 @@ func DeleteImage(name string) error {
 	if util.IsFile(imageFile) {
 		wwlog.Verbose("removing %s for image %s", imageFile, name)
 		errImg := os.Remove(imageFile)
-		wwlog.Verbose("removing %s for image %s", imageFile+".gz", name)
-		errGz := os.Remove(imageFile + ".gz")
 		if errImg != nil {
 			return errors.Errorf("Problems delete %s for image %s: %s\n", imageFile, name, errImg)
 		}
-		if errGz != nil {
-			return errors.Errorf("Problems delete %s for image %s: %s\n", imageFile+".gz", name, errGz)
+		for _, format := range util.CompressFormats {
+			compressedFile := util.CompressedFile(imageFile, format)
+			wwlog.Verbose("removing %s for image %s", compressedFile, name)
+			if err := os.Remove(compressedFile); err != nil && !os.IsNotExist(err) {
+				return errors.Errorf("Problems delete %s for image %s: %s\n", compressedFile, name, err)
+			}
+		}
+		if err := os.Remove(ImageDigestFile(name)); err != nil && !os.IsNotExist(err) {
+			return errors.Errorf("Problems delete %s for image %s: %s\n", ImageDigestFile(name), name, err)
 		}
 		return nil
 	}
@@ -28,6 +28,7 @@ type Node struct {
 	// exported values
 	Discoverable wwtype.WWbool     `yaml:"discoverable,omitempty" lopt:"discoverable" sopt:"e" comment:"Make discoverable in given network (true/false)"`
 	AssetKey     string            `yaml:"asset key,omitempty" lopt:"asset" comment:"Set the node's Asset tag (key)"`
+	UUID         string            `yaml:"uuid,omitempty" lopt:"uuid" comment:"Set the node's SMBIOS UUID"`
 	Profile      `yaml:"-,inline"` // include all values set in the profile, but inline them in yaml output if these are part of Node
 }
 
@@ -42,6 +43,7 @@ type Profile struct {
 	ClusterName    string                 `yaml:"cluster name,omitempty" lopt:"cluster" sopt:"c" comment:"Set cluster group"`
 	ImageName      string                 `yaml:"image name,omitempty" lopt:"image" comment:"Set image name"`
 	Ipxe           string                 `yaml:"ipxe template,omitempty" lopt:"ipxe" comment:"Set the iPXE template name"`
+	UUIDBinding    wwtype.WWbool          `yaml:"uuid binding,omitempty" lopt:"uuid-binding" comment:"Record the SMBIOS UUID on first contact and refuse other UUIDs (true/false)"`
 	RuntimeOverlay []string               `yaml:"runtime overlay,omitempty" lopt:"runtime-overlays" sopt:"R" comment:"Set the runtime overlay"`
 	SystemOverlay  []string               `yaml:"system overlay,omitempty" lopt:"system-overlays" sopt:"O" comment:"Set the system overlay"`
 	Kernel         *KernelConf            `yaml:"kernel,omitempty"`
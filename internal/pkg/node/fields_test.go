@@ -165,11 +165,13 @@ func Test_listFields(t *testing.T) {
 			fields: []string{
 				"Discoverable",
 				"AssetKey",
+				"UUID",
 				"Profiles",
 				"Comment",
 				"ClusterName",
 				"ImageName",
 				"Ipxe",
+				"UUIDBinding",
 				"RuntimeOverlay",
 				"SystemOverlay",
 				"Kernel.Version",
@@ -224,6 +226,7 @@ func Test_listFields(t *testing.T) {
 				"ClusterName",
 				"ImageName",
 				"Ipxe",
+				"UUIDBinding",
 				"RuntimeOverlay",
 				"SystemOverlay",
 				"Kernel.Version",
@@ -3,10 +3,10 @@ package node
 import (
 	"bytes"
 	"encoding/gob"
-	"os"
 
 	"github.com/pkg/errors"
 
+	"github.com/warewulf/warewulf/internal/pkg/conffile"
 	warewulfconf "github.com/warewulf/warewulf/internal/pkg/config"
 	"github.com/warewulf/warewulf/internal/pkg/util"
 	"github.com/warewulf/warewulf/internal/pkg/wwlog"
@@ -106,6 +106,16 @@ func (config *NodesYaml) DelProfile(profileID string) error {
 	return nil
 }
 
+/*
+Takes the advisory lock of nodes.conf. Commands changing the node
+configuration hold it from reading nodes.conf until it is persisted, so
+that concurrent changes, e.g. by wwctl and by discovery in warewulfd,
+don't overwrite each other.
+*/
+func Lock() (*conffile.FileLock, error) {
+	return conffile.Lock(warewulfconf.Get().Paths.NodesConf(), conffile.LockTimeout)
+}
+
 /*
 Write the the NodeYaml to disk.
 */
@@ -122,16 +132,10 @@ func (config *NodesYaml) PersistToFile(configFile string) error {
 		wwlog.Error("%s", dumpErr)
 		return dumpErr
 	}
-	file, err := os.OpenFile(configFile, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
-	if err != nil {
+	if err := conffile.WriteFile(configFile, out, 0o644); err != nil {
 		wwlog.Error("%s", err)
 		return err
 	}
-	defer file.Close()
-	_, err = file.WriteString(string(out))
-	if err != nil {
-		return err
-	}
 	wwlog.Debug("persisted: %s", configFile)
 	return nil
 }
@@ -0,0 +1,84 @@
+/*
+Package nodehealth defines the health report which wwclient sends to
+warewulfd each time it updates the runtime overlay of a node.
+*/
+package nodehealth
+
+import (
+	"github.com/warewulf/warewulf/internal/pkg/util"
+)
+
+// Health is the state of a running node as reported by wwclient.
+type Health struct {
+	// seconds since the node booted
+	Uptime int64 `json:"uptime"`
+	// load average over 1, 5 and 15 minutes
+	Load [3]float64 `json:"load"`
+	// release of the running kernel
+	Kernel string `json:"kernel"`
+	// name and digest of the booted image
+	Image       string `json:"image,omitempty"`
+	ImageDigest string `json:"image digest,omitempty"`
+	// memory in bytes
+	MemoryTotal     uint64 `json:"memory total"`
+	MemoryAvailable uint64 `json:"memory available"`
+	// failed systemd units
+	FailedUnits []string `json:"failed units,omitempty"`
+	Version     string   `json:"wwclient version"`
+	// outcomes of the post-update hooks which ran last
+	Hooks []HookResult `json:"hooks,omitempty"`
+	// error of the last update of the runtime overlay
+	UpdateError string `json:"update error,omitempty"`
+
+	// set by warewulfd when the report is received
+	Received       int64  `json:"received,omitempty"`
+	ExpectedKernel string `json:"expected kernel,omitempty"`
+}
+
+// HookResult is the outcome of a post-update hook of wwclient.
+type HookResult struct {
+	Name string `json:"name"`
+	// time the hook was started
+	Time int64 `json:"time"`
+	// changed paths which triggered the hook
+	Paths    []string `json:"paths,omitempty"`
+	ExitCode int      `json:"exit code"`
+	// set if the hook could not be run or timed out
+	Error string `json:"error,omitempty"`
+	// end of the combined output of the hook
+	Output string `json:"output,omitempty"`
+}
+
+/*
+Returns true if the hook could not be run or exited with an error
+*/
+func (r HookResult) Failed() bool {
+	return r.ExitCode != 0 || r.Error != ""
+}
+
+/*
+Returns the names of the hooks which failed
+*/
+func (h Health) FailedHooks() (names []string) {
+	for _, hook := range h.Hooks {
+		if hook.Failed() {
+			names = append(names, hook.Name)
+		}
+	}
+	return names
+}
+
+/*
+Returns true if the running kernel differs from the kernel configured for
+the node. The versions are compared as parsed from the kernel release and
+the kernel file name.
+*/
+func (h Health) KernelMismatch() bool {
+	if h.Kernel == "" || h.ExpectedKernel == "" {
+		return false
+	}
+	if running := util.ParseVersion(h.Kernel); running != nil {
+		return running.String() != h.ExpectedKernel
+	}
+	return h.Kernel != h.ExpectedKernel
+}
@@ -0,0 +1,46 @@
+package nodehealth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/warewulf/warewulf/internal/pkg/util"
+)
+
+// the expected kernel is the version parsed from the kernel file name
+func kernelVersion(path string) string {
+	return util.ParseVersion(path).String()
+}
+
+func Test_KernelMismatch(t *testing.T) {
+	tests := map[string]struct {
+		kernel   string
+		expected string
+		mismatch bool
+	}{
+		"same kernel":       {"5.14.0-427.13.1.el9_4.x86_64", kernelVersion("/boot/vmlinuz-5.14.0-427.13.1.el9_4.x86_64"), false},
+		"other kernel":      {"5.14.0-362.8.1.el9_3.x86_64", kernelVersion("/boot/vmlinuz-5.14.0-427.13.1.el9_4.x86_64"), true},
+		"debian kernel":     {"6.1.0-13-amd64", kernelVersion("/boot/vmlinuz-6.1.0-13-amd64"), false},
+		"unknown expected":  {"6.1.0-13-amd64", "", false},
+		"unknown kernel":    {"", kernelVersion("/boot/vmlinuz-6.1.0-13-amd64"), false},
+		"unparsable kernel": {"custom", kernelVersion("/boot/vmlinuz-6.1.0-13-amd64"), true},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			h := Health{Kernel: tt.kernel, ExpectedKernel: tt.expected}
+			assert.Equal(t, tt.mismatch, h.KernelMismatch())
+		})
+	}
+}
+
+func Test_FailedHooks(t *testing.T) {
+	h := Health{Hooks: []HookResult{
+		{Name: "slurm"},
+		{Name: "sshd", ExitCode: 1},
+		{Name: "timeout", ExitCode: -1, Error: "timed out after 60s"},
+		{Name: "missing", Error: "exec: \"/bin/sh\": file does not exist"},
+	}}
+	assert.Equal(t, []string{"sshd", "timeout", "missing"}, h.FailedHooks())
+	assert.Empty(t, Health{}.FailedHooks())
+}
@@ -0,0 +1,198 @@
+/*
+Package nodetoken keeps the secret tokens of nodes, which are delivered
+to the nodes in their system overlay and which wwclient signs its
+requests to warewulfd with.
+*/
+package nodetoken
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/warewulf/warewulf/internal/pkg/conffile"
+	warewulfconf "github.com/warewulf/warewulf/internal/pkg/config"
+)
+
+// MaxAge is the maximum difference between the time a request was signed
+// and the time of the server, which limits replays of requests.
+const MaxAge = 5 * time.Minute
+
+var (
+	ErrNoToken   = errors.New("node has no token")
+	ErrUnsigned  = errors.New("request is not signed")
+	ErrExpired   = errors.New("signature is expired")
+	ErrSignature = errors.New("invalid signature")
+)
+
+// Token is the secret of a node. After a rotation, the previous secret
+// stays valid until the node signs a request with the current one.
+type Token struct {
+	Secret   string `json:"secret"`
+	Previous string `json:"previous,omitempty"`
+	Created  int64  `json:"created"`
+}
+
+func newToken() (Token, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return Token{}, fmt.Errorf("could not generate node token: %w", err)
+	}
+	return Token{Secret: hex.EncodeToString(secret), Created: time.Now().Unix()}, nil
+}
+
+/*
+Runs fn with the tokens of all nodes while holding the lock of the file,
+and writes the tokens back if fn returns true
+*/
+func update(fn func(tokens map[string]Token) (write bool, err error)) error {
+	return conffile.UpdateJSON(warewulfconf.Get().Paths.NodeTokensFile(), 0o600, read, fn)
+}
+
+func read(fileName string) (tokens map[string]Token, err error) {
+	tokens = make(map[string]Token)
+	data, err := os.ReadFile(fileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return tokens, nil
+	} else if err != nil {
+		return tokens, fmt.Errorf("could not read node tokens: %w", err)
+	}
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return tokens, fmt.Errorf("could not parse node tokens: %s: %w", fileName, err)
+	}
+	return tokens, nil
+}
+
+/*
+Returns the secret of a node, which is created if the node has none yet
+*/
+func Get(nodeID string) (secret string, err error) {
+	err = update(func(tokens map[string]Token) (bool, error) {
+		if token, ok := tokens[nodeID]; ok {
+			secret = token.Secret
+			return false, nil
+		}
+		token, err := newToken()
+		if err != nil {
+			return false, err
+		}
+		tokens[nodeID] = token
+		secret = token.Secret
+		return true, nil
+	})
+	return secret, err
+}
+
+/*
+Replaces the secret of a node. Unless revoke is set, the previous secret
+stays valid until the node signs a request with the new one.
+*/
+func Rotate(nodeID string, revoke bool) error {
+	return update(func(tokens map[string]Token) (bool, error) {
+		token, err := newToken()
+		if err != nil {
+			return false, err
+		}
+		if old, ok := tokens[nodeID]; ok && !revoke {
+			token.Previous = old.Secret
+			if old.Previous != "" {
+				// the node never used the secret which is replaced now
+				token.Previous = old.Previous
+			}
+		}
+		tokens[nodeID] = token
+		return true, nil
+	})
+}
+
+/*
+Returns the tokens of all nodes
+*/
+func List() (map[string]Token, error) {
+	return read(warewulfconf.Get().Paths.NodeTokensFile())
+}
+
+// tokens last read by Verify
+var cache conffile.Cache[map[string]Token]
+
+/*
+Returns the token of a node. The tokens are only read again once the
+file changed, so that requests can be verified without reading the file
+each time.
+*/
+func cachedToken(nodeID string) (token Token, ok bool, err error) {
+	tokens, err := cache.Get(warewulfconf.Get().Paths.NodeTokensFile(), read)
+	if err != nil {
+		return token, false, err
+	}
+	token, ok = tokens[nodeID]
+	return token, ok, nil
+}
+
+/*
+Returns the signature of a request of the node with the given hardware
+address at the given time
+*/
+func Sign(secret string, hwaddr string, timestamp int64) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(NormalizeHwaddr(hwaddr) + "\n" + strconv.FormatInt(timestamp, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+/*
+Returns the hardware address in the form it is signed in
+*/
+func NormalizeHwaddr(hwaddr string) string {
+	return strings.ToLower(strings.ReplaceAll(hwaddr, "-", ":"))
+}
+
+/*
+Checks that a request of the node with the given hardware address was
+signed with the secret of the node within MaxAge. A previous secret is
+dropped once the node signs with its current secret.
+*/
+func Verify(nodeID string, hwaddr string, timestamp string, signature string) error {
+	if timestamp == "" || signature == "" {
+		return ErrUnsigned
+	}
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: invalid timestamp: %s", ErrSignature, timestamp)
+	}
+	if age := time.Since(time.Unix(ts, 0)); age > MaxAge || age < -MaxAge {
+		return ErrExpired
+	}
+	token, ok, err := cachedToken(nodeID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNoToken
+	}
+	if hmac.Equal([]byte(signature), []byte(Sign(token.Secret, hwaddr, ts))) {
+		if token.Previous != "" {
+			return update(func(tokens map[string]Token) (bool, error) {
+				current, ok := tokens[nodeID]
+				if !ok || current.Secret != token.Secret {
+					return false, nil
+				}
+				current.Previous = ""
+				tokens[nodeID] = current
+				return true, nil
+			})
+		}
+		return nil
+	}
+	if token.Previous != "" && hmac.Equal([]byte(signature), []byte(Sign(token.Previous, hwaddr, ts))) {
+		return nil
+	}
+	return ErrSignature
+}
@@ -0,0 +1,90 @@
+package nodetoken
+
+import (
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	warewulfconf "github.com/warewulf/warewulf/internal/pkg/config"
+	"github.com/warewulf/warewulf/internal/pkg/testenv"
+)
+
+func sign(secret, hwaddr string, ts time.Time) (string, string) {
+	return strconv.FormatInt(ts.Unix(), 10), Sign(secret, hwaddr, ts.Unix())
+}
+
+func Test_Get(t *testing.T) {
+	env := testenv.New(t)
+	defer env.RemoveAll()
+
+	secret, err := Get("n1")
+	require.NoError(t, err)
+	assert.Len(t, secret, 64)
+	again, err := Get("n1")
+	require.NoError(t, err)
+	assert.Equal(t, secret, again, "tokens are created once")
+	other, err := Get("n2")
+	require.NoError(t, err)
+	assert.NotEqual(t, secret, other)
+
+	stat, err := os.Stat(warewulfconf.Get().Paths.NodeTokensFile())
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), stat.Mode().Perm())
+}
+
+func Test_Verify(t *testing.T) {
+	env := testenv.New(t)
+	defer env.RemoveAll()
+
+	secret, err := Get("n1")
+	require.NoError(t, err)
+	other, err := Get("n2")
+	require.NoError(t, err)
+
+	ts, sig := sign(secret, "00:00:00:00:00:01", time.Now())
+	assert.NoError(t, Verify("n1", "00:00:00:00:00:01", ts, sig))
+	assert.NoError(t, Verify("n1", "00-00-00-00-00-01", ts, sig), "hardware addresses are normalized")
+	assert.ErrorIs(t, Verify("n1", "00:00:00:00:00:02", ts, sig), ErrSignature, "signed for another hardware address")
+	assert.ErrorIs(t, Verify("n2", "00:00:00:00:00:01", ts, sig), ErrSignature, "signed for another node")
+	assert.ErrorIs(t, Verify("n3", "00:00:00:00:00:01", ts, sig), ErrNoToken)
+	assert.ErrorIs(t, Verify("n1", "00:00:00:00:00:01", "", ""), ErrUnsigned)
+	assert.ErrorIs(t, Verify("n1", "00:00:00:00:00:01", "yesterday", sig), ErrSignature)
+
+	ts, sig = sign(secret, "00:00:00:00:00:01", time.Now().Add(-2*MaxAge))
+	assert.ErrorIs(t, Verify("n1", "00:00:00:00:00:01", ts, sig), ErrExpired)
+
+	ts, sig = sign(other, "00:00:00:00:00:01", time.Now())
+	assert.ErrorIs(t, Verify("n1", "00:00:00:00:00:01", ts, sig), ErrSignature)
+}
+
+func Test_Rotate(t *testing.T) {
+	env := testenv.New(t)
+	defer env.RemoveAll()
+
+	old, err := Get("n1")
+	require.NoError(t, err)
+	require.NoError(t, Rotate("n1", false))
+	secret, err := Get("n1")
+	require.NoError(t, err)
+	assert.NotEqual(t, old, secret)
+
+	// the previous secret is valid until the new one is used
+	ts, sig := sign(old, "00:00:00:00:00:01", time.Now())
+	assert.NoError(t, Verify("n1", "00:00:00:00:00:01", ts, sig))
+	ts, sig = sign(secret, "00:00:00:00:00:01", time.Now())
+	assert.NoError(t, Verify("n1", "00:00:00:00:00:01", ts, sig))
+	tokens, err := List()
+	require.NoError(t, err)
+	assert.Empty(t, tokens["n1"].Previous)
+	ts, sig = sign(old, "00:00:00:00:00:01", time.Now())
+	assert.ErrorIs(t, Verify("n1", "00:00:00:00:00:01", ts, sig), ErrSignature)
+
+	// revoking invalidates the previous secret at once
+	require.NoError(t, Rotate("n1", true))
+	ts, sig = sign(secret, "00:00:00:00:00:01", time.Now())
+	assert.ErrorIs(t, Verify("n1", "00:00:00:00:00:01", ts, sig), ErrSignature)
+}
@@ -16,7 +16,9 @@ import (
 	"github.com/Masterminds/sprig/v3"
 
 	"github.com/warewulf/warewulf/internal/pkg/config"
+	"github.com/warewulf/warewulf/internal/pkg/image"
 	"github.com/warewulf/warewulf/internal/pkg/node"
+	"github.com/warewulf/warewulf/internal/pkg/nodetoken"
 	"github.com/warewulf/warewulf/internal/pkg/util"
 	"github.com/warewulf/warewulf/internal/pkg/wwlog"
 )
@@ -280,7 +282,8 @@ func BuildOverlay(nodeConf node.Node, allNodes []node.Node, context string, over
 		[]string{},
 		// ignore cross-device files
 		true,
-		"newc")
+		"newc",
+		config.Get().Warewulf.CompressionFormat())
 
 	return err
 }
@@ -508,6 +511,12 @@ func RenderTemplateFile(fileName string, data TemplateStruct) (
 			return ""
 		},
 		"UniqueField": UniqueField,
+		"NodeToken": func() (string, error) {
+			return nodetoken.Get(data.Id)
+		},
+		"ImageDigest": func() string {
+			return image.Digest(data.ImageName)
+		},
 	}
 
 	// Merge sprig.FuncMap with our FuncMap
@@ -49,6 +49,16 @@ func WriteControl(filename string, pid int, overwrite bool) (int, error) {
 	return pid, os.WriteFile(filename, []byte(fmt.Sprintf("%d\n", pid)), 0644)
 }
 
+// Running returns the pid of the process in a pidfile and whether it is
+// running
+func Running(filename string) (int, bool) {
+	pid, err := pidfileContents(filename)
+	if err != nil {
+		return 0, false
+	}
+	return pid, pidIsRunning(pid)
+}
+
 func pidfileContents(filename string) (int, error) {
 	contents, err := os.ReadFile(filename)
 	if err != nil {
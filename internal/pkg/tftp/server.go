@@ -0,0 +1,328 @@
+/*
+Package tftp implements a read-only TFTP server (RFC 1350) with the
+blksize, tsize and timeout options (RFC 2347, 2348, 2349), as needed by
+PXE firmware to fetch network boot programs.
+*/
+package tftp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	opRRQ   = 1
+	opWRQ   = 2
+	opDATA  = 3
+	opACK   = 4
+	opERROR = 5
+	opOACK  = 6
+)
+
+const (
+	errUndefined        = 0
+	errFileNotFound     = 1
+	errAccessViolation  = 2
+	errIllegalOperation = 4
+	errUnknownTID       = 5
+)
+
+const (
+	defaultBlockSize = 512
+	minBlockSize     = 8
+	maxBlockSize     = 65464
+	// largest request accepted, enough for a file name and options
+	maxRequestSize = 1024
+)
+
+// ErrNotFound is returned by handlers for files which are not served.
+var ErrNotFound = errors.New("file not found")
+
+/*
+Handler opens a requested file. It returns the content of the file and
+its size, which is -1 if it is unknown.
+*/
+type Handler func(filename string, remote net.Addr) (io.ReadCloser, int64, error)
+
+/*
+Server serves the files opened by Handler. Done, if set, is called once
+a transfer has finished, with the number of bytes sent, the duration of
+the transfer and the error which ended it, if any.
+*/
+type Server struct {
+	Handler Handler
+	Done    func(filename string, remote net.Addr, sent int64, duration time.Duration, err error)
+	// time to wait for an acknowledgement before retransmitting
+	Timeout time.Duration
+	// number of retransmissions before a transfer is aborted
+	Retries int
+
+	transfers sync.WaitGroup
+}
+
+type request struct {
+	opcode   uint16
+	filename string
+	mode     string
+	options  map[string]string
+	// order of the options, which is kept in the acknowledgement
+	optionNames []string
+}
+
+/*
+Parses a read or write request
+*/
+func parseRequest(packet []byte) (req request, err error) {
+	if len(packet) < 2 {
+		return req, fmt.Errorf("short packet")
+	}
+	req.opcode = binary.BigEndian.Uint16(packet)
+	if req.opcode != opRRQ && req.opcode != opWRQ {
+		return req, fmt.Errorf("unexpected opcode: %d", req.opcode)
+	}
+	fields := bytes.Split(packet[2:], []byte{0})
+	// the packet ends with a zero byte, so the last field is empty
+	if len(fields) < 3 || len(fields[len(fields)-1]) != 0 {
+		return req, fmt.Errorf("malformed request")
+	}
+	fields = fields[:len(fields)-1]
+	req.filename = string(fields[0])
+	req.mode = strings.ToLower(string(fields[1]))
+	if req.filename == "" {
+		return req, fmt.Errorf("missing file name")
+	}
+	req.options = make(map[string]string)
+	opts := fields[2:]
+	if len(opts)%2 != 0 {
+		return req, fmt.Errorf("malformed options")
+	}
+	for i := 0; i < len(opts); i += 2 {
+		name := strings.ToLower(string(opts[i]))
+		if _, ok := req.options[name]; !ok {
+			req.optionNames = append(req.optionNames, name)
+		}
+		req.options[name] = string(opts[i+1])
+	}
+	return req, nil
+}
+
+func errorPacket(code uint16, msg string) []byte {
+	packet := make([]byte, 4, 5+len(msg))
+	binary.BigEndian.PutUint16(packet, opERROR)
+	binary.BigEndian.PutUint16(packet[2:], code)
+	packet = append(packet, msg...)
+	return append(packet, 0)
+}
+
+func oackPacket(names []string, values map[string]string) []byte {
+	packet := []byte{0, opOACK}
+	for _, name := range names {
+		if value, ok := values[name]; ok {
+			packet = append(packet, name...)
+			packet = append(packet, 0)
+			packet = append(packet, value...)
+			packet = append(packet, 0)
+		}
+	}
+	return packet
+}
+
+func dataPacket(block uint16, data []byte) []byte {
+	packet := make([]byte, 4, 4+len(data))
+	binary.BigEndian.PutUint16(packet, opDATA)
+	binary.BigEndian.PutUint16(packet[2:], block)
+	return append(packet, data...)
+}
+
+/*
+Serves requests received on conn until it is closed. Every transfer is
+handled on its own socket, as required by the protocol.
+*/
+func (s *Server) Serve(conn net.PacketConn) error {
+	buf := make([]byte, maxRequestSize)
+	for {
+		n, remote, err := conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				s.transfers.Wait()
+				return nil
+			}
+			return err
+		}
+		req, err := parseRequest(buf[:n])
+		if err != nil {
+			_, _ = conn.WriteTo(errorPacket(errIllegalOperation, err.Error()), remote)
+			continue
+		}
+		s.transfers.Add(1)
+		go func() {
+			defer s.transfers.Done()
+			s.transfer(conn.LocalAddr(), remote, req)
+		}()
+	}
+}
+
+func (s *Server) timeout() time.Duration {
+	if s.Timeout > 0 {
+		return s.Timeout
+	}
+	return time.Second
+}
+
+func (s *Server) retries() int {
+	if s.Retries > 0 {
+		return s.Retries
+	}
+	return 5
+}
+
+/*
+Sends a file to remote from a new socket on the address on which the
+request was received
+*/
+func (s *Server) transfer(local net.Addr, remote net.Addr, req request) {
+	start := time.Now()
+	var localIP net.IP
+	if addr, ok := local.(*net.UDPAddr); ok && !addr.IP.IsUnspecified() {
+		localIP = addr.IP
+	}
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: localIP})
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	if req.opcode == opWRQ {
+		_, _ = conn.WriteTo(errorPacket(errAccessViolation, "read-only server"), remote)
+		return
+	}
+	if req.mode != "octet" && req.mode != "netascii" {
+		_, _ = conn.WriteTo(errorPacket(errIllegalOperation, "unsupported mode: "+req.mode), remote)
+		return
+	}
+
+	file, size, err := s.Handler(req.filename, remote)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			_, _ = conn.WriteTo(errorPacket(errFileNotFound, "file not found"), remote)
+		} else {
+			_, _ = conn.WriteTo(errorPacket(errUndefined, err.Error()), remote)
+		}
+		s.done(req.filename, remote, 0, time.Since(start), err)
+		return
+	}
+	defer file.Close()
+
+	t := &transfer{conn: conn, remote: remote, timeout: s.timeout(), retries: s.retries()}
+	sent, err := t.send(file, size, req)
+	s.done(req.filename, remote, sent, time.Since(start), err)
+}
+
+func (s *Server) done(filename string, remote net.Addr, sent int64, duration time.Duration, err error) {
+	if s.Done != nil {
+		s.Done(filename, remote, sent, duration, err)
+	}
+}
+
+type transfer struct {
+	conn    *net.UDPConn
+	remote  net.Addr
+	timeout time.Duration
+	retries int
+}
+
+/*
+Negotiates the options of the request and sends the content of file
+*/
+func (t *transfer) send(file io.Reader, size int64, req request) (sent int64, err error) {
+	blockSize := defaultBlockSize
+	accepted := make(map[string]string)
+	if value, ok := req.options["blksize"]; ok {
+		if n, err := strconv.Atoi(value); err == nil && n >= minBlockSize {
+			blockSize = min(n, maxBlockSize)
+			accepted["blksize"] = strconv.Itoa(blockSize)
+		}
+	}
+	if _, ok := req.options["tsize"]; ok && size >= 0 {
+		accepted["tsize"] = strconv.FormatInt(size, 10)
+	}
+	if value, ok := req.options["timeout"]; ok {
+		if n, err := strconv.Atoi(value); err == nil && n >= 1 && n <= 255 {
+			t.timeout = time.Duration(n) * time.Second
+			accepted["timeout"] = value
+		}
+	}
+	if len(accepted) > 0 {
+		if err := t.sendAndWait(oackPacket(req.optionNames, accepted), 0); err != nil {
+			return 0, err
+		}
+	}
+
+	data := make([]byte, blockSize)
+	for block := uint16(1); ; block++ {
+		n, err := io.ReadFull(file, data)
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			_, _ = t.conn.WriteTo(errorPacket(errUndefined, "read error"), t.remote)
+			return sent, err
+		}
+		if err := t.sendAndWait(dataPacket(block, data[:n]), block); err != nil {
+			return sent, err
+		}
+		sent += int64(n)
+		if n < blockSize {
+			return sent, nil
+		}
+	}
+}
+
+/*
+Sends packet and waits for the acknowledgement of block, retransmitting
+the packet on timeouts
+*/
+func (t *transfer) sendAndWait(packet []byte, block uint16) error {
+	buf := make([]byte, maxRequestSize)
+	for attempt := 0; attempt <= t.retries; attempt++ {
+		if _, err := t.conn.WriteTo(packet, t.remote); err != nil {
+			return err
+		}
+		deadline := time.Now().Add(t.timeout)
+		for {
+			if err := t.conn.SetReadDeadline(deadline); err != nil {
+				return err
+			}
+			n, addr, err := t.conn.ReadFrom(buf)
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				break
+			} else if err != nil {
+				return err
+			}
+			if addr.String() != t.remote.String() {
+				_, _ = t.conn.WriteTo(errorPacket(errUnknownTID, "unknown transfer id"), addr)
+				continue
+			}
+			if n < 4 {
+				continue
+			}
+			switch binary.BigEndian.Uint16(buf) {
+			case opACK:
+				// duplicate acknowledgements of earlier blocks are
+				// ignored instead of retransmitting again
+				if binary.BigEndian.Uint16(buf[2:]) == block {
+					return nil
+				}
+			case opERROR:
+				return fmt.Errorf("transfer aborted by client: %s", strings.TrimRight(string(buf[4:n]), "\x00"))
+			}
+		}
+	}
+	return fmt.Errorf("timeout waiting for acknowledgement of block %d", block)
+}
@@ -0,0 +1,194 @@
+package tftp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func rrq(opcode uint16, filename string, options ...string) []byte {
+	packet := binary.BigEndian.AppendUint16(nil, opcode)
+	for _, field := range append([]string{filename, "octet"}, options...) {
+		packet = append(packet, field...)
+		packet = append(packet, 0)
+	}
+	return packet
+}
+
+func ack(block uint16) []byte {
+	return binary.BigEndian.AppendUint16(binary.BigEndian.AppendUint16(nil, opACK), block)
+}
+
+/*
+Starts a server on the loopback interface which serves the given files
+*/
+func startServer(t *testing.T, files map[string]string) (addr net.Addr, done chan int64) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	done = make(chan int64, 10)
+	server := &Server{
+		Handler: func(filename string, remote net.Addr) (io.ReadCloser, int64, error) {
+			content, ok := files[filename]
+			if !ok {
+				return nil, 0, ErrNotFound
+			}
+			return io.NopCloser(strings.NewReader(content)), int64(len(content)), nil
+		},
+		Done: func(filename string, remote net.Addr, sent int64, duration time.Duration, err error) {
+			done <- sent
+		},
+		Timeout: 100 * time.Millisecond,
+		Retries: 2,
+	}
+	go func() {
+		_ = server.Serve(conn)
+	}()
+	t.Cleanup(func() { conn.Close() })
+	return conn.LocalAddr(), done
+}
+
+type client struct {
+	t      *testing.T
+	conn   net.PacketConn
+	server net.Addr
+}
+
+func newClient(t *testing.T, server net.Addr) *client {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return &client{t: t, conn: conn, server: server}
+}
+
+func (c *client) send(packet []byte) {
+	_, err := c.conn.WriteTo(packet, c.server)
+	require.NoError(c.t, err)
+}
+
+func (c *client) receive() (opcode uint16, arg uint16, payload []byte) {
+	buf := make([]byte, 70000)
+	require.NoError(c.t, c.conn.SetReadDeadline(time.Now().Add(2*time.Second)))
+	n, addr, err := c.conn.ReadFrom(buf)
+	require.NoError(c.t, err)
+	// further packets of the transfer go to its own socket
+	c.server = addr
+	return binary.BigEndian.Uint16(buf), binary.BigEndian.Uint16(buf[2:]), buf[4:n]
+}
+
+/*
+Receives DATA packets until the last one and returns the content
+*/
+func (c *client) download(blockSize int) string {
+	var content bytes.Buffer
+	for expected := uint16(1); ; expected++ {
+		opcode, block, data := c.receive()
+		require.Equal(c.t, uint16(opDATA), opcode)
+		require.Equal(c.t, expected, block)
+		content.Write(data)
+		c.send(ack(block))
+		if len(data) < blockSize {
+			return content.String()
+		}
+	}
+}
+
+func Test_parseRequest(t *testing.T) {
+	req, err := parseRequest(rrq(opRRQ, "warewulf/shim.efi", "BLKSIZE", "1468", "tsize", "0"))
+	assert.NoError(t, err)
+	assert.Equal(t, "warewulf/shim.efi", req.filename)
+	assert.Equal(t, "octet", req.mode)
+	assert.Equal(t, map[string]string{"blksize": "1468", "tsize": "0"}, req.options)
+	assert.Equal(t, []string{"blksize", "tsize"}, req.optionNames)
+
+	for name, packet := range map[string][]byte{
+		"short":            {0},
+		"data":             dataPacket(1, []byte("data")),
+		"unterminated":     []byte("\x00\x01file\x00octet"),
+		"missing mode":     []byte("\x00\x01file\x00"),
+		"odd options":      rrq(opRRQ, "file", "blksize"),
+		"empty file name":  rrq(opRRQ, ""),
+		"missing filename": {0, 1, 0},
+	} {
+		_, err := parseRequest(packet)
+		assert.Error(t, err, name)
+	}
+}
+
+func Test_Serve(t *testing.T) {
+	files := map[string]string{
+		"small":  "hello",
+		"blocks": strings.Repeat("a", 1024),
+		"large":  strings.Repeat("b", 3000),
+	}
+	addr, done := startServer(t, files)
+
+	t.Run("default block size", func(t *testing.T) {
+		c := newClient(t, addr)
+		c.send(rrq(opRRQ, "large"))
+		assert.Equal(t, files["large"], c.download(defaultBlockSize))
+		assert.Equal(t, int64(3000), <-done)
+	})
+
+	t.Run("multiple of block size", func(t *testing.T) {
+		c := newClient(t, addr)
+		c.send(rrq(opRRQ, "blocks"))
+		// ends with an empty block
+		assert.Equal(t, files["blocks"], c.download(defaultBlockSize))
+		assert.Equal(t, int64(1024), <-done)
+	})
+
+	t.Run("options", func(t *testing.T) {
+		c := newClient(t, addr)
+		c.send(rrq(opRRQ, "large", "blksize", "1468", "tsize", "0", "unknown", "1"))
+		opcode, _, _ := c.receive()
+		require.Equal(t, uint16(opOACK), opcode)
+		c.send(ack(0))
+		assert.Equal(t, files["large"], c.download(1468))
+		<-done
+	})
+
+	t.Run("option acknowledgement", func(t *testing.T) {
+		req, err := parseRequest(rrq(opRRQ, "small", "tsize", "0", "blksize", "100000"))
+		require.NoError(t, err)
+		accepted := map[string]string{"tsize": "5", "blksize": "65464"}
+		assert.Equal(t, []byte("\x00\x06tsize\x005\x00blksize\x0065464\x00"), oackPacket(req.optionNames, accepted))
+	})
+
+	t.Run("retransmission", func(t *testing.T) {
+		c := newClient(t, addr)
+		c.send(rrq(opRRQ, "small"))
+		opcode, block, data := c.receive()
+		require.Equal(t, uint16(opDATA), opcode)
+		// without an acknowledgement the block is sent again
+		opcode2, block2, data2 := c.receive()
+		assert.Equal(t, opcode, opcode2)
+		assert.Equal(t, block, block2)
+		assert.Equal(t, data, data2)
+		c.send(ack(block))
+		assert.Equal(t, int64(5), <-done)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		c := newClient(t, addr)
+		c.send(rrq(opRRQ, "missing"))
+		opcode, code, _ := c.receive()
+		assert.Equal(t, uint16(opERROR), opcode)
+		assert.Equal(t, uint16(errFileNotFound), code)
+		<-done
+	})
+
+	t.Run("write request", func(t *testing.T) {
+		c := newClient(t, addr)
+		c.send(rrq(opWRQ, "small"))
+		opcode, code, _ := c.receive()
+		assert.Equal(t, uint16(opERROR), opcode)
+		assert.Equal(t, uint16(errAccessViolation), code)
+	})
+}
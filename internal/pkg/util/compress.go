@@ -0,0 +1,137 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/warewulf/warewulf/internal/pkg/wwlog"
+)
+
+// Compression formats of images and overlays
+const (
+	CompressGzip = "gzip"
+	CompressZstd = "zstd"
+	CompressNone = "none"
+)
+
+// CompressFormats lists the formats which have a compressed variant of
+// an image file.
+var CompressFormats = []string{CompressGzip, CompressZstd}
+
+/*
+Returns the name of the variant of file compressed in the given format
+*/
+func CompressedFile(file string, format string) string {
+	switch format {
+	case CompressGzip:
+		return file + ".gz"
+	case CompressZstd:
+		return file + ".zst"
+	}
+	return file
+}
+
+/*
+Returns the value of the compress parameter of provisioning requests for
+the given format
+*/
+func CompressParam(format string) string {
+	switch format {
+	case CompressGzip:
+		return "gz"
+	case CompressZstd:
+		return "zstd"
+	}
+	return ""
+}
+
+/*
+Returns the format requested by the compress parameter of a provisioning
+request, or false if the format is unknown
+*/
+func CompressFormat(param string) (format string, ok bool) {
+	switch param {
+	case "":
+		return CompressNone, true
+	case "gz":
+		return CompressGzip, true
+	case "zstd":
+		return CompressZstd, true
+	}
+	return "", false
+}
+
+/*
+******************************************************************************
+
+	Compress a file using zstd
+*/
+func FileZstd(
+	file string) (err error) {
+
+	file_zst := CompressedFile(file, CompressZstd)
+
+	compressor, err := exec.LookPath("zstd")
+	if err != nil {
+		wwlog.Verbose("Could not locate ZSTD")
+		return fmt.Errorf("no compressor program for image file: %s: %w", file_zst, err)
+	}
+
+	wwlog.Verbose("Using compressor program: %s", compressor)
+
+	proc := exec.Command(
+		compressor,
+		"--quiet",
+		"--force",
+		"-T0",
+		"-o", file_zst,
+		file)
+
+	out, err := proc.CombinedOutput()
+	if len(out) > 0 {
+		wwlog.Debug(string(out))
+	}
+	if err != nil {
+		os.Remove(file_zst)
+		return fmt.Errorf("unable to successfully create compressed image file: %s: %w", file_zst, err)
+	}
+
+	return nil
+}
+
+/*
+Creates the variant of file compressed in the given format. The gzip
+variant is created as well, as iPXE and nodes which were set up for gzip
+keep requesting it. Variants in other formats are removed, so that no
+stale image is served.
+*/
+func CompressFile(file string, format string) error {
+	keep := map[string]bool{}
+	switch format {
+	case CompressGzip, CompressZstd:
+		keep[format] = true
+		keep[CompressGzip] = true
+	case CompressNone:
+	default:
+		return fmt.Errorf("unknown compression format: %s", format)
+	}
+
+	for _, other := range CompressFormats {
+		if keep[other] {
+			continue
+		}
+		if err := os.Remove(CompressedFile(file, other)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("could not remove existing file: %s: %w", CompressedFile(file, other), err)
+		}
+	}
+	if keep[CompressZstd] {
+		if err := FileZstd(file); err != nil {
+			return err
+		}
+	}
+	if keep[CompressGzip] {
+		return FileGz(file)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package util
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/warewulf/warewulf/internal/pkg/testenv"
+)
+
+func Test_CompressFormat(t *testing.T) {
+	for _, format := range []string{CompressGzip, CompressZstd, CompressNone} {
+		parsed, ok := CompressFormat(CompressParam(format))
+		assert.True(t, ok)
+		assert.Equal(t, format, parsed)
+	}
+	_, ok := CompressFormat("xz")
+	assert.False(t, ok)
+
+	assert.Equal(t, "image.img.gz", CompressedFile("image.img", CompressGzip))
+	assert.Equal(t, "image.img.zst", CompressedFile("image.img", CompressZstd))
+	assert.Equal(t, "image.img", CompressedFile("image.img", CompressNone))
+}
+
+func Test_CompressFile(t *testing.T) {
+	env := testenv.New(t)
+	defer env.RemoveAll()
+	env.WriteFile("image.img", "image")
+	env.WriteFile("image.img.gz", "stale")
+	env.WriteFile("image.img.zst", "stale")
+	file := env.GetPath("image.img")
+
+	assert.NoError(t, CompressFile(file, CompressNone))
+	assert.FileExists(t, file)
+	assert.NoFileExists(t, file+".gz")
+	assert.NoFileExists(t, file+".zst")
+
+	assert.Error(t, CompressFile(file, "xz"))
+
+	for _, format := range CompressFormats {
+		t.Run(format, func(t *testing.T) {
+			if _, err := exec.LookPath(format); err != nil {
+				t.Skipf("%s not available", format)
+			}
+			if _, err := exec.LookPath(CompressGzip); err != nil {
+				t.Skipf("%s not available", CompressGzip)
+			}
+			env.WriteFile("image.img.gz", "stale")
+			env.WriteFile("image.img.zst", "stale")
+			assert.NoError(t, CompressFile(file, format))
+			assert.FileExists(t, CompressedFile(file, format))
+			// the gzip variant is kept for nodes which still request it
+			assert.FileExists(t, CompressedFile(file, CompressGzip))
+			if format == CompressGzip {
+				assert.NoFileExists(t, CompressedFile(file, CompressZstd))
+			}
+			for _, variant := range []string{CompressGzip, format} {
+				out, err := exec.Command(variant, "-dc", CompressedFile(file, variant)).Output()
+				assert.NoError(t, err)
+				assert.Equal(t, "image", string(out))
+			}
+			_, err := os.Stat(file)
+			assert.NoError(t, err)
+		})
+	}
+}
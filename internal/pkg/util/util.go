@@ -509,6 +509,7 @@ func BuildFsImage(
 	ignore []string,
 	ignore_xdev bool,
 	format string,
+	compression string,
 	cpio_args ...string) (err error) {
 
 	err = os.MkdirAll(path.Dir(imagePath), 0755)
@@ -538,12 +539,15 @@ func BuildFsImage(
 
 	wwlog.Info("Created image for %s: %s", name, imagePath)
 
-	err = FileGz(imagePath)
+	compressedPath := CompressedFile(imagePath, compression)
+	err = CompressFile(imagePath, compression)
 	if err != nil {
-		return fmt.Errorf("failed to compress image for %s: %s: %w", name, imagePath+".gz", err)
+		return fmt.Errorf("failed to compress image for %s: %s: %w", name, compressedPath, err)
 	}
 
-	wwlog.Info("Compressed image for %s: %s", name, imagePath+".gz")
+	if compression != CompressNone {
+		wwlog.Info("Compressed image for %s: %s", name, compressedPath)
+	}
 
 	return nil
 }
@@ -0,0 +1,151 @@
+package warewulfd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+
+	warewulfconf "github.com/warewulf/warewulf/internal/pkg/config"
+	"github.com/warewulf/warewulf/internal/pkg/wwlog"
+)
+
+/*
+Structured access log of the provisioning requests, written as one JSON
+object per line to the file configured in warewulf.conf. The file is
+rotated by size and reopened when warewulfd is reloaded.
+*/
+
+type accessEntry struct {
+	Time     string  `json:"time"`
+	Ipaddr   string  `json:"ipaddr"`
+	Port     int     `json:"port"`
+	Hwaddr   string  `json:"hwaddr"`
+	Node     string  `json:"node"`
+	Stage    string  `json:"stage"`
+	Overlay  string  `json:"overlay"`
+	File     string  `json:"file"`
+	Bytes    int64   `json:"bytes"`
+	Duration float64 `json:"duration"`
+	Status   int     `json:"status"`
+	Reason   string  `json:"reason"`
+}
+
+type accessLogger struct {
+	lock sync.Mutex
+	conf warewulfconf.AccessLogConf
+	file *os.File
+	size int64
+}
+
+var accessLog = &accessLogger{}
+
+/*
+Opens the access log with the given configuration, closing the
+previously opened file. An empty path disables the access log.
+*/
+func (l *accessLogger) configure(conf warewulfconf.AccessLogConf) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.close()
+	l.conf = conf
+	if !conf.Enabled() {
+		return nil
+	}
+	return l.open()
+}
+
+func (l *accessLogger) open() error {
+	if err := os.MkdirAll(path.Dir(l.conf.Path), 0o755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(l.conf.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o640)
+	if err != nil {
+		return fmt.Errorf("could not open access log: %w", err)
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("could not open access log: %w", err)
+	}
+	l.file = file
+	l.size = stat.Size()
+	return nil
+}
+
+func (l *accessLogger) close() {
+	if l.file != nil {
+		l.file.Close()
+		l.file = nil
+	}
+}
+
+/*
+Renames the access log to <path>.1, shifting older logs up to the
+configured number of backups, and opens a new file
+*/
+func (l *accessLogger) rotate() error {
+	l.close()
+	backups := l.conf.Backups()
+	if err := os.Remove(fmt.Sprintf("%s.%d", l.conf.Path, backups)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for i := backups - 1; i > 0; i-- {
+		if err := os.Rename(fmt.Sprintf("%s.%d", l.conf.Path, i), fmt.Sprintf("%s.%d", l.conf.Path, i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(l.conf.Path, l.conf.Path+".1"); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return l.open()
+}
+
+func (l *accessLogger) log(entry accessEntry) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.file == nil {
+		return
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		wwlog.Warn("Could not marshal access log entry: %s", err)
+		return
+	}
+	data = append(data, '\n')
+	if maxSize := l.conf.MaxSizeBytes(); maxSize > 0 && l.size > 0 && l.size+int64(len(data)) > maxSize {
+		if err := l.rotate(); err != nil {
+			wwlog.Error("Could not rotate access log: %s", err)
+			if l.file == nil {
+				return
+			}
+		}
+	}
+	n, err := l.file.Write(data)
+	l.size += int64(n)
+	if err != nil {
+		wwlog.Warn("Could not write access log: %s", err)
+	}
+}
+
+/*
+Completes the access log entry of a request from the status writer once
+the request was served and writes it. Handlers fill in the node, stage,
+file and the reason of a refusal as far as they get.
+*/
+func logAccess(req *http.Request, sw *statusWriter, start time.Time, entry *accessEntry) {
+	entry.Time = start.Format(time.RFC3339Nano)
+	entry.Bytes = sw.bytes
+	entry.Duration = time.Since(start).Seconds()
+	entry.Status = sw.Status()
+	if host, port, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		entry.Ipaddr = host
+		entry.Port, _ = strconv.Atoi(port)
+	}
+	accessLog.log(*entry)
+}
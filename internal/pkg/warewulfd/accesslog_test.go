@@ -0,0 +1,117 @@
+package warewulfd
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	warewulfconf "github.com/warewulf/warewulf/internal/pkg/config"
+	"github.com/warewulf/warewulf/internal/pkg/testenv"
+)
+
+func readAccessLog(t *testing.T, fileName string) (entries []accessEntry) {
+	file, err := os.Open(fileName)
+	require.NoError(t, err)
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry accessEntry
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+		entries = append(entries, entry)
+	}
+	require.NoError(t, scanner.Err())
+	return entries
+}
+
+func Test_accessLoggerRotate(t *testing.T) {
+	env := testenv.New(t)
+	defer env.RemoveAll()
+	logFile := env.GetPath("var/log/warewulfd/access.log")
+
+	l := &accessLogger{}
+	require.NoError(t, l.configure(warewulfconf.AccessLogConf{Path: logFile, MaxSize: 1, MaxBackups: 2}))
+	defer func() { _ = l.configure(warewulfconf.AccessLogConf{}) }()
+
+	overlay := strings.Repeat("o", 400*1000)
+	for i := 0; i < 8; i++ {
+		l.log(accessEntry{Node: "n1", Overlay: overlay})
+	}
+	// two entries fit into each file, the oldest ones were dropped
+	assert.Len(t, readAccessLog(t, logFile), 2)
+	assert.Len(t, readAccessLog(t, logFile+".1"), 2)
+	assert.Len(t, readAccessLog(t, logFile+".2"), 2)
+	assert.NoFileExists(t, logFile+".3")
+}
+
+func Test_ProvisionSendAccessLog(t *testing.T) {
+	env := provisionTestEnv(t, `nodes:
+  n1:
+    asset key: secret
+    network devices:
+      default:
+        hwaddr: 00:00:00:ff:ff:ff`, "n1")
+	overlayDir := path.Join(warewulfconf.Get().Paths.OverlayProvisiondir(), "n1")
+
+	logFile := env.GetPath("var/log/warewulfd/access.log")
+	require.NoError(t, accessLog.configure(warewulfconf.AccessLogConf{Path: logFile}))
+	defer func() { _ = accessLog.configure(warewulfconf.AccessLogConf{}) }()
+
+	for _, url := range []string{
+		"/provision/00:00:00:ff:ff:ff?stage=system&assetkey=secret",
+		"/provision/00:00:00:ff:ff:ff?stage=system&assetkey=wrong",
+	} {
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		req.RemoteAddr = "10.10.10.10:987"
+		ProvisionSend(httptest.NewRecorder(), req)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/health/00:00:00:ff:ff:ff", strings.NewReader("{}"))
+	req.RemoteAddr = "10.10.10.10:987"
+	HealthReceive(httptest.NewRecorder(), req)
+
+	entries := readAccessLog(t, logFile)
+	require.Len(t, entries, 3)
+	for i := range entries {
+		assert.NotEmpty(t, entries[i].Time)
+		entries[i].Time = ""
+		entries[i].Duration = 0
+	}
+	assert.Equal(t, []accessEntry{
+		{
+			Ipaddr: "10.10.10.10",
+			Port:   987,
+			Hwaddr: "00:00:00:ff:ff:ff",
+			Node:   "n1",
+			Stage:  "system",
+			File:   path.Join(overlayDir, "__SYSTEM__.img"),
+			Bytes:  14,
+			Status: 200,
+		},
+		{
+			Ipaddr: "10.10.10.10",
+			Port:   987,
+			Hwaddr: "00:00:00:ff:ff:ff",
+			Node:   "n1",
+			Stage:  "system",
+			Status: 401,
+			Reason: "BAD_ASSET",
+		},
+		{
+			Ipaddr: "10.10.10.10",
+			Port:   987,
+			Hwaddr: "00:00:00:ff:ff:ff",
+			Node:   "n1",
+			Stage:  "health",
+			Status: 401,
+			Reason: "BAD_ASSET",
+		},
+	}, entries)
+}
@@ -0,0 +1,246 @@
+package warewulfd
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	warewulfconf "github.com/warewulf/warewulf/internal/pkg/config"
+)
+
+/*
+Admission control for the transfers of kernels, images and overlays.
+When many nodes boot at the same time the number of concurrent transfers
+is limited, further requests wait in a queue for a free slot and are
+refused once the queue is full. Optionally the aggregate bandwidth of all
+transfers is capped.
+*/
+
+// stages whose transfers are subject to admission control
+var transferStages = map[string]bool{
+	"kernel":    true,
+	"image":     true,
+	"initramfs": true,
+	"system":    true,
+	"runtime":   true,
+}
+
+// size of the chunks in which bandwidth limited transfers are written
+const bandwidthChunk = 64 * 1024
+
+var errQueueFull = errors.New("transfer queue is full")
+
+type transferWaiter struct {
+	stage string
+	ready chan struct{}
+}
+
+type admissionControl struct {
+	lock    sync.Mutex
+	conf    warewulfconf.TransfersConf
+	active  map[string]int
+	total   int
+	waiting []*transferWaiter
+	// time at which the next chunk may be sent with a bandwidth cap
+	next time.Time
+}
+
+type stageTransfers struct {
+	Active  int `json:"active"`
+	Waiting int `json:"waiting"`
+}
+
+type transferStatus struct {
+	Active  int                        `json:"active"`
+	Waiting int                        `json:"waiting"`
+	Stages  map[string]*stageTransfers `json:"stages"`
+}
+
+var transfers = newAdmissionControl()
+
+func newAdmissionControl() *admissionControl {
+	return &admissionControl{active: make(map[string]int)}
+}
+
+/*
+Returns true if a transfer of the given stage can start without
+exceeding the configured limits
+*/
+func (a *admissionControl) fits(stage string) bool {
+	if a.conf.MaxConcurrent > 0 && a.total >= a.conf.MaxConcurrent {
+		return false
+	}
+	if limit := a.conf.Stages[stage]; limit > 0 && a.active[stage] >= limit {
+		return false
+	}
+	return true
+}
+
+func (a *admissionControl) start(stage string) {
+	a.active[stage]++
+	a.total++
+}
+
+func (a *admissionControl) finish(stage string) {
+	a.active[stage]--
+	a.total--
+	a.admit()
+}
+
+/*
+Starts the transfers of all waiting requests which fit into the limits,
+in the order in which they arrived
+*/
+func (a *admissionControl) admit() {
+	var remaining []*transferWaiter
+	for _, w := range a.waiting {
+		if a.fits(w.stage) {
+			a.start(w.stage)
+			close(w.ready)
+		} else {
+			remaining = append(remaining, w)
+		}
+	}
+	a.waiting = remaining
+}
+
+func (a *admissionControl) releaseFunc(stage string) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			a.lock.Lock()
+			defer a.lock.Unlock()
+			a.finish(stage)
+		})
+	}
+}
+
+/*
+Waits for a free transfer slot for the given stage. The returned function
+must be called once the transfer is done. Returns errQueueFull if the
+request can't even be queued, or the error of the context if the client
+gave up while waiting.
+*/
+func (a *admissionControl) acquire(ctx context.Context, stage string, conf warewulfconf.TransfersConf) (release func(), err error) {
+	a.lock.Lock()
+	a.conf = conf
+	if a.fits(stage) {
+		a.start(stage)
+		a.lock.Unlock()
+		return a.releaseFunc(stage), nil
+	}
+	if len(a.waiting) >= conf.MaxQueue {
+		a.lock.Unlock()
+		return nil, errQueueFull
+	}
+	w := &transferWaiter{stage: stage, ready: make(chan struct{})}
+	a.waiting = append(a.waiting, w)
+	a.lock.Unlock()
+
+	select {
+	case <-w.ready:
+		return a.releaseFunc(stage), nil
+	case <-ctx.Done():
+		a.lock.Lock()
+		defer a.lock.Unlock()
+		select {
+		case <-w.ready:
+			// admitted just as the client gave up
+			a.finish(stage)
+		default:
+			for i := range a.waiting {
+				if a.waiting[i] == w {
+					a.waiting = append(a.waiting[:i], a.waiting[i+1:]...)
+					break
+				}
+			}
+		}
+		return nil, ctx.Err()
+	}
+}
+
+/*
+Blocks until n bytes may be sent without exceeding rate bytes per
+second over all transfers
+*/
+func (a *admissionControl) waitBandwidth(ctx context.Context, n int, rate int64) error {
+	a.lock.Lock()
+	now := time.Now()
+	if a.next.Before(now) {
+		a.next = now
+	}
+	delay := a.next.Sub(now)
+	a.next = a.next.Add(time.Duration(float64(n) / float64(rate) * float64(time.Second)))
+	a.lock.Unlock()
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+/*
+Returns a writer which shares the configured bandwidth cap with all
+other transfers, or w if there is no cap
+*/
+func (a *admissionControl) limitWriter(ctx context.Context, w http.ResponseWriter, conf warewulfconf.TransfersConf) http.ResponseWriter {
+	rate := conf.BandwidthBytes()
+	if rate <= 0 {
+		return w
+	}
+	return &limitedWriter{ResponseWriter: w, ctx: ctx, admission: a, rate: rate}
+}
+
+func (a *admissionControl) status() *transferStatus {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	ret := &transferStatus{
+		Active:  a.total,
+		Waiting: len(a.waiting),
+		Stages:  make(map[string]*stageTransfers),
+	}
+	for stage := range transferStages {
+		ret.Stages[stage] = &stageTransfers{Active: a.active[stage]}
+	}
+	for _, w := range a.waiting {
+		ret.Stages[w.stage].Waiting++
+	}
+	return ret
+}
+
+/*
+wrapper for http.ResponseWriter which writes in chunks, each of them
+waiting for its share of the bandwidth cap. It deliberately doesn't
+implement io.ReaderFrom, so that files are copied through Write.
+*/
+type limitedWriter struct {
+	http.ResponseWriter
+	ctx       context.Context
+	admission *admissionControl
+	rate      int64
+}
+
+func (w *limitedWriter) Write(b []byte) (sent int, err error) {
+	for len(b) > 0 {
+		chunk := min(len(b), bandwidthChunk)
+		if err = w.admission.waitBandwidth(w.ctx, chunk, w.rate); err != nil {
+			return sent, err
+		}
+		var n int
+		n, err = w.ResponseWriter.Write(b[:chunk])
+		sent += n
+		if err != nil {
+			return sent, err
+		}
+		b = b[chunk:]
+	}
+	return sent, nil
+}
@@ -0,0 +1,138 @@
+package warewulfd
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	warewulfconf "github.com/warewulf/warewulf/internal/pkg/config"
+)
+
+func Test_admissionControl(t *testing.T) {
+	a := newAdmissionControl()
+	conf := warewulfconf.TransfersConf{
+		MaxConcurrent: 2,
+		Stages:        map[string]int{"image": 1},
+		MaxQueue:      1,
+	}
+
+	releaseImage, err := a.acquire(context.Background(), "image", conf)
+	require.NoError(t, err)
+	releaseKernel, err := a.acquire(context.Background(), "kernel", conf)
+	require.NoError(t, err)
+
+	admitted := make(chan func())
+	go func() {
+		release, err := a.acquire(context.Background(), "image", conf)
+		assert.NoError(t, err)
+		admitted <- release
+	}()
+	assert.Eventually(t, func() bool { return a.status().Waiting == 1 }, time.Second, 10*time.Millisecond)
+
+	_, err = a.acquire(context.Background(), "kernel", conf)
+	assert.ErrorIs(t, err, errQueueFull)
+
+	status := a.status()
+	assert.Equal(t, 2, status.Active)
+	assert.Equal(t, 1, status.Stages["image"].Active)
+	assert.Equal(t, 1, status.Stages["image"].Waiting)
+
+	// the global limit has room after the kernel transfer, but the image
+	// stage is still at its limit
+	releaseKernel()
+	select {
+	case <-admitted:
+		t.Fatal("image transfer admitted beyond the stage limit")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	releaseImage()
+	// releasing twice must not free a second slot
+	releaseImage()
+	release := <-admitted
+	assert.Equal(t, 1, a.status().Active)
+	release()
+	assert.Equal(t, 0, a.status().Active)
+}
+
+func Test_admissionControlCancel(t *testing.T) {
+	a := newAdmissionControl()
+	conf := warewulfconf.TransfersConf{MaxConcurrent: 1, MaxQueue: 5}
+
+	release, err := a.acquire(context.Background(), "kernel", conf)
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = a.acquire(ctx, "kernel", conf)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, 0, a.status().Waiting)
+	release()
+	assert.Equal(t, 0, a.status().Active)
+}
+
+func Test_limitWriter(t *testing.T) {
+	a := newAdmissionControl()
+	w := httptest.NewRecorder()
+	assert.Equal(t, w, a.limitWriter(context.Background(), w, warewulfconf.TransfersConf{}))
+
+	limited := a.limitWriter(context.Background(), w, warewulfconf.TransfersConf{MaxBandwidth: 1})
+	start := time.Now()
+	n, err := limited.Write(make([]byte, 3*bandwidthChunk))
+	assert.NoError(t, err)
+	assert.Equal(t, 3*bandwidthChunk, n)
+	assert.Equal(t, 3*bandwidthChunk, w.Body.Len())
+	// 1 MB/s: the third chunk waits for the first two
+	assert.GreaterOrEqual(t, time.Since(start), 2*bandwidthChunk*time.Second/1000000)
+}
+
+func Test_ProvisionSendQueueFull(t *testing.T) {
+	provisionTestEnv(t, `nodes:
+  n1:
+    network devices:
+      default:
+        hwaddr: 00:00:00:ff:ff:ff`, "n1")
+	defer func() {
+		transfers = newAdmissionControl()
+	}()
+
+	conf := warewulfconf.Get()
+	conf.Warewulf.Transfers = warewulfconf.TransfersConf{
+		Stages:     map[string]int{"system": 1},
+		RetryAfter: 30,
+	}
+
+	transfers = newAdmissionControl()
+	release, err := transfers.acquire(context.Background(), "system", conf.Warewulf.Transfers)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/overlay-system/00:00:00:ff:ff:ff", nil)
+	w := httptest.NewRecorder()
+	ProvisionSend(w, req)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "30", w.Header().Get("Retry-After"))
+	assert.Equal(t, "QUEUE_FULL", statusDB.Nodes["n1"].Sent)
+
+	// iPXE asks whether to retry the refused download
+	retryReq := httptest.NewRequest(http.MethodGet, "/provision/00:00:00:ff:ff:ff?stage=retry", nil)
+	w = httptest.NewRecorder()
+	ProvisionSend(w, retryReq)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "#!ipxe\nset retry_after 30\n", w.Body.String())
+
+	release()
+	w = httptest.NewRecorder()
+	ProvisionSend(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "system overlay", w.Body.String())
+	assert.Equal(t, 0, transfers.status().Active)
+
+	// downloads which failed for other reasons aren't retried
+	w = httptest.NewRecorder()
+	ProvisionSend(w, retryReq)
+	assert.Equal(t, "#!ipxe\nset retry_after 0\n", w.Body.String())
+}
@@ -0,0 +1,62 @@
+package warewulfd
+
+import (
+	"sync"
+
+	"github.com/warewulf/warewulf/internal/pkg/bootonce"
+	"github.com/warewulf/warewulf/internal/pkg/node"
+	"github.com/warewulf/warewulf/internal/pkg/wwlog"
+)
+
+/*
+One-shot boot overrides are taken from the pending overrides when the
+boot script of a node (the iPXE script or grub.cfg) is rendered, and
+then apply to the kernel, image and initramfs requests of that boot,
+until the next boot script is rendered.
+*/
+
+var (
+	activeBoot     = make(map[string]bootonce.Override)
+	activeBootLock = sync.Mutex{}
+)
+
+/*
+Returns the node with the boot override for the request applied, if
+there is one
+*/
+func applyBootOnce(n node.Node, rinfo parserInfo) node.Node {
+	nodeID := n.Id()
+	activeBootLock.Lock()
+	defer activeBootLock.Unlock()
+
+	var override bootonce.Override
+	var ok bool
+	switch {
+	case rinfo.stage == "ipxe" || (rinfo.stage == "efiboot" && rinfo.efifile == "grub.cfg"):
+		// the overrides are only locked and rewritten for nodes with an
+		// override, which grub.cfg doesn't consume if it only replaces
+		// the iPXE template
+		pending, found, err := bootonce.Pending(nodeID)
+		if err != nil {
+			wwlog.Error("Could not read boot override of %s: %s", nodeID, err)
+		}
+		if found && (rinfo.stage == "ipxe" || pending.ImageName != "" || len(pending.KernelArgs) > 0) {
+			override, ok, err = bootonce.Take(nodeID)
+			if err != nil {
+				wwlog.Error("Could not read boot override of %s: %s", nodeID, err)
+			}
+		}
+		if ok {
+			activeBoot[nodeID] = override
+			wwlog.Serv("%s (applying boot override: %s)", nodeID, override)
+		} else {
+			delete(activeBoot, nodeID)
+		}
+	case rinfo.stage == "kernel" || rinfo.stage == "image" || rinfo.stage == "initramfs":
+		override, ok = activeBoot[nodeID]
+	}
+	if !ok {
+		return n
+	}
+	return override.Apply(n)
+}
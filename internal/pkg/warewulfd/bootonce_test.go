@@ -0,0 +1,51 @@
+package warewulfd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/warewulf/warewulf/internal/pkg/bootonce"
+	"github.com/warewulf/warewulf/internal/pkg/node"
+	"github.com/warewulf/warewulf/internal/pkg/testenv"
+)
+
+func Test_applyBootOnce(t *testing.T) {
+	env := testenv.New(t)
+	defer env.RemoveAll()
+	defer func() {
+		activeBoot = make(map[string]bootonce.Override)
+	}()
+
+	n := node.NewNode("n1")
+	n.Ipxe = "default"
+	n.ImageName = "rocky"
+	require.NoError(t, bootonce.Set("n1", bootonce.Override{Ipxe: "localdisk", ImageName: "rescue"}))
+
+	// overrides don't apply before the boot script is rendered
+	assert.Equal(t, "rocky", applyBootOnce(n, parserInfo{stage: "image"}).ImageName)
+
+	assert.Equal(t, "localdisk", applyBootOnce(n, parserInfo{stage: "ipxe"}).Ipxe)
+	assert.Equal(t, "rescue", applyBootOnce(n, parserInfo{stage: "kernel"}).ImageName)
+	assert.Equal(t, "rescue", applyBootOnce(n, parserInfo{stage: "image"}).ImageName)
+	assert.Equal(t, "rocky", applyBootOnce(n, parserInfo{stage: "system"}).ImageName)
+	pending, err := bootonce.List()
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+
+	// the next boot uses the settings of the node
+	assert.Equal(t, "default", applyBootOnce(n, parserInfo{stage: "ipxe"}).Ipxe)
+	assert.Equal(t, "rocky", applyBootOnce(n, parserInfo{stage: "image"}).ImageName)
+
+	require.NoError(t, bootonce.Set("n1", bootonce.Override{KernelArgs: []string{"single"}}))
+	applied := applyBootOnce(n, parserInfo{stage: "efiboot", efifile: "grub.cfg"})
+	assert.Equal(t, []string{"single"}, applied.Kernel.Args)
+
+	// grub.cfg has no use for an iPXE template and leaves it pending
+	require.NoError(t, bootonce.Set("n1", bootonce.Override{Ipxe: "localdisk"}))
+	assert.Equal(t, "default", applyBootOnce(n, parserInfo{stage: "efiboot", efifile: "grub.cfg"}).Ipxe)
+	pending, err = bootonce.List()
+	require.NoError(t, err)
+	assert.Contains(t, pending, "n1")
+}
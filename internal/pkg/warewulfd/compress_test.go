@@ -0,0 +1,64 @@
+package warewulfd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	warewulfconf "github.com/warewulf/warewulf/internal/pkg/config"
+)
+
+func Test_ProvisionSendCompress(t *testing.T) {
+	env := provisionTestEnv(t, `nodes:
+  n1:
+    ipxe template: test
+    network devices:
+      default:
+        hwaddr: 00:00:00:ff:ff:ff`, "n1")
+	env.WriteFile("etc/warewulf/ipxe/test.ipxe", "compress={{.Compress}}")
+	writeOverlayImage(t, "n1", "__SYSTEM__.img.zst", "zstd overlay")
+	warewulfconf.Get().Warewulf.Compression = "zstd"
+
+	tests := map[string]struct {
+		url    string
+		status int
+		body   string
+	}{
+		"uncompressed": {
+			url:    "/provision/00:00:00:ff:ff:ff?stage=system",
+			status: 200,
+			body:   "system overlay",
+		},
+		"zstd": {
+			url:    "/provision/00:00:00:ff:ff:ff?stage=system&compress=zstd",
+			status: 200,
+			body:   "zstd overlay",
+		},
+		"missing gzip": {
+			url:    "/provision/00:00:00:ff:ff:ff?stage=system&compress=gz",
+			status: 404,
+		},
+		"unknown compression": {
+			url:    "/provision/00:00:00:ff:ff:ff?stage=system&compress=xz",
+			status: 404,
+		},
+		"ipxe template": {
+			url:    "/provision/00:00:00:ff:ff:ff?stage=ipxe",
+			status: 200,
+			body:   "compress=zstd",
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			w := httptest.NewRecorder()
+			ProvisionSend(w, req)
+			assert.Equal(t, tt.status, w.Code)
+			if tt.status == 200 {
+				assert.Equal(t, tt.body, w.Body.String())
+			}
+		})
+	}
+}
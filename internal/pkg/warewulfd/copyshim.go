@@ -12,6 +12,26 @@ import (
 	"github.com/warewulf/warewulf/internal/pkg/util"
 )
 
+/*
+Returns the shim and grub binaries of the host, by the names under which
+they are provided to the nodes
+*/
+func shimGrubFiles() (map[string]string, error) {
+	shimPath := image.ShimFind("")
+	if shimPath == "" {
+		return nil, fmt.Errorf("no shim found on the host os")
+	}
+	grubPath := image.GrubFind("")
+	if grubPath == "" {
+		return nil, fmt.Errorf("no grub found on host os")
+	}
+	return map[string]string{
+		"shim.efi":    shimPath,
+		"grub.efi":    grubPath,
+		"grubx64.efi": grubPath,
+	}, nil
+}
+
 /*
 Copies the default shim, which is the shim located on host
 to the tftp directory
@@ -20,26 +40,17 @@ to the tftp directory
 func CopyShimGrub() (err error) {
 	conf := warewulfconf.Get()
 	wwlog.Debug("copy shim and grub binaries from host")
-	shimPath := image.ShimFind("")
-	if shimPath == "" {
-		return fmt.Errorf("no shim found on the host os")
-	}
-	err = util.CopyFile(shimPath, path.Join(conf.TFTP.TftpRoot, "warewulf", "shim.efi"))
+	files, err := shimGrubFiles()
 	if err != nil {
 		return err
 	}
-	_ = os.Chmod(path.Join(conf.TFTP.TftpRoot, "warewulf", "shim.efi"), 0o755)
-	grubPath := image.GrubFind("")
-	if grubPath == "" {
-		return fmt.Errorf("no grub found on host os")
-	}
-	err = util.CopyFile(grubPath, path.Join(conf.TFTP.TftpRoot, "warewulf", "grub.efi"))
-	if err != nil {
-		return err
+	for _, name := range []string{"shim.efi", "grub.efi", "grubx64.efi"} {
+		err = util.CopyFile(files[name], path.Join(conf.TFTP.TftpRoot, "warewulf", name))
+		if err != nil {
+			return err
+		}
+		_ = os.Chmod(path.Join(conf.TFTP.TftpRoot, "warewulf", name), 0o755)
 	}
-	_ = os.Chmod(path.Join(conf.TFTP.TftpRoot, "warewulf", "grub.efi"), 0o755)
-	err = util.CopyFile(grubPath, path.Join(conf.TFTP.TftpRoot, "warewulf", "grubx64.efi"))
-	_ = os.Chmod(path.Join(conf.TFTP.TftpRoot, "warewulf", "grubx64.efi"), 0o755)
 
 	return
 }
@@ -0,0 +1,119 @@
+package warewulfd
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/warewulf/warewulf/internal/pkg/wwlog"
+)
+
+/*
+Queue of unknown nodes which requested to be provisioned, exposed on
+/discovery. With warewulf.conf:warewulf.discovery queue, unknown hardware
+addresses are recorded here instead of being assigned to the first
+discoverable node, until they are approved with wwctl.
+*/
+
+// maximum number of queued nodes, to bound the memory used by requests
+// with arbitrary hardware addresses
+const discoveryQueueSize = 4096
+
+type DiscoveredNode struct {
+	Hwaddr    string `json:"hwaddr"`
+	Ipaddr    string `json:"ipaddr"`
+	FirstSeen int64  `json:"first seen"`
+	LastSeen  int64  `json:"last seen"`
+	AssetKey  string `json:"asset key,omitempty"`
+	UUID      string `json:"uuid,omitempty"`
+}
+
+type discoveryStatus struct {
+	Nodes []*DiscoveredNode `json:"nodes"`
+}
+
+var (
+	discoveryDB   = make(map[string]*DiscoveredNode)
+	discoveryLock = sync.RWMutex{}
+)
+
+/*
+Records a request of an unknown node in the discovery queue
+*/
+func addDiscovered(rinfo parserInfo) {
+	hwaddr := strings.ToLower(rinfo.hwaddr)
+	if hwaddr == "" {
+		return
+	}
+	discoveryLock.Lock()
+	defer discoveryLock.Unlock()
+	rightnow := time.Now().Unix()
+	n, ok := discoveryDB[hwaddr]
+	if !ok {
+		if len(discoveryDB) >= discoveryQueueSize {
+			wwlog.Warn("discovery queue is full, not queueing %s", hwaddr)
+			return
+		}
+		n = &DiscoveredNode{Hwaddr: hwaddr, FirstSeen: rightnow}
+		discoveryDB[hwaddr] = n
+		wwlog.Serv("%s (unknown node queued for discovery)", hwaddr)
+	}
+	n.LastSeen = rightnow
+	n.Ipaddr = rinfo.ipaddr
+	if rinfo.assetkey != "" {
+		n.AssetKey = rinfo.assetkey
+	}
+	if validUUID(rinfo.uuid) {
+		n.UUID = strings.ToLower(rinfo.uuid)
+	}
+}
+
+/*
+Drops the queued nodes whose hardware address is configured for a node
+*/
+func pruneDiscovered(known map[string]string) {
+	discoveryLock.Lock()
+	defer discoveryLock.Unlock()
+	for hwaddr := range discoveryDB {
+		if _, ok := known[hwaddr]; ok {
+			delete(discoveryDB, hwaddr)
+		}
+	}
+}
+
+/*
+Returns the queued nodes in the order in which they were first seen
+*/
+func listDiscovered() []*DiscoveredNode {
+	discoveryLock.RLock()
+	defer discoveryLock.RUnlock()
+	ret := make([]*DiscoveredNode, 0, len(discoveryDB))
+	for _, n := range discoveryDB {
+		entry := *n
+		ret = append(ret, &entry)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].FirstSeen != ret[j].FirstSeen {
+			return ret[i].FirstSeen < ret[j].FirstSeen
+		}
+		return ret[i].Hwaddr < ret[j].Hwaddr
+	})
+	return ret
+}
+
+func DiscoverySend(w http.ResponseWriter, req *http.Request) {
+	data, err := json.MarshalIndent(discoveryStatus{Nodes: listDiscovered()}, "", "  ")
+	if err != nil {
+		wwlog.Error("could not marshal JSON data from discovery queue: %s", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, err = w.Write(data)
+	if err != nil {
+		wwlog.Warn("Could not send discovery JSON: %s", err)
+	}
+}
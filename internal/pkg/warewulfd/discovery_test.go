@@ -0,0 +1,143 @@
+package warewulfd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/warewulf/warewulf/internal/pkg/conffile"
+	warewulfconf "github.com/warewulf/warewulf/internal/pkg/config"
+	"github.com/warewulf/warewulf/internal/pkg/node"
+	"github.com/warewulf/warewulf/internal/pkg/testenv"
+)
+
+func Test_DiscoveryQueue(t *testing.T) {
+	env := testenv.New(t)
+	defer env.RemoveAll()
+
+	env.WriteFile("etc/warewulf/nodes.conf", `nodes:
+  n1:
+    discoverable: true
+    network devices:
+      default:
+        device: eth0`)
+	assert.NoError(t, LoadNodeDB())
+	discoveryDB = make(map[string]*DiscoveredNode)
+	defer func() {
+		discoveryDB = make(map[string]*DiscoveredNode)
+	}()
+
+	conf := warewulfconf.Get()
+	queue := true
+	conf.Warewulf.DiscoveryQueueP = &queue
+
+	for _, hwaddr := range []string{"00:00:00:00:00:02", "00:00:00:00:00:01", "00:00:00:00:00:02"} {
+		req := httptest.NewRequest(http.MethodGet, "/ipxe/"+hwaddr+"?assetkey=rack1&uuid=4C4C4544-0000-1010-8000-B2C04F000001", nil)
+		req.RemoteAddr = "10.10.10.10:987"
+		w := httptest.NewRecorder()
+		ProvisionSend(w, req)
+		w.Result().Body.Close()
+	}
+
+	// the discoverable node is not assigned
+	registry, err := node.New()
+	require.NoError(t, err)
+	n1, err := registry.GetNode("n1")
+	require.NoError(t, err)
+	assert.Empty(t, n1.NetDevs["default"].Hwaddr)
+	assert.True(t, n1.Discoverable.Bool())
+
+	req := httptest.NewRequest(http.MethodGet, "/discovery", nil)
+	w := httptest.NewRecorder()
+	DiscoverySend(w, req)
+	res := w.Result()
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	var status discoveryStatus
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&status))
+	require.Len(t, status.Nodes, 2)
+	hwaddrs := map[string]*DiscoveredNode{}
+	for _, n := range status.Nodes {
+		hwaddrs[n.Hwaddr] = n
+	}
+	require.Contains(t, hwaddrs, "00:00:00:00:00:02")
+	assert.Equal(t, "10.10.10.10", hwaddrs["00:00:00:00:00:02"].Ipaddr)
+	assert.Equal(t, "rack1", hwaddrs["00:00:00:00:00:02"].AssetKey)
+	assert.Equal(t, "4c4c4544-0000-1010-8000-b2c04f000001", hwaddrs["00:00:00:00:00:02"].UUID)
+	assert.NotZero(t, hwaddrs["00:00:00:00:00:02"].FirstSeen)
+
+	// approved nodes leave the queue
+	env.WriteFile("etc/warewulf/nodes.conf", `nodes:
+  n1:
+    network devices:
+      default:
+        hwaddr: 00:00:00:00:00:02`)
+	assert.NoError(t, LoadNodeDB())
+	queued := listDiscovered()
+	require.Len(t, queued, 1)
+	assert.Equal(t, "00:00:00:00:00:01", queued[0].Hwaddr)
+}
+
+func Test_GetNodeOrSetDiscoverable(t *testing.T) {
+	env := testenv.New(t)
+	defer env.RemoveAll()
+	defer func(timeout time.Duration) { conffile.LockTimeout = timeout }(conffile.LockTimeout)
+	conffile.LockTimeout = 0
+
+	env.WriteFile("etc/warewulf/nodes.conf", `nodes:
+  n1:
+    discoverable: true
+    network devices:
+      default:
+        device: eth0`)
+	require.NoError(t, LoadNodeDB())
+	queue := false
+	warewulfconf.Get().Warewulf.DiscoveryQueueP = &queue
+
+	// a change which warewulfd didn't load yet
+	env.WriteFile("etc/warewulf/nodes.conf", `nodes:
+  n1:
+    discoverable: true
+    network devices:
+      default:
+        device: eth0
+  n2:
+    network devices:
+      default:
+        hwaddr: 00:00:00:00:00:02`)
+
+	lock, err := node.Lock()
+	require.NoError(t, err)
+	_, err = GetNodeOrSetDiscoverable("00:00:00:00:00:01")
+	assert.ErrorIs(t, err, conffile.ErrLocked)
+	require.NoError(t, lock.Unlock())
+
+	n1, err := GetNodeOrSetDiscoverable("00:00:00:00:00:01")
+	require.NoError(t, err)
+	assert.Equal(t, "n1", n1.Id())
+	registry, err := node.New()
+	require.NoError(t, err)
+	assert.Equal(t, "00:00:00:00:00:01", registry.Nodes["n1"].NetDevs["default"].Hwaddr)
+	assert.Contains(t, registry.Nodes, "n2")
+}
+
+func Test_listDiscovered(t *testing.T) {
+	discoveryDB = map[string]*DiscoveredNode{
+		"00:00:00:00:00:03": {Hwaddr: "00:00:00:00:00:03", FirstSeen: 20},
+		"00:00:00:00:00:02": {Hwaddr: "00:00:00:00:00:02", FirstSeen: 10},
+		"00:00:00:00:00:01": {Hwaddr: "00:00:00:00:00:01", FirstSeen: 20},
+	}
+	defer func() {
+		discoveryDB = make(map[string]*DiscoveredNode)
+	}()
+	var hwaddrs []string
+	for _, n := range listDiscovered() {
+		hwaddrs = append(hwaddrs, n.Hwaddr)
+	}
+	assert.Equal(t, []string{"00:00:00:00:00:02", "00:00:00:00:00:01", "00:00:00:00:00:03"}, hwaddrs)
+}
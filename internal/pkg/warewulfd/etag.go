@@ -0,0 +1,109 @@
+package warewulfd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/warewulf/warewulf/internal/pkg/overlay"
+	"github.com/warewulf/warewulf/internal/pkg/util"
+)
+
+/*
+Strong ETags of overlay images, which let nodes skip downloading an
+overlay they already have.
+*/
+
+type digestEntry struct {
+	size    int64
+	modTime time.Time
+	digest  string
+}
+
+var (
+	digestCache     = make(map[string]digestEntry)
+	digestCacheLock sync.Mutex
+)
+
+/*
+Returns the SHA-256 digest of a file. Digests are cached until the size
+or modification time of the file changes.
+*/
+func fileDigest(fileName string) (string, error) {
+	stat, err := os.Stat(fileName)
+	if err != nil {
+		return "", err
+	}
+	digestCacheLock.Lock()
+	entry, ok := digestCache[fileName]
+	digestCacheLock.Unlock()
+	if ok && entry.size == stat.Size() && entry.modTime.Equal(stat.ModTime()) {
+		return entry.digest, nil
+	}
+
+	fd, err := os.Open(fileName)
+	if err != nil {
+		return "", err
+	}
+	defer fd.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, fd); err != nil {
+		return "", fmt.Errorf("could not hash %s: %w", fileName, err)
+	}
+	entry = digestEntry{
+		size:    stat.Size(),
+		modTime: stat.ModTime(),
+		digest:  hex.EncodeToString(hash.Sum(nil)),
+	}
+	digestCacheLock.Lock()
+	digestCache[fileName] = entry
+	digestCacheLock.Unlock()
+	return entry.digest, nil
+}
+
+/*
+Returns the ETag of an overlay image in the given compression format.
+The ETag is derived from the digest of the uncompressed image, so that
+it identifies the content of the overlay regardless of the format it is
+sent in.
+*/
+func overlayETag(imageFile string, format string) (string, error) {
+	digest, err := fileDigest(imageFile)
+	if err != nil {
+		return "", err
+	}
+	if format != util.CompressNone {
+		return fmt.Sprintf("\"%s-%s\"", digest, format), nil
+	}
+	return fmt.Sprintf("\"%s\"", digest), nil
+}
+
+/*
+Returns true if the If-None-Match header of a request matches etag
+*/
+func etagMatch(ifNoneMatch string, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+Returns whether the runtime overlay with the given ETag is the current
+runtime overlay image of the node
+*/
+func runtimeOverlayCurrent(nodeID string, etag string) (bool, error) {
+	digest, err := fileDigest(overlay.OverlayImage(nodeID, "runtime", nil))
+	if err != nil {
+		return false, err
+	}
+	return strings.HasPrefix(strings.Trim(etag, "\""), digest), nil
+}
@@ -0,0 +1,134 @@
+package warewulfd
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	warewulfconf "github.com/warewulf/warewulf/internal/pkg/config"
+	"github.com/warewulf/warewulf/internal/pkg/kernel"
+	"github.com/warewulf/warewulf/internal/pkg/node"
+	"github.com/warewulf/warewulf/internal/pkg/nodehealth"
+	"github.com/warewulf/warewulf/internal/pkg/nodetoken"
+	"github.com/warewulf/warewulf/internal/pkg/wwlog"
+)
+
+// maximum size of a health report
+const maxHealthSize = 64 * 1024
+
+/*
+Looks up the node of a request from wwclient and authenticates it like
+runtime overlay requests. If the request is denied, the status and the
+reason for the access log entry are written and ok is false.
+*/
+func authNode(w http.ResponseWriter, req *http.Request, rinfo parserInfo, what string, entry *accessEntry) (nodeID string, remoteNode node.Node, ok bool) {
+	conf := warewulfconf.Get()
+	nodeID = nodeIDByHwaddr(rinfo.hwaddr)
+	if nodeID == "" {
+		wwlog.Denied("%s of unknown node: %s", what, rinfo.hwaddr)
+		w.WriteHeader(http.StatusNotFound)
+		entry.Reason = "UNKNOWN_NODE"
+		return
+	}
+	entry.Node = nodeID
+	db.lock.RLock()
+	remoteNode, err := db.yml.GetNode(nodeID)
+	db.lock.RUnlock()
+	if err != nil {
+		wwlog.ErrorExc(err, "")
+		w.WriteHeader(http.StatusNotFound)
+		entry.Reason = "UNKNOWN_NODE"
+		return
+	}
+
+	if remoteNode.AssetKey != "" && remoteNode.AssetKey != rinfo.assetkey {
+		wwlog.Denied("incorrect asset key: node %s: %s", nodeID, rinfo.assetkey)
+		w.WriteHeader(http.StatusUnauthorized)
+		entry.Reason = "BAD_ASSET"
+		return
+	}
+	if remoteNode.UUID != "" && !strings.EqualFold(remoteNode.UUID, rinfo.uuid) {
+		wwlog.Denied("incorrect uuid: node %s: %s", nodeID, rinfo.uuid)
+		w.WriteHeader(http.StatusUnauthorized)
+		entry.Reason = "BAD_ASSET"
+		return
+	}
+	if conf.Warewulf.NodeTokens() {
+		if err := nodetoken.Verify(nodeID, rinfo.hwaddr, rinfo.timestamp, rinfo.token); err != nil {
+			wwlog.Denied("invalid node token: node %s: %s", nodeID, err)
+			w.WriteHeader(http.StatusUnauthorized)
+			entry.Reason = "BAD_TOKEN"
+			return
+		}
+	} else if conf.Warewulf.Secure() && rinfo.remoteport >= 1024 {
+		wwlog.Denied("Non-privileged port: %s", req.RemoteAddr)
+		w.WriteHeader(http.StatusUnauthorized)
+		entry.Reason = "NON_PRIVILEGED_PORT"
+		return
+	}
+	return nodeID, remoteNode, true
+}
+
+/*
+Receives the health report which wwclient posts to /health/<hwaddr> on
+each update. Reports are authenticated like runtime overlay requests.
+*/
+func HealthReceive(w http.ResponseWriter, req *http.Request) {
+	start := time.Now()
+	sw := newStatusWriter(w)
+	w = sw
+	entry := accessEntry{Stage: "health"}
+	defer logAccess(req, sw, start, &entry)
+
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		entry.Reason = "BAD_REQUEST"
+		return
+	}
+
+	conf := warewulfconf.Get()
+	rinfo, err := parseReq(req)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		wwlog.ErrorExc(err, "Bad health report")
+		entry.Reason = "BAD_REQUEST"
+		return
+	}
+	entry.Hwaddr = rinfo.hwaddr
+
+	if req.TLS == nil && conf.Warewulf.TLS.Required(rinfo.stage) {
+		wwlog.Denied("stage %s requires tls: %s", rinfo.stage, req.RemoteAddr)
+		w.WriteHeader(http.StatusForbidden)
+		entry.Reason = "TLS_REQUIRED"
+		return
+	}
+
+	nodeID, remoteNode, ok := authNode(w, req, rinfo, "health report", &entry)
+	if !ok {
+		return
+	}
+
+	var health nodehealth.Health
+	if err := json.NewDecoder(http.MaxBytesReader(w, req.Body, maxHealthSize)).Decode(&health); err != nil {
+		wwlog.Warn("could not decode health report of %s: %s", nodeID, err)
+		w.WriteHeader(http.StatusBadRequest)
+		entry.Reason = "BAD_REQUEST"
+		return
+	}
+	health.Received = time.Now().Unix()
+	health.ExpectedKernel = ""
+	if kernel_ := kernel.FromNode(&remoteNode); kernel_ != nil {
+		health.ExpectedKernel = kernel_.Version()
+	}
+	if health.KernelMismatch() {
+		wwlog.Verbose("%s runs kernel %s instead of %s", nodeID, health.Kernel, health.ExpectedKernel)
+	}
+	if failed := health.FailedHooks(); len(failed) > 0 {
+		wwlog.Verbose("%s has failed post-update hooks: %s", nodeID, strings.Join(failed, ","))
+	}
+	setNodeHealth(nodeID, rinfo.ipaddr, &health)
+	wwlog.Debug("received health report of %s", nodeID)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,73 @@
+package warewulfd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_HealthReceive(t *testing.T) {
+	env := provisionTestEnv(t, `nodes:
+  n1:
+    image name: suse
+    network devices:
+      default:
+        hwaddr: 00:00:00:ff:ff:ff
+  n2:
+    asset key: secret
+    network devices:
+      default:
+        hwaddr: 00:00:00:00:ff:ff`)
+	env.CreateFile("/var/lib/warewulf/chroots/suse/rootfs/boot/vmlinuz-6.4.0-150600.23.25-default")
+
+	report := `{"uptime": 3600, "load": [0.5, 0.25, 0.1], "kernel": "%s", "failed units": ["foo.service"]}`
+	tests := map[string]struct {
+		method string
+		url    string
+		body   string
+		status int
+	}{
+		"get":               {http.MethodGet, "/health/00:00:00:ff:ff:ff", "", 405},
+		"unknown node":      {http.MethodPost, "/health/00:00:00:00:00:01", report, 404},
+		"wrong asset key":   {http.MethodPost, "/health/00:00:00:00:ff:ff", report, 401},
+		"invalid report":    {http.MethodPost, "/health/00:00:00:ff:ff:ff", "{", 400},
+		"report":            {http.MethodPost, "/health/00:00:00:ff:ff:ff", report, 204},
+		"correct asset key": {http.MethodPost, "/health/00:00:00:00:ff:ff?assetkey=secret", report, 204},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			body := strings.ReplaceAll(tt.body, "%s", "6.4.0-150600.23.25-default")
+			req := httptest.NewRequest(tt.method, tt.url, strings.NewReader(body))
+			req.RemoteAddr = "10.10.10.10:987"
+			w := httptest.NewRecorder()
+			HealthReceive(w, req)
+			res := w.Result()
+			defer res.Body.Close()
+			assert.Equal(t, tt.status, res.StatusCode)
+		})
+	}
+
+	health := statusDB.Nodes["n1"].Health
+	require.NotNil(t, health)
+	assert.Equal(t, int64(3600), health.Uptime)
+	assert.Equal(t, []string{"foo.service"}, health.FailedUnits)
+	assert.NotZero(t, health.Received)
+	assert.Equal(t, health.Received, statusDB.Nodes["n1"].Lastseen)
+	assert.False(t, health.KernelMismatch())
+
+	// the health report is kept when the node requests its overlays
+	updateStatus("n1", "RUNTIME_OVERLAY", "__RUNTIME__.img", "10.10.10.10")
+	assert.Equal(t, health, statusDB.Nodes["n1"].Health)
+
+	req := httptest.NewRequest(http.MethodPost, "/health/00:00:00:ff:ff:ff",
+		strings.NewReader(strings.ReplaceAll(report, "%s", "6.4.0-150600.23.22-default")))
+	req.RemoteAddr = "10.10.10.10:987"
+	w := httptest.NewRecorder()
+	HealthReceive(w, req)
+	assert.Equal(t, 204, w.Result().StatusCode)
+	assert.True(t, statusDB.Nodes["n1"].Health.KernelMismatch())
+}
@@ -0,0 +1,135 @@
+package warewulfd
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/warewulf/warewulf/internal/pkg/wwlog"
+)
+
+/*
+Bounded history of the provisioning requests of each node, exposed on
+/status/<node>/history.
+*/
+
+// number of events kept for each node
+const historySize = 100
+
+type NodeEvent struct {
+	Time     int64   `json:"time"`
+	Stage    string  `json:"stage"`
+	Sent     string  `json:"sent"`
+	Bytes    int64   `json:"bytes"`
+	Status   int     `json:"status"`
+	Ipaddr   string  `json:"ipaddr"`
+	Duration float64 `json:"duration"`
+}
+
+type nodeHistory struct {
+	NodeName string      `json:"node name"`
+	Events   []NodeEvent `json:"events"`
+}
+
+/*
+Ring buffer of the last events of a node
+*/
+type eventRing struct {
+	events []NodeEvent
+	next   int
+}
+
+func (r *eventRing) add(event NodeEvent) {
+	if len(r.events) < historySize {
+		r.events = append(r.events, event)
+		return
+	}
+	r.events[r.next] = event
+	r.next = (r.next + 1) % historySize
+}
+
+/*
+Returns the events from the oldest to the newest
+*/
+func (r *eventRing) list() []NodeEvent {
+	ret := make([]NodeEvent, 0, len(r.events))
+	ret = append(ret, r.events[r.next:]...)
+	ret = append(ret, r.events[:r.next]...)
+	return ret
+}
+
+var (
+	historyDB   = make(map[string]*eventRing)
+	historyLock = sync.RWMutex{}
+)
+
+func addHistory(nodeID string, event NodeEvent) {
+	if nodeID == "" {
+		return
+	}
+	historyLock.Lock()
+	defer historyLock.Unlock()
+	r, ok := historyDB[nodeID]
+	if !ok {
+		r = &eventRing{}
+		historyDB[nodeID] = r
+	}
+	r.add(event)
+}
+
+/*
+Drops the history of all nodes which are not in the given set
+*/
+func pruneHistory(nodes map[string]*NodeStatus) {
+	historyLock.Lock()
+	defer historyLock.Unlock()
+	for nodeID := range historyDB {
+		if _, ok := nodes[nodeID]; !ok {
+			delete(historyDB, nodeID)
+		}
+	}
+}
+
+func getHistory(nodeID string) (events []NodeEvent, ok bool) {
+	historyLock.RLock()
+	defer historyLock.RUnlock()
+	r, ok := historyDB[nodeID]
+	if !ok {
+		return []NodeEvent{}, false
+	}
+	return r.list(), true
+}
+
+func StatusHistorySend(w http.ResponseWriter, req *http.Request) {
+	pathParts := strings.Split(strings.Trim(strings.TrimPrefix(req.URL.Path, "/status/"), "/"), "/")
+	if len(pathParts) != 2 || pathParts[1] != "history" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	nodeID := pathParts[0]
+
+	events, ok := getHistory(nodeID)
+	if !ok {
+		dbLock.RLock()
+		_, ok = statusDB.Nodes[nodeID]
+		dbLock.RUnlock()
+	}
+	if !ok {
+		wwlog.Verbose("history requested for unknown node: %s", nodeID)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	data, err := json.MarshalIndent(nodeHistory{NodeName: nodeID, Events: events}, "", "  ")
+	if err != nil {
+		wwlog.Error("could not marshal JSON data from history of %s: %s", nodeID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, err = w.Write(data)
+	if err != nil {
+		wwlog.Warn("Could not send history JSON: %s", err)
+	}
+}
@@ -0,0 +1,93 @@
+package warewulfd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_eventRing(t *testing.T) {
+	var r eventRing
+	assert.Empty(t, r.list())
+
+	for i := 0; i < historySize+5; i++ {
+		r.add(NodeEvent{Time: int64(i)})
+	}
+	events := r.list()
+	assert.Len(t, events, historySize)
+	assert.Equal(t, int64(5), events[0].Time)
+	assert.Equal(t, int64(historySize+4), events[historySize-1].Time)
+}
+
+func Test_StatusHistorySend(t *testing.T) {
+	provisionTestEnv(t, `nodes:
+  n1:
+    network devices:
+      default:
+        hwaddr: 00:00:00:ff:ff:ff
+  n2: {}`, "n1")
+	historyDB = make(map[string]*eventRing)
+	defer func() {
+		historyDB = make(map[string]*eventRing)
+	}()
+	assert.NoError(t, LoadNodeStatus())
+
+	for _, url := range []string{"/overlay-system/00:00:00:ff:ff:ff", "/kernel/00:00:00:ff:ff:ff"} {
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		req.RemoteAddr = "10.10.10.10:987"
+		ProvisionSend(httptest.NewRecorder(), req)
+	}
+
+	tests := map[string]struct {
+		url    string
+		status int
+		events []NodeEvent
+	}{
+		"node with history": {
+			url:    "/status/n1/history",
+			status: 200,
+			events: []NodeEvent{
+				{Stage: "SYSTEM_OVERLAY", Sent: "__SYSTEM__.img", Bytes: 14, Status: 200, Ipaddr: "10.10.10.10"},
+				{Stage: "KERNEL", Sent: "BAD_REQUEST", Bytes: 0, Status: 400, Ipaddr: "10.10.10.10"},
+			},
+		},
+		"node without history": {
+			url:    "/status/n2/history",
+			status: 200,
+			events: []NodeEvent{},
+		},
+		"unknown node": {
+			url:    "/status/n3/history",
+			status: 404,
+		},
+		"unknown path": {
+			url:    "/status/n1/other",
+			status: 404,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			w := httptest.NewRecorder()
+			StatusHistorySend(w, req)
+			res := w.Result()
+			defer res.Body.Close()
+			assert.Equal(t, tt.status, res.StatusCode)
+			if tt.status != 200 {
+				return
+			}
+			var history nodeHistory
+			assert.NoError(t, json.NewDecoder(res.Body).Decode(&history))
+			assert.Len(t, history.Events, len(tt.events))
+			for i := range history.Events {
+				assert.NotZero(t, history.Events[i].Time)
+				history.Events[i].Time = 0
+				history.Events[i].Duration = 0
+			}
+			assert.Equal(t, tt.events, history.Events)
+		})
+	}
+}
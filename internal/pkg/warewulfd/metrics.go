@@ -0,0 +1,257 @@
+package warewulfd
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/warewulf/warewulf/internal/pkg/wwlog"
+)
+
+/*
+Metrics of the provisioning service, exported in the Prometheus text
+exposition format on /metrics.
+*/
+
+// upper bounds (seconds) of the request duration histogram
+var durationBuckets = []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60, 300}
+
+// upper bounds (seconds) of the last seen buckets of the node gauges
+var lastSeenBuckets = []struct {
+	name  string
+	limit int64
+}{
+	{"1m", 60},
+	{"5m", 300},
+	{"1h", 3600},
+	{"1d", 86400},
+}
+
+type stageMetrics struct {
+	requests    uint64
+	bytes       uint64
+	durationSum float64
+	buckets     []uint64
+}
+
+type metricsDB struct {
+	lock                 sync.Mutex
+	stages               map[string]*stageMetrics
+	responses            map[[2]string]uint64
+	failures             map[[2]string]uint64
+	overlayBuilds        uint64
+	overlayBuildFailures uint64
+	overlayBuildSeconds  float64
+}
+
+var metrics = newMetricsDB()
+
+// stages which are accounted by name, all others are accounted as
+// unknown, as the stage can be any value a client sends
+var metricStages = map[string]bool{
+	"ipxe":      true,
+	"kernel":    true,
+	"image":     true,
+	"system":    true,
+	"runtime":   true,
+	"efiboot":   true,
+	"initramfs": true,
+	"shim":      true,
+	"grub":      true,
+	"tftp":      true,
+	"retry":     true,
+}
+
+func metricStage(stage string) string {
+	if !metricStages[stage] {
+		return "unknown"
+	}
+	return stage
+}
+
+func newMetricsDB() *metricsDB {
+	return &metricsDB{
+		stages:    make(map[string]*stageMetrics),
+		responses: make(map[[2]string]uint64),
+		failures:  make(map[[2]string]uint64),
+	}
+}
+
+/*
+Accounts a served request for the given stage
+*/
+func (m *metricsDB) observeRequest(stage string, status int, sent int64, duration time.Duration) {
+	stage = metricStage(stage)
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	s, ok := m.stages[stage]
+	if !ok {
+		s = &stageMetrics{buckets: make([]uint64, len(durationBuckets))}
+		m.stages[stage] = s
+	}
+	s.requests++
+	if sent > 0 {
+		s.bytes += uint64(sent)
+	}
+	seconds := duration.Seconds()
+	s.durationSum += seconds
+	for i, limit := range durationBuckets {
+		if seconds <= limit {
+			s.buckets[i]++
+		}
+	}
+	if status >= 400 {
+		m.responses[[2]string{stage, strconv.Itoa(status)}]++
+	}
+}
+
+/*
+Accounts a request which was refused or could not be served, with the
+reason also recorded in the status DB (e.g. BAD_ASSET, NOT_FOUND)
+*/
+func (m *metricsDB) observeFailure(stage, reason string) {
+	stage = metricStage(stage)
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.failures[[2]string{stage, reason}]++
+}
+
+/*
+Accounts an automatic overlay build
+*/
+func (m *metricsDB) observeOverlayBuild(duration time.Duration, err error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.overlayBuilds++
+	m.overlayBuildSeconds += duration.Seconds()
+	if err != nil {
+		m.overlayBuildFailures++
+	}
+}
+
+func writeMetricHeader(buf *bytes.Buffer, name, kind, help string) {
+	fmt.Fprintf(buf, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(buf, "# TYPE %s %s\n", name, kind)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+/*
+Renders all metrics in the Prometheus text exposition format. The node
+gauges are calculated from the status DB at the time of the call.
+*/
+func (m *metricsDB) exposition(rightnow int64) []byte {
+	var buf bytes.Buffer
+	m.lock.Lock()
+	stageNames := make([]string, 0, len(m.stages))
+	for stage := range m.stages {
+		stageNames = append(stageNames, stage)
+	}
+	sort.Strings(stageNames)
+
+	writeMetricHeader(&buf, "warewulfd_requests_total", "counter", "Total number of provisioning requests by stage.")
+	for _, stage := range stageNames {
+		fmt.Fprintf(&buf, "warewulfd_requests_total{stage=%q} %d\n", stage, m.stages[stage].requests)
+	}
+	writeMetricHeader(&buf, "warewulfd_sent_bytes_total", "counter", "Total number of bytes sent by stage.")
+	for _, stage := range stageNames {
+		fmt.Fprintf(&buf, "warewulfd_sent_bytes_total{stage=%q} %d\n", stage, m.stages[stage].bytes)
+	}
+	writeMetricHeader(&buf, "warewulfd_request_duration_seconds", "histogram", "Duration of provisioning requests by stage.")
+	for _, stage := range stageNames {
+		s := m.stages[stage]
+		for i, limit := range durationBuckets {
+			fmt.Fprintf(&buf, "warewulfd_request_duration_seconds_bucket{stage=%q,le=%q} %d\n", stage, formatFloat(limit), s.buckets[i])
+		}
+		fmt.Fprintf(&buf, "warewulfd_request_duration_seconds_bucket{stage=%q,le=\"+Inf\"} %d\n", stage, s.requests)
+		fmt.Fprintf(&buf, "warewulfd_request_duration_seconds_sum{stage=%q} %s\n", stage, formatFloat(s.durationSum))
+		fmt.Fprintf(&buf, "warewulfd_request_duration_seconds_count{stage=%q} %d\n", stage, s.requests)
+	}
+
+	writeMetricHeader(&buf, "warewulfd_error_responses_total", "counter", "Total number of 4xx and 5xx responses by stage and status code.")
+	for _, key := range sortedKeys(m.responses) {
+		fmt.Fprintf(&buf, "warewulfd_error_responses_total{stage=%q,code=%q} %d\n", key[0], key[1], m.responses[key])
+	}
+	writeMetricHeader(&buf, "warewulfd_failed_requests_total", "counter", "Total number of refused or unserved requests by stage and reason.")
+	for _, key := range sortedKeys(m.failures) {
+		fmt.Fprintf(&buf, "warewulfd_failed_requests_total{stage=%q,reason=%q} %d\n", key[0], key[1], m.failures[key])
+	}
+
+	writeMetricHeader(&buf, "warewulfd_overlay_builds_total", "counter", "Total number of automatic overlay builds.")
+	fmt.Fprintf(&buf, "warewulfd_overlay_builds_total %d\n", m.overlayBuilds)
+	writeMetricHeader(&buf, "warewulfd_overlay_build_failures_total", "counter", "Total number of failed automatic overlay builds.")
+	fmt.Fprintf(&buf, "warewulfd_overlay_build_failures_total %d\n", m.overlayBuildFailures)
+	writeMetricHeader(&buf, "warewulfd_overlay_build_seconds_total", "counter", "Total time spent in automatic overlay builds.")
+	fmt.Fprintf(&buf, "warewulfd_overlay_build_seconds_total %s\n", formatFloat(m.overlayBuildSeconds))
+	m.lock.Unlock()
+
+	current := transfers.status()
+	stageNames = make([]string, 0, len(current.Stages))
+	for stage := range current.Stages {
+		stageNames = append(stageNames, stage)
+	}
+	sort.Strings(stageNames)
+	writeMetricHeader(&buf, "warewulfd_transfers_active", "gauge", "Number of transfers in progress by stage.")
+	for _, stage := range stageNames {
+		fmt.Fprintf(&buf, "warewulfd_transfers_active{stage=%q} %d\n", stage, current.Stages[stage].Active)
+	}
+	writeMetricHeader(&buf, "warewulfd_transfers_waiting", "gauge", "Number of transfers waiting for a free slot by stage.")
+	for _, stage := range stageNames {
+		fmt.Fprintf(&buf, "warewulfd_transfers_waiting{stage=%q} %d\n", stage, current.Stages[stage].Waiting)
+	}
+
+	nodeBuckets := make(map[string]int)
+	dbLock.RLock()
+	for _, n := range statusDB.Nodes {
+		nodeBuckets[lastSeenBucket(n.Lastseen, rightnow)]++
+	}
+	dbLock.RUnlock()
+	writeMetricHeader(&buf, "warewulfd_nodes", "gauge", "Number of nodes by time since they were last seen.")
+	for _, b := range lastSeenBuckets {
+		fmt.Fprintf(&buf, "warewulfd_nodes{last_seen=%q} %d\n", b.name, nodeBuckets[b.name])
+	}
+	for _, name := range []string{"older", "never"} {
+		fmt.Fprintf(&buf, "warewulfd_nodes{last_seen=%q} %d\n", name, nodeBuckets[name])
+	}
+
+	return buf.Bytes()
+}
+
+func lastSeenBucket(lastseen, rightnow int64) string {
+	if lastseen == 0 {
+		return "never"
+	}
+	for _, b := range lastSeenBuckets {
+		if rightnow-lastseen <= b.limit {
+			return b.name
+		}
+	}
+	return "older"
+}
+
+func sortedKeys(m map[[2]string]uint64) (keys [][2]string) {
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] != keys[j][0] {
+			return keys[i][0] < keys[j][0]
+		}
+		return keys[i][1] < keys[j][1]
+	})
+	return keys
+}
+
+func MetricsSend(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, err := w.Write(metrics.exposition(time.Now().Unix()))
+	if err != nil {
+		wwlog.Warn("Could not send metrics: %s", err)
+	}
+}
@@ -0,0 +1,62 @@
+package warewulfd
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_MetricsSend(t *testing.T) {
+	prevMetrics := metrics
+	metrics = newMetricsDB()
+	defer func() {
+		metrics = prevMetrics
+	}()
+
+	metrics.observeRequest("image", 200, 1024, 2*time.Second)
+	metrics.observeRequest("image", 200, 1024, 20*time.Millisecond)
+	metrics.observeRequest("system", 401, 0, time.Millisecond)
+	metrics.observeFailure("system", "BAD_ASSET")
+	// stages are sent by clients, only known stages get their own series
+	metrics.observeRequest(uuid.NewString(), 404, 0, time.Millisecond)
+	metrics.observeFailure(uuid.NewString(), "NOT_FOUND")
+	metrics.observeOverlayBuild(time.Second, nil)
+	metrics.observeOverlayBuild(time.Second, errors.New("failed"))
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	w := httptest.NewRecorder()
+	MetricsSend(w, req)
+	res := w.Result()
+	defer res.Body.Close()
+	data, err := io.ReadAll(res.Body)
+	assert.NoError(t, err)
+	body := string(data)
+
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Contains(t, body, "# TYPE warewulfd_requests_total counter\n")
+	assert.Contains(t, body, "warewulfd_requests_total{stage=\"image\"} 2\n")
+	assert.Contains(t, body, "warewulfd_sent_bytes_total{stage=\"image\"} 2048\n")
+	assert.Contains(t, body, "warewulfd_request_duration_seconds_bucket{stage=\"image\",le=\"0.05\"} 1\n")
+	assert.Contains(t, body, "warewulfd_request_duration_seconds_bucket{stage=\"image\",le=\"5\"} 2\n")
+	assert.Contains(t, body, "warewulfd_request_duration_seconds_count{stage=\"image\"} 2\n")
+	assert.Contains(t, body, "warewulfd_error_responses_total{stage=\"system\",code=\"401\"} 1\n")
+	assert.Contains(t, body, "warewulfd_failed_requests_total{stage=\"system\",reason=\"BAD_ASSET\"} 1\n")
+	assert.Contains(t, body, "warewulfd_requests_total{stage=\"unknown\"} 1\n")
+	assert.Contains(t, body, "warewulfd_failed_requests_total{stage=\"unknown\",reason=\"NOT_FOUND\"} 1\n")
+	assert.Len(t, metrics.stages, 3)
+	assert.Contains(t, body, "warewulfd_overlay_builds_total 2\n")
+	assert.Contains(t, body, "warewulfd_overlay_build_failures_total 1\n")
+}
+
+func Test_lastSeenBucket(t *testing.T) {
+	assert.Equal(t, "never", lastSeenBucket(0, 1000))
+	assert.Equal(t, "1m", lastSeenBucket(990, 1000))
+	assert.Equal(t, "5m", lastSeenBucket(800, 1000))
+	assert.Equal(t, "older", lastSeenBucket(1, 100000))
+}
@@ -2,9 +2,11 @@ package warewulfd
 
 import (
 	"fmt"
+	"net"
 	"strings"
 	"sync"
 
+	warewulfconf "github.com/warewulf/warewulf/internal/pkg/config"
 	"github.com/warewulf/warewulf/internal/pkg/node"
 	"github.com/warewulf/warewulf/internal/pkg/wwlog"
 )
@@ -12,7 +14,11 @@ import (
 type nodeDB struct {
 	lock     sync.RWMutex
 	NodeInfo map[string]string
-	yml      node.NodesYaml
+	// node IDs by the IP addresses of their network devices
+	NodeIPs map[string]string
+	// hardware addresses of network devices by their IP addresses
+	IPHwaddrs map[string]string
+	yml       node.NodesYaml
 }
 
 var (
@@ -26,15 +32,24 @@ func LoadNodeDB() error {
 	return loadNodeDB()
 }
 
-func loadNodeDB() (err error) {
-	TmpMap := make(map[string]string)
-
-	db.yml, err = node.New()
+func loadNodeDB() error {
+	yml, err := node.New()
 	if err != nil {
-		return
+		return err
 	}
+	return setNodeDB(yml)
+}
+
+/*
+Replaces the node DB with the given nodes. The caller must hold db.lock.
+On errors the current node DB is kept.
+*/
+func setNodeDB(yml node.NodesYaml) error {
+	TmpMap := make(map[string]string)
+	ipMap := make(map[string]string)
+	hwaddrMap := make(map[string]string)
 
-	nodes, err := db.yml.FindAllNodes()
+	nodes, err := yml.FindAllNodes()
 	if err != nil {
 		return err
 	}
@@ -46,29 +61,71 @@ func loadNodeDB() (err error) {
 		for _, netdev := range n.NetDevs {
 			hwaddr := strings.ToLower(netdev.Hwaddr)
 			TmpMap[hwaddr] = n.Id()
+			for _, ip := range []net.IP{netdev.Ipaddr, netdev.Ipaddr6} {
+				if ip != nil && !ip.IsUnspecified() {
+					ipMap[ip.String()] = n.Id()
+					if hwaddr != "" {
+						hwaddrMap[ip.String()] = hwaddr
+					}
+				}
+			}
 		}
 	}
 
+	db.yml = yml
 	db.NodeInfo = TmpMap
+	db.NodeIPs = ipMap
+	db.IPHwaddrs = hwaddrMap
+	pruneDiscovered(TmpMap)
 	return nil
 }
 
 func GetNodeOrSetDiscoverable(hwaddr string) (node.Node, error) {
 	db.lock.RLock()
-	defer db.lock.RUnlock()
-	// NOTE: since discoverable nodes will write an updated DB to file and then
-	// reload, it is not enough to lock individual reads from the DB
-	// to ensure the condition on which the node is updated is still satisfied
-	// after the DB is read back in.
-
 	nId, ok := db.NodeInfo[hwaddr]
 	if ok {
+		defer db.lock.RUnlock()
 		return db.yml.GetNode(nId)
 	}
+	db.lock.RUnlock()
 
 	// If we failed to find a node, let's see if we can add one...
 	wwlog.Warn("node not configured: %s", hwaddr)
 
+	// unknown nodes wait in the discovery queue for approval
+	if warewulfconf.Get().Warewulf.DiscoveryQueue() {
+		return node.EmptyNode(), node.ErrNoUnconfigured
+	}
+
+	return discoverNode(hwaddr)
+}
+
+/*
+Configures the hardware address on the next discoverable node. nodes.conf
+is locked and read again before it is changed, so that changes made since
+the node DB was loaded, e.g. by wwctl, are kept.
+*/
+func discoverNode(hwaddr string) (node.Node, error) {
+	lock, err := node.Lock()
+	if err != nil {
+		return node.EmptyNode(), fmt.Errorf("%s (could not discover node) %w", hwaddr, err)
+	}
+	defer lock.Unlock()
+	// NOTE: since discoverable nodes will write an updated DB to file and then
+	// reload, it is not enough to lock individual reads from the DB
+	// to ensure the condition on which the node is updated is still satisfied
+	// after the DB is read back in.
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	err = loadNodeDB()
+	if err != nil {
+		return node.EmptyNode(), fmt.Errorf("%s (failed to reload configuration) %w", hwaddr, err)
+	}
+	// the node may have been configured by another request meanwhile
+	if nId, ok := db.NodeInfo[hwaddr]; ok {
+		return db.yml.GetNode(nId)
+	}
+
 	node, netdev, err := db.yml.FindDiscoverableNode()
 	if err != nil {
 		// NOTE: this is taken as there is no discoverable node, so return the
@@ -102,3 +159,103 @@ func GetNodeOrSetDiscoverable(hwaddr string) (node.Node, error) {
 	// return the discovered node
 	return db.yml.GetNode(node.Id())
 }
+
+/*
+Returns the ID of the node with the given IP address, or an empty string
+if it is unknown. The hardware address in the arp cache takes precedence
+over the configured addresses.
+*/
+func nodeIDByIP(ip string) string {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+	if hwaddr := ArpFind(ip); hwaddr != "" {
+		if nodeID, ok := db.NodeInfo[strings.ToLower(hwaddr)]; ok {
+			return nodeID
+		}
+	}
+	if parsed := net.ParseIP(ip); parsed != nil {
+		ip = parsed.String()
+	}
+	return db.NodeIPs[ip]
+}
+
+/*
+Returns the hardware address of the network device with the given IP
+address, or an empty string if it is unknown. The arp cache takes
+precedence over the configured addresses.
+*/
+func hwaddrByIP(ip string) string {
+	if hwaddr := ArpFind(ip); hwaddr != "" {
+		return strings.ToLower(hwaddr)
+	}
+	if parsed := net.ParseIP(ip); parsed != nil {
+		ip = parsed.String()
+	}
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+	return db.IPHwaddrs[ip]
+}
+
+/*
+Returns the ID of the node with the given hardware address, or an empty
+string if it is unknown
+*/
+func nodeIDByHwaddr(hwaddr string) string {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+	return db.NodeInfo[strings.ToLower(hwaddr)]
+}
+
+/*
+Returns true if the given SMBIOS UUID identifies a system. Firmware
+without a proper UUID reports all zeros or all ones.
+*/
+func validUUID(uuid string) bool {
+	digits := strings.ReplaceAll(strings.ToLower(uuid), "-", "")
+	if len(digits) != 32 {
+		return false
+	}
+	return strings.Trim(digits, "0") != "" && strings.Trim(digits, "f") != ""
+}
+
+/*
+Records the SMBIOS UUID of a node on its first contact and persists it
+to the node configuration. A UUID which was already recorded is kept.
+*/
+func bindNodeUUID(nodeID, uuid string) error {
+	lock, err := node.Lock()
+	if err != nil {
+		return fmt.Errorf("%s (could not bind uuid) %w", nodeID, err)
+	}
+	defer lock.Unlock()
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	// read nodes.conf again, so that changes since it was loaded are kept
+	err = loadNodeDB()
+	if err != nil {
+		return fmt.Errorf("%s (failed to reload configuration) %w", nodeID, err)
+	}
+
+	nodeChanges, err := db.yml.GetNodeOnly(nodeID)
+	if err != nil {
+		return err
+	}
+	if nodeChanges.UUID != "" {
+		return nil
+	}
+	nodeChanges.UUID = strings.ToLower(uuid)
+	err = db.yml.SetNode(nodeID, nodeChanges)
+	if err != nil {
+		return err
+	}
+	err = db.yml.Persist()
+	if err != nil {
+		return fmt.Errorf("%s (failed to persist node configuration) %w", nodeID, err)
+	}
+	err = loadNodeDB()
+	if err != nil {
+		return fmt.Errorf("%s (failed to reload configuration) %w", nodeID, err)
+	}
+	wwlog.Serv("%s (node bound to uuid %s)", nodeID, nodeChanges.UUID)
+	return nil
+}
@@ -0,0 +1,149 @@
+package warewulfd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"time"
+	"unsafe"
+
+	warewulfconf "github.com/warewulf/warewulf/internal/pkg/config"
+	"github.com/warewulf/warewulf/internal/pkg/node"
+	"github.com/warewulf/warewulf/internal/pkg/wwlog"
+	"golang.org/x/sys/unix"
+)
+
+/*
+Reloads of the node DB when nodes.conf changes, so that edits which
+don't signal warewulfd are picked up as well.
+*/
+
+// time to wait for further changes of nodes.conf before reloading it
+var nodesConfDelay = time.Second
+
+/*
+Re-reads nodes.conf into the node DB and the status DB. Both are
+replaced from the same parse of nodes.conf, and are kept unchanged if
+it can't be parsed.
+*/
+func reloadNodes() error {
+	yml, err := node.New()
+	if err != nil {
+		return err
+	}
+	db.lock.Lock()
+	err = setNodeDB(yml)
+	db.lock.Unlock()
+	if err != nil {
+		return err
+	}
+	return setNodeStatus(yml)
+}
+
+/*
+Watches a file with inotify and calls onChange once the file was
+written or replaced and no further changes followed within delay.
+The directory of the file is watched, so that files replaced by rename,
+as done by editors and configuration management, are followed.
+*/
+type fileWatcher struct {
+	file *os.File
+	done chan struct{}
+}
+
+func watchFile(fileName string, delay time.Duration, onChange func()) (*fileWatcher, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("could not initialize inotify: %w", err)
+	}
+	dir := path.Dir(fileName)
+	if _, err := unix.InotifyAddWatch(fd, dir, unix.IN_CLOSE_WRITE|unix.IN_MOVED_TO); err != nil {
+		_ = unix.Close(fd)
+		return nil, fmt.Errorf("could not watch %s: %w", dir, err)
+	}
+	w := &fileWatcher{
+		// non-blocking, so that Close interrupts a pending read
+		file: os.NewFile(uintptr(fd), "inotify"),
+		done: make(chan struct{}),
+	}
+	changes := make(chan struct{}, 1)
+	go w.read(path.Base(fileName), changes)
+	go w.debounce(delay, changes, onChange)
+	return w, nil
+}
+
+/*
+Reads inotify events and signals changes of the named file until the
+watcher is closed
+*/
+func (w *fileWatcher) read(name string, changes chan<- struct{}) {
+	defer close(changes)
+	buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			return
+		}
+		for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+			event := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameStart := offset + unix.SizeofInotifyEvent
+			offset = nameStart + int(event.Len)
+			if offset > n {
+				break
+			}
+			eventName := string(bytes.TrimRight(buf[nameStart:offset], "\x00"))
+			if eventName != name {
+				continue
+			}
+			select {
+			case changes <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+func (w *fileWatcher) debounce(delay time.Duration, changes <-chan struct{}, onChange func()) {
+	defer close(w.done)
+	var timer <-chan time.Time
+	for {
+		select {
+		case _, ok := <-changes:
+			if !ok {
+				return
+			}
+			timer = time.After(delay)
+		case <-timer:
+			timer = nil
+			onChange()
+		}
+	}
+}
+
+/*
+Stops watching and waits for a running onChange to return
+*/
+func (w *fileWatcher) Close() error {
+	err := w.file.Close()
+	<-w.done
+	return err
+}
+
+/*
+Starts reloading the node DB on changes of nodes.conf
+*/
+func watchNodesConf() (*fileWatcher, error) {
+	nodesConf := warewulfconf.Get().Paths.NodesConf()
+	w, err := watchFile(nodesConf, nodesConfDelay, func() {
+		wwlog.Info("%s changed, reloading node DB", nodesConf)
+		if err := reloadNodes(); err != nil {
+			wwlog.Error("Could not reload %s, keeping the current node DB: %s", nodesConf, err)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	wwlog.Verbose("watching %s for changes", nodesConf)
+	return w, nil
+}
@@ -0,0 +1,116 @@
+package warewulfd
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/warewulf/warewulf/internal/pkg/testenv"
+)
+
+func Test_watchFile(t *testing.T) {
+	dir := t.TempDir()
+	fileName := path.Join(dir, "nodes.conf")
+	changes := make(chan struct{}, 10)
+	w, err := watchFile(fileName, 50*time.Millisecond, func() {
+		changes <- struct{}{}
+	})
+	require.NoError(t, err)
+	defer w.Close()
+
+	expectChanges := func(count int) {
+		time.Sleep(300 * time.Millisecond)
+		assert.Len(t, changes, count)
+		for len(changes) > 0 {
+			<-changes
+		}
+	}
+
+	// several writes in a row result in one change
+	for i := 0; i < 3; i++ {
+		require.NoError(t, os.WriteFile(fileName, []byte("nodes: {}"), 0o644))
+	}
+	expectChanges(1)
+
+	// replacing the file by rename
+	require.NoError(t, os.WriteFile(fileName+".tmp", []byte("nodes: {}"), 0o644))
+	require.NoError(t, os.Rename(fileName+".tmp", fileName))
+	expectChanges(1)
+
+	// other files in the directory are ignored
+	require.NoError(t, os.WriteFile(path.Join(dir, "warewulf.conf"), []byte{}, 0o644))
+	expectChanges(0)
+
+	assert.NoError(t, w.Close())
+	require.NoError(t, os.WriteFile(fileName, []byte("nodes: {}"), 0o644))
+	expectChanges(0)
+}
+
+func Test_reloadNodes(t *testing.T) {
+	env := testenv.New(t)
+	defer env.RemoveAll()
+
+	env.WriteFile("etc/warewulf/nodes.conf", `nodes:
+  n1:
+    network devices:
+      default:
+        hwaddr: 00:00:00:00:00:01
+        ipaddr: 10.0.0.1`)
+	require.NoError(t, reloadNodes())
+	assert.Equal(t, "n1", nodeIDByHwaddr("00:00:00:00:00:01"))
+	assert.Contains(t, statusDB.Nodes, "n1")
+
+	env.WriteFile("etc/warewulf/nodes.conf", `nodes:
+  n2:
+    network devices:
+      default:
+        hwaddr: 00:00:00:00:00:02
+        ipaddr: 10.0.0.2`)
+	require.NoError(t, reloadNodes())
+	assert.Equal(t, "", nodeIDByHwaddr("00:00:00:00:00:01"))
+	assert.Equal(t, "n2", nodeIDByHwaddr("00:00:00:00:00:02"))
+	assert.Equal(t, "n2", nodeIDByIP("10.0.0.2"))
+	assert.NotContains(t, statusDB.Nodes, "n1")
+	assert.Contains(t, statusDB.Nodes, "n2")
+
+	// the last good node DB is kept
+	env.WriteFile("etc/warewulf/nodes.conf", `nodes:
+  n3: [`)
+	assert.Error(t, reloadNodes())
+	assert.Equal(t, "n2", nodeIDByHwaddr("00:00:00:00:00:02"))
+	assert.Contains(t, statusDB.Nodes, "n2")
+	_, err := db.yml.GetNode("n2")
+	assert.NoError(t, err)
+}
+
+func Test_watchNodesConf(t *testing.T) {
+	env := testenv.New(t)
+	defer env.RemoveAll()
+	nodesConfDelay = 10 * time.Millisecond
+	defer func() {
+		nodesConfDelay = time.Second
+	}()
+
+	env.WriteFile("etc/warewulf/nodes.conf", `nodes:
+  n1:
+    network devices:
+      default:
+        hwaddr: 00:00:00:00:00:01`)
+	require.NoError(t, LoadNodeDB())
+	w, err := watchNodesConf()
+	require.NoError(t, err)
+	defer w.Close()
+
+	env.WriteFile("etc/warewulf/nodes.conf", `nodes:
+  n1:
+    network devices:
+      default:
+        hwaddr: 00:00:00:00:00:02`)
+	assert.Eventually(t, func() bool {
+		return nodeIDByHwaddr("00:00:00:00:00:02") == "n1"
+	}, 2*time.Second, 10*time.Millisecond)
+}
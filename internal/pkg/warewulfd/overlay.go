@@ -8,44 +8,77 @@ import (
 	"path"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/warewulf/warewulf/internal/pkg/config"
 	"github.com/warewulf/warewulf/internal/pkg/node"
+	"github.com/warewulf/warewulf/internal/pkg/nodetoken"
 	"github.com/warewulf/warewulf/internal/pkg/overlay"
 	"github.com/warewulf/warewulf/internal/pkg/util"
 	"github.com/warewulf/warewulf/internal/pkg/wwlog"
 )
 
 func OverlaySend(w http.ResponseWriter, req *http.Request) {
+	start := time.Now()
+	sw := newStatusWriter(w)
+	w = sw
+	entry := accessEntry{Stage: "overlay-file"}
+	defer logAccess(req, sw, start, &entry)
+
 	rinfo, err := parseReqRender(req)
 	if err != nil {
 		message := "error parsing request: %s"
 		wwlog.ErrorExc(err, message, err)
 		http.Error(w, fmt.Sprintf(message, err), http.StatusBadRequest)
+		entry.Reason = "BAD_REQUEST"
 		return
 	}
 
+	entry.Hwaddr = rinfo.hwaddr
+	entry.Node = rinfo.node
+	entry.Overlay = rinfo.overlay
+
 	o := overlay.GetOverlay(rinfo.overlay)
 	if !o.Exists() {
 		message := "overlay not found: %s"
 		wwlog.Error(message, rinfo.overlay)
 		http.Error(w, fmt.Sprintf(message, rinfo.overlay), http.StatusNoContent)
+		entry.Reason = "NOT_FOUND"
 		return
 	}
 
 	wwlog.Info("recv: render req overlay: %s, path: %s, node: %s", rinfo.overlay, rinfo.path, rinfo.node)
-	if config.Get().Warewulf.Secure() && rinfo.remoteport >= 1024 {
+	if config.Get().Warewulf.NodeTokens() {
+		if err := verifyRenderToken(rinfo); err != nil {
+			message := "invalid node token: %s"
+			wwlog.Denied(message, err)
+			http.Error(w, fmt.Sprintf(message, err), http.StatusUnauthorized)
+			entry.Reason = "BAD_TOKEN"
+			return
+		}
+	} else if config.Get().Warewulf.Secure() && rinfo.remoteport >= 1024 {
 		message := "non-privileged port: %s"
 		wwlog.Denied(message, req.RemoteAddr)
 		http.Error(w, fmt.Sprintf(message, req.RemoteAddr), http.StatusUnauthorized)
+		entry.Reason = "NON_PRIVILEGED_PORT"
+		return
+	}
+
+	if req.TLS == nil && config.Get().Warewulf.TLS.Required("overlay-file") {
+		message := "overlay files require tls: %s"
+		wwlog.Denied(message, req.RemoteAddr)
+		http.Error(w, fmt.Sprintf(message, req.RemoteAddr), http.StatusForbidden)
+		entry.Reason = "TLS_REQUIRED"
 		return
 	}
 
 	overlayFile := o.File(rinfo.path)
+	entry.File = overlayFile
 	if !path.IsAbs(overlayFile) {
 		message := "Path %s isn't absolute"
 		wwlog.Denied(message, overlayFile)
 		http.Error(w, fmt.Sprintf(message, overlayFile), http.StatusNotFound)
+		entry.Reason = "NOT_FOUND"
 		return
 	}
 
@@ -53,10 +86,12 @@ func OverlaySend(w http.ResponseWriter, req *http.Request) {
 		if rinfo.node != "" && util.IsFile(overlayFile+".ww") {
 			wwlog.Debug("appending .ww for file: %s", overlayFile)
 			overlayFile += ".ww"
+			entry.File = overlayFile
 		} else {
 			message := "file doesn't exists: %s"
 			wwlog.Denied(message, overlayFile)
 			http.Error(w, fmt.Sprintf(message, overlayFile), http.StatusNotFound)
+			entry.Reason = "NOT_FOUND"
 			return
 		}
 	}
@@ -67,6 +102,7 @@ func OverlaySend(w http.ResponseWriter, req *http.Request) {
 			message := "error opening node database: %s"
 			wwlog.ErrorExc(err, message, err)
 			http.Error(w, fmt.Sprintf(message, err), http.StatusNotFound)
+			entry.Reason = "NOT_FOUND"
 			return
 		}
 
@@ -75,6 +111,7 @@ func OverlaySend(w http.ResponseWriter, req *http.Request) {
 			message := "error getting node: %s"
 			wwlog.ErrorExc(err, message, err)
 			http.Error(w, fmt.Sprintf(message, err), http.StatusNotFound)
+			entry.Reason = "NOT_FOUND"
 			return
 		}
 
@@ -83,6 +120,7 @@ func OverlaySend(w http.ResponseWriter, req *http.Request) {
 			message := "error loading nodes from registry: %s"
 			wwlog.ErrorExc(err, message, err)
 			http.Error(w, fmt.Sprintf(message, err), http.StatusInternalServerError)
+			entry.Reason = "INTERNAL_ERROR"
 			return
 		}
 
@@ -91,6 +129,7 @@ func OverlaySend(w http.ResponseWriter, req *http.Request) {
 			message := "error initializing template data: %s"
 			wwlog.ErrorExc(err, message, err)
 			http.Error(w, fmt.Sprintf(message, err), http.StatusInternalServerError)
+			entry.Reason = "INTERNAL_ERROR"
 			return
 		}
 		tstruct.BuildSource = overlayFile
@@ -100,6 +139,7 @@ func OverlaySend(w http.ResponseWriter, req *http.Request) {
 			message := "error rendering overlay template: %s"
 			wwlog.ErrorExc(err, message, err)
 			http.Error(w, fmt.Sprintf(message, err), http.StatusInternalServerError)
+			entry.Reason = "INTERNAL_ERROR"
 			return
 		}
 		w.Header().Set("Content-Length", strconv.Itoa(buffer.Len()))
@@ -108,6 +148,7 @@ func OverlaySend(w http.ResponseWriter, req *http.Request) {
 			message := "error writing overlay template over http connection: %s"
 			wwlog.ErrorExc(err, message, err)
 			http.Error(w, fmt.Sprintf(message, err), http.StatusInternalServerError)
+			entry.Reason = "SEND_FAILED"
 		}
 		wwlog.Info("%s: %s", node.Id(), overlayFile)
 	} else {
@@ -116,6 +157,7 @@ func OverlaySend(w http.ResponseWriter, req *http.Request) {
 			message := "error reading file: %s"
 			wwlog.ErrorExc(err, message, err)
 			http.Error(w, fmt.Sprintf(message, err), http.StatusInternalServerError)
+			entry.Reason = "INTERNAL_ERROR"
 			return
 		}
 		_, err = w.Write(fileBytes)
@@ -123,6 +165,7 @@ func OverlaySend(w http.ResponseWriter, req *http.Request) {
 			message := "error writing overlay file over http connection: %s"
 			wwlog.ErrorExc(err, message, err)
 			http.Error(w, fmt.Sprintf(message, err), http.StatusInternalServerError)
+			entry.Reason = "SEND_FAILED"
 		}
 		wwlog.Info("send overlay file for node %s: %s", rinfo.node, overlayFile)
 	}
@@ -133,6 +176,30 @@ type parserInfoRender struct {
 	path       string
 	node       string
 	remoteport int
+	hwaddr     string
+	timestamp  string
+	token      string
+}
+
+/*
+Checks that an overlay file request is signed by a known node, which
+must be the node the file is rendered for
+*/
+func verifyRenderToken(rinfo parserInfoRender) error {
+	if rinfo.hwaddr == "" {
+		return nodetoken.ErrUnsigned
+	}
+	nodeID := nodeIDByHwaddr(rinfo.hwaddr)
+	if nodeID == "" {
+		return fmt.Errorf("unknown node: %s", rinfo.hwaddr)
+	}
+	if rinfo.node != "" && rinfo.node != nodeID {
+		return fmt.Errorf("node %s requested a file rendered for node %s", nodeID, rinfo.node)
+	}
+	if err := nodetoken.Verify(nodeID, rinfo.hwaddr, rinfo.timestamp, rinfo.token); err != nil {
+		return fmt.Errorf("node %s: %w", nodeID, err)
+	}
+	return nil
 }
 
 func parseReqRender(req *http.Request) (ret parserInfoRender, err error) {
@@ -148,6 +215,15 @@ func parseReqRender(req *http.Request) (ret parserInfoRender, err error) {
 	if len(req.URL.Query()["render"]) > 0 {
 		ret.node = req.URL.Query()["render"][0]
 	}
+	if len(req.URL.Query()["hwaddr"]) > 0 {
+		ret.hwaddr = nodetoken.NormalizeHwaddr(req.URL.Query()["hwaddr"][0])
+	}
+	if len(req.URL.Query()["timestamp"]) > 0 {
+		ret.timestamp = req.URL.Query()["timestamp"][0]
+	}
+	if len(req.URL.Query()["token"]) > 0 {
+		ret.token = req.URL.Query()["token"][0]
+	}
 	if _, remoteport, err := net.SplitHostPort(req.RemoteAddr); err != nil {
 		return ret, fmt.Errorf("could not obtain remote port from HTTP request: %w", err)
 	} else if ret.remoteport, err = strconv.Atoi(remoteport); err != nil {
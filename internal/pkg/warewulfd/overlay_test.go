@@ -1,13 +1,17 @@
 package warewulfd
 
 import (
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
+	"github.com/warewulf/warewulf/internal/pkg/nodetoken"
 	"github.com/warewulf/warewulf/internal/pkg/testenv"
 )
 
@@ -108,3 +112,53 @@ nodes:
 		})
 	}
 }
+
+func Test_OverlaySendNodeToken(t *testing.T) {
+	env := testenv.New(t)
+	defer env.RemoveAll()
+	env.WriteFile("etc/warewulf/warewulf.conf", `
+warewulf:
+  node tokens: true
+`)
+	env.WriteFile("etc/warewulf/nodes.conf", `
+nodes:
+  n1:
+    network devices:
+      default:
+        hwaddr: 00:00:00:ff:ff:ff
+  n2:
+    network devices:
+      default:
+        hwaddr: 00:00:00:00:ff:ff
+`)
+	_ = env.Configure()
+	assert.NoError(t, LoadNodeDB())
+	env.WriteFile("var/lib/warewulf/overlays/pub/rootfs/template.ww", "Template: {{.Id}}")
+
+	secret, err := nodetoken.Get("n1")
+	require.NoError(t, err)
+	signed := func(hwaddr string) string {
+		timestamp := time.Now().Unix()
+		return fmt.Sprintf("hwaddr=%s&timestamp=%d&token=%s", hwaddr, timestamp, nodetoken.Sign(secret, hwaddr, timestamp))
+	}
+
+	tests := map[string]struct {
+		url    string
+		status int
+	}{
+		"unsigned":                     {"/overlay-file/pub/template.ww?render=n1", 401},
+		"signed":                       {"/overlay-file/pub/template.ww?render=n1&" + signed("00:00:00:ff:ff:ff"), 200},
+		"rendered for another node":    {"/overlay-file/pub/template.ww?render=n2&" + signed("00:00:00:ff:ff:ff"), 401},
+		"signed with another node key": {"/overlay-file/pub/template.ww?render=n2&" + signed("00:00:00:00:ff:ff"), 401},
+	}
+	for description, tt := range tests {
+		t.Run(description, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			w := httptest.NewRecorder()
+			OverlaySend(w, req)
+			res := w.Result()
+			defer res.Body.Close()
+			assert.Equal(t, tt.status, res.StatusCode)
+		})
+	}
+}
@@ -19,6 +19,8 @@ type parserInfo struct {
 	overlay    string
 	efifile    string
 	compress   string
+	timestamp  string
+	token      string
 }
 
 func parseReq(req *http.Request) (parserInfo, error) {
@@ -73,6 +75,10 @@ func parseReq(req *http.Request) (parserInfo, error) {
 			ret.stage = "efiboot"
 		} else if stage == "initramfs" {
 			ret.stage = "initramfs"
+		} else if stage == "health" {
+			ret.stage = "health"
+		} else if stage == "notify" {
+			ret.stage = "notify"
 		}
 	}
 
@@ -82,12 +88,19 @@ func parseReq(req *http.Request) (parserInfo, error) {
 	if len(req.URL.Query()["compress"]) > 0 {
 		ret.compress = req.URL.Query()["compress"][0]
 	}
+	if len(req.URL.Query()["timestamp"]) > 0 {
+		ret.timestamp = req.URL.Query()["timestamp"][0]
+	}
+	if len(req.URL.Query()["token"]) > 0 {
+		ret.token = req.URL.Query()["token"][0]
+	}
 	if ret.stage == "" {
 		return ret, errors.New("no stage encoded in GET")
 	}
 	if ret.hwaddr == "" {
-		ret.hwaddr = ArpFind(ret.ipaddr)
-		wwlog.Verbose("node mac not encoded, arp cache got %s for %s", ret.hwaddr, ret.ipaddr)
+		// e.g. UEFI HTTP Boot requests /efiboot/ without the hwaddr
+		ret.hwaddr = hwaddrByIP(ret.ipaddr)
+		wwlog.Verbose("node mac not encoded, got %s for %s", ret.hwaddr, ret.ipaddr)
 		if ret.hwaddr == "" {
 			return ret, errors.New("no hwaddr encoded in GET")
 		}
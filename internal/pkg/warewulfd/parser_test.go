@@ -0,0 +1,47 @@
+package warewulfd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/warewulf/warewulf/internal/pkg/testenv"
+)
+
+func Test_parseReqHwaddrByIP(t *testing.T) {
+	env := testenv.New(t)
+	defer env.RemoveAll()
+	env.WriteFile("etc/warewulf/nodes.conf", `nodes:
+  n1:
+    network devices:
+      default:
+        hwaddr: 00:00:00:FF:FF:FF
+        ipaddr: 10.10.10.10
+  n2:
+    network devices:
+      default:
+        ipaddr: 10.10.10.11`)
+	// the arp cache doesn't know the nodes yet
+	env.WriteFile("/var/tmp/arpcache", `IP address       HW type     Flags       HW address            Mask     Device`)
+	prevArpFile := arpFile
+	arpFile = env.GetPath("/var/tmp/arpcache")
+	defer func() {
+		arpFile = prevArpFile
+	}()
+	require.NoError(t, LoadNodeDB())
+
+	req := httptest.NewRequest(http.MethodGet, "/efiboot/grub.cfg", nil)
+	req.RemoteAddr = "10.10.10.10:9873"
+	rinfo, err := parseReq(req)
+	require.NoError(t, err)
+	assert.Equal(t, "00:00:00:ff:ff:ff", rinfo.hwaddr)
+	assert.Equal(t, "grub.cfg", rinfo.efifile)
+
+	req = httptest.NewRequest(http.MethodGet, "/efiboot/grub.cfg", nil)
+	req.RemoteAddr = "10.10.10.11:9873"
+	_, err = parseReq(req)
+	assert.Error(t, err, "node without hwaddr")
+}
@@ -10,12 +10,14 @@ import (
 	"strconv"
 	"strings"
 	"text/template"
+	"time"
 
 	"github.com/Masterminds/sprig/v3"
 	warewulfconf "github.com/warewulf/warewulf/internal/pkg/config"
 	"github.com/warewulf/warewulf/internal/pkg/image"
 	"github.com/warewulf/warewulf/internal/pkg/kernel"
 	"github.com/warewulf/warewulf/internal/pkg/node"
+	"github.com/warewulf/warewulf/internal/pkg/nodetoken"
 	"github.com/warewulf/warewulf/internal/pkg/overlay"
 	"github.com/warewulf/warewulf/internal/pkg/util"
 	"github.com/warewulf/warewulf/internal/pkg/wwlog"
@@ -34,15 +36,49 @@ type templateVars struct {
 	Port          string
 	KernelArgs    string
 	KernelVersion string
+	Compress      string
 	Tags          map[string]string
 	NetDevs       map[string]*node.NetDev
 }
 
+/*
+Returns true if the request was made from a privileged port or over TLS
+with a verified client certificate
+*/
+func privilegedRequest(req *http.Request, rinfo parserInfo) bool {
+	if req.TLS != nil && len(req.TLS.VerifiedChains) > 0 {
+		return true
+	}
+	return rinfo.remoteport < 1024
+}
+
 func ProvisionSend(w http.ResponseWriter, req *http.Request) {
 	wwlog.Debug("Requested URL: %s", req.URL.String())
+	start := time.Now()
+	sw := newStatusWriter(w)
+	w = sw
+	var rinfo parserInfo
+	var eventNode string
+	var event NodeEvent
+	var entry accessEntry
+	defer func() {
+		metrics.observeRequest(rinfo.stage, sw.Status(), sw.bytes, time.Since(start))
+		if eventNode != "" {
+			event.Bytes = sw.bytes
+			event.Status = sw.Status()
+			event.Duration = time.Since(start).Seconds()
+			addHistory(eventNode, event)
+		}
+		entry.Hwaddr = rinfo.hwaddr
+		entry.Stage = rinfo.stage
+		entry.Overlay = rinfo.overlay
+		logAccess(req, sw, start, &entry)
+	}()
+
 	conf := warewulfconf.Get()
 	rinfo, err := parseReq(req)
 	if err != nil {
+		entry.Reason = "BAD_REQUEST"
 		w.WriteHeader(http.StatusBadRequest)
 		wwlog.ErrorExc(err, "Bad status")
 		return
@@ -52,10 +88,19 @@ func ProvisionSend(w http.ResponseWriter, req *http.Request) {
 
 	wwlog.Info("request from hwaddr:%s ipaddr:%s | stage:%s", rinfo.hwaddr, req.RemoteAddr, rinfo.stage)
 
-	if (rinfo.stage == "runtime" || len(rinfo.overlay) > 0) && conf.Warewulf.Secure() {
+	if req.TLS == nil && conf.Warewulf.TLS.Required(rinfo.stage) {
+		wwlog.Denied("stage %s requires tls: %s", rinfo.stage, req.RemoteAddr)
+		w.WriteHeader(http.StatusForbidden)
+		entry.Reason = "TLS_REQUIRED"
+		return
+	}
+
+	// with node tokens, the signature of the node is checked instead
+	if (rinfo.stage == "runtime" || len(rinfo.overlay) > 0) && conf.Warewulf.Secure() && !conf.Warewulf.NodeTokens() {
 		if rinfo.remoteport >= 1024 {
 			wwlog.Denied("Non-privileged port: %s", req.RemoteAddr)
 			w.WriteHeader(http.StatusUnauthorized)
+			entry.Reason = "NON_PRIVILEGED_PORT"
 			return
 		}
 	}
@@ -78,18 +123,105 @@ func ProvisionSend(w http.ResponseWriter, req *http.Request) {
 	if err != nil && err != node.ErrNoUnconfigured {
 		wwlog.ErrorExc(err, "")
 		w.WriteHeader(http.StatusServiceUnavailable)
+		entry.Reason = "DISCOVERY_FAILED"
+		metrics.observeFailure(rinfo.stage, entry.Reason)
 		return
 	}
 
+	if remoteNode.Valid() {
+		entry.Node = remoteNode.Id()
+	}
+
+	observeFailure := func(r string) {
+		entry.Reason = r
+		metrics.observeFailure(rinfo.stage, r)
+	}
+
+	// records the node status and the event for the node history, which
+	// is completed once the request was served
+	setStatus := func(sent string) {
+		updateStatus(remoteNode.Id(), status_stage, sent, rinfo.ipaddr)
+		eventNode = remoteNode.Id()
+		event = NodeEvent{
+			Time:   start.Unix(),
+			Stage:  status_stage,
+			Sent:   sent,
+			Ipaddr: rinfo.ipaddr,
+		}
+	}
+
 	if remoteNode.AssetKey != "" && remoteNode.AssetKey != rinfo.assetkey {
 		w.WriteHeader(http.StatusUnauthorized)
 		wwlog.Denied("incorrect asset key: node %s: %s", remoteNode.Id(), rinfo.assetkey)
-		updateStatus(remoteNode.Id(), status_stage, "BAD_ASSET", rinfo.ipaddr)
+		setStatus("BAD_ASSET")
+		observeFailure("BAD_ASSET")
+		return
+	}
+
+	// With node tokens, wwclient and dracut sign their requests for the
+	// runtime overlay with the token from the system overlay. The system
+	// overlay itself is only served to privileged ports or TLS clients
+	// with a certificate, which a user on another host can't spoof.
+	if remoteNode.Valid() && conf.Warewulf.NodeTokens() {
+		if rinfo.stage == "runtime" || len(rinfo.overlay) > 0 {
+			if err := nodetoken.Verify(remoteNode.Id(), rinfo.hwaddr, rinfo.timestamp, rinfo.token); err != nil {
+				w.WriteHeader(http.StatusUnauthorized)
+				wwlog.Denied("invalid node token: node %s: %s", remoteNode.Id(), err)
+				setStatus("BAD_TOKEN")
+				observeFailure("BAD_TOKEN")
+				return
+			}
+		} else if rinfo.stage == "system" && !privilegedRequest(req, rinfo) {
+			w.WriteHeader(http.StatusUnauthorized)
+			wwlog.Denied("Non-privileged port: %s", req.RemoteAddr)
+			setStatus("NON_PRIVILEGED_PORT")
+			observeFailure("NON_PRIVILEGED_PORT")
+			return
+		}
+	}
+
+	// shim and grub binaries are requested by the firmware and shim, which
+	// can't send the uuid
+	if remoteNode.Valid() && (rinfo.stage != "efiboot" || rinfo.efifile == "grub.cfg") {
+		if remoteNode.UUID != "" && !strings.EqualFold(remoteNode.UUID, rinfo.uuid) {
+			w.WriteHeader(http.StatusUnauthorized)
+			wwlog.Denied("incorrect uuid: node %s: %s", remoteNode.Id(), rinfo.uuid)
+			setStatus("BAD_ASSET")
+			observeFailure("BAD_ASSET")
+			return
+		} else if remoteNode.UUID == "" && remoteNode.UUIDBinding.Bool() && validUUID(rinfo.uuid) {
+			if err := bindNodeUUID(remoteNode.Id(), rinfo.uuid); err != nil {
+				wwlog.ErrorExc(err, "could not bind uuid")
+				w.WriteHeader(http.StatusServiceUnavailable)
+				setStatus("UUID_BIND_FAILED")
+				observeFailure("UUID_BIND_FAILED")
+				return
+			}
+		}
+	}
+
+	// iPXE can't tell why a download failed, so it asks whether and when
+	// to retry it: only downloads refused by a full transfer queue are
+	// retried, after the same delay as given in Retry-After
+	if remoteNode.Valid() && rinfo.stage == "retry" {
+		retryAfter := 0
+		if lastSent(remoteNode.Id()) == "QUEUE_FULL" {
+			retryAfter = conf.Warewulf.Transfers.RetryAfterSeconds()
+		}
+		w.Header().Set("Content-Type", "text")
+		fmt.Fprintf(w, "#!ipxe\nset retry_after %d\n", retryAfter)
 		return
 	}
 
+	if remoteNode.Valid() {
+		remoteNode = applyBootOnce(remoteNode, rinfo)
+	}
+
 	if !remoteNode.Valid() {
 		wwlog.Error("%s (unknown/unconfigured node)", rinfo.hwaddr)
+		if conf.Warewulf.DiscoveryQueue() {
+			addDiscovered(rinfo)
+		}
 		if rinfo.stage == "ipxe" {
 			stage_file = path.Join(conf.Paths.Sysconfdir, "/warewulf/ipxe/unconfigured.ipxe")
 			tmpl_data = &templateVars{
@@ -120,6 +252,7 @@ func ProvisionSend(w http.ResponseWriter, req *http.Request) {
 			ImageName:     remoteNode.ImageName,
 			KernelArgs:    kernelArgs,
 			KernelVersion: kernelVersion,
+			Compress:      util.CompressParam(conf.Warewulf.CompressionFormat()),
 			NetDevs:       remoteNode.NetDevs,
 			Tags:          remoteNode.Tags}
 	} else if rinfo.stage == "kernel" {
@@ -159,10 +292,12 @@ func ProvisionSend(w http.ResponseWriter, req *http.Request) {
 			if errors.Is(err, overlay.ErrDoesNotExist) {
 				w.WriteHeader(http.StatusNotFound)
 				wwlog.ErrorExc(err, "")
+				observeFailure("NOT_FOUND")
 				return
 			}
 			w.WriteHeader(http.StatusInternalServerError)
 			wwlog.ErrorExc(err, "")
+			observeFailure("INTERNAL_ERROR")
 			return
 		}
 	} else if rinfo.stage == "efiboot" {
@@ -174,6 +309,7 @@ func ProvisionSend(w http.ResponseWriter, req *http.Request) {
 			if stage_file == "" {
 				wwlog.Error("couldn't find shim.efi for %s", imageName)
 				w.WriteHeader(http.StatusNotFound)
+				observeFailure("NOT_FOUND")
 				return
 			}
 		case "grub.efi", "grub-tpm.efi", "grubx64.efi", "grubia32.efi", "grubaa64.efi", "grubarm.efi":
@@ -181,6 +317,7 @@ func ProvisionSend(w http.ResponseWriter, req *http.Request) {
 			if stage_file == "" {
 				wwlog.Error("could't find grub*.efi for %s", imageName)
 				w.WriteHeader(http.StatusNotFound)
+				observeFailure("NOT_FOUND")
 				return
 			}
 		case "grub.cfg":
@@ -207,11 +344,13 @@ func ProvisionSend(w http.ResponseWriter, req *http.Request) {
 				ImageName:     remoteNode.ImageName,
 				KernelArgs:    kernelArgs,
 				KernelVersion: kernelVersion,
+				Compress:      util.CompressParam(conf.Warewulf.CompressionFormat()),
 				NetDevs:       remoteNode.NetDevs,
 				Tags:          remoteNode.Tags}
 			if stage_file == "" {
 				wwlog.Error("could't find grub.cfg template for %s", imageName)
 				w.WriteHeader(http.StatusNotFound)
+				observeFailure("NOT_FOUND")
 				return
 			}
 		default:
@@ -261,6 +400,7 @@ func ProvisionSend(w http.ResponseWriter, req *http.Request) {
 				wwlog.Error("Unsupported %s compressed version for file: %s",
 					rinfo.compress, stage_file)
 				w.WriteHeader(http.StatusNotFound)
+				observeFailure("NOT_FOUND")
 				return
 			}
 
@@ -272,6 +412,7 @@ func ProvisionSend(w http.ResponseWriter, req *http.Request) {
 			if err != nil {
 				w.WriteHeader(http.StatusInternalServerError)
 				wwlog.ErrorExc(err, "")
+				observeFailure("INTERNAL_ERROR")
 				return
 			}
 
@@ -282,6 +423,7 @@ func ProvisionSend(w http.ResponseWriter, req *http.Request) {
 			if err != nil {
 				w.WriteHeader(http.StatusInternalServerError)
 				wwlog.ErrorExc(err, "")
+				observeFailure("INTERNAL_ERROR")
 				return
 			}
 
@@ -295,39 +437,98 @@ func ProvisionSend(w http.ResponseWriter, req *http.Request) {
 			wwlog.Info("send %s -> %s", stage_file, remoteNode.Id())
 
 		} else {
-			if rinfo.compress == "gz" {
-				stage_file += ".gz"
+			format, ok := util.CompressFormat(rinfo.compress)
+			if !ok {
+				wwlog.Error("unsupported %s compressed version of file %s",
+					rinfo.compress, stage_file)
+				w.WriteHeader(http.StatusNotFound)
+				observeFailure("NOT_FOUND")
+				return
+			}
+
+			// overlays are sent with an ETag, so that nodes only download
+			// overlays which changed
+			var etag string
+			if rinfo.stage == "system" || rinfo.stage == "runtime" {
+				etag, err = overlayETag(stage_file, format)
+				if err != nil {
+					w.WriteHeader(http.StatusInternalServerError)
+					wwlog.ErrorExc(err, "")
+					observeFailure("INTERNAL_ERROR")
+					return
+				}
+			}
+
+			if format != util.CompressNone {
+				stage_file = util.CompressedFile(stage_file, format)
 
 				if !util.IsFile(stage_file) {
-					wwlog.Error("unprepared for compressed version of file %s",
-						stage_file)
+					wwlog.Error("no %s compressed version of file %s, rebuild it or request it uncompressed (warewulf:compression is %s)",
+						format, stage_file, conf.Warewulf.CompressionFormat())
 					w.WriteHeader(http.StatusNotFound)
+					observeFailure("NOT_FOUND")
 					return
 				}
-			} else if rinfo.compress != "" {
-				wwlog.Error("unsupported %s compressed version of file %s",
-					rinfo.compress, stage_file)
-				w.WriteHeader(http.StatusNotFound)
+			}
+
+			// the runtime overlay of the node, as opposed to specific
+			// overlays, is tracked in the node status
+			nodeRuntime := rinfo.stage == "runtime" && len(rinfo.overlay) == 0
+			if etag != "" {
+				w.Header().Set("ETag", etag)
+				if etagMatch(req.Header.Get("If-None-Match"), etag) {
+					w.WriteHeader(http.StatusNotModified)
+					wwlog.Verbose("%s not modified for %s", stage_file, remoteNode.Id())
+					if nodeRuntime {
+						setRuntimeETag(remoteNode.Id(), etag)
+					}
+					setStatus("NOT_MODIFIED")
+					return
+				}
+			}
+
+			if transferStages[rinfo.stage] {
+				release, err := transfers.acquire(req.Context(), rinfo.stage, conf.Warewulf.Transfers)
+				if errors.Is(err, errQueueFull) {
+					w.Header().Set("Retry-After", strconv.Itoa(conf.Warewulf.Transfers.RetryAfterSeconds()))
+					w.WriteHeader(http.StatusServiceUnavailable)
+					wwlog.Warn("transfer queue full, refusing %s for %s", rinfo.stage, remoteNode.Id())
+					setStatus("QUEUE_FULL")
+					observeFailure("QUEUE_FULL")
+					return
+				} else if err != nil {
+					wwlog.Verbose("%s gave up waiting for transfer of %s: %s", remoteNode.Id(), stage_file, err)
+					return
+				}
+				defer release()
+				w = transfers.limitWriter(req.Context(), w, conf.Warewulf.Transfers)
 			}
 
 			err = sendFile(w, req, stage_file, remoteNode.Id())
 			if err != nil {
 				wwlog.ErrorExc(err, "")
+				observeFailure("SEND_FAILED")
 				return
 			}
+			if nodeRuntime && etag != "" {
+				setRuntimeETag(remoteNode.Id(), etag)
+			}
 		}
 
-		updateStatus(remoteNode.Id(), status_stage, path.Base(stage_file), rinfo.ipaddr)
+		entry.File = stage_file
+		setStatus(path.Base(stage_file))
 
 	} else if stage_file == "" {
 		w.WriteHeader(http.StatusBadRequest)
 		wwlog.Error("No resource selected")
-		updateStatus(remoteNode.Id(), status_stage, "BAD_REQUEST", rinfo.ipaddr)
+		setStatus("BAD_REQUEST")
+		observeFailure("BAD_REQUEST")
 
 	} else {
 		w.WriteHeader(http.StatusNotFound)
 		wwlog.Error("Not found: %s", stage_file)
-		updateStatus(remoteNode.Id(), status_stage, "NOT_FOUND", rinfo.ipaddr)
+		setStatus("NOT_FOUND")
+		observeFailure("NOT_FOUND")
 	}
 
 }
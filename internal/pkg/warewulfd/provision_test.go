@@ -1,16 +1,24 @@
 package warewulfd
 
 import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
+	"github.com/warewulf/warewulf/internal/pkg/conffile"
 	warewulfconf "github.com/warewulf/warewulf/internal/pkg/config"
+	"github.com/warewulf/warewulf/internal/pkg/node"
+	"github.com/warewulf/warewulf/internal/pkg/nodetoken"
 	"github.com/warewulf/warewulf/internal/pkg/testenv"
 )
 
@@ -110,3 +118,279 @@ nodes:
 		})
 	}
 }
+
+/*
+Creates a test environment with the given nodes.conf for requests of the
+nodes. Secure mode is off, the status DB starts out empty and a system
+overlay image is written for each of the given nodes. The environment is
+removed and the status DB is reset when the test ends.
+*/
+func provisionTestEnv(t *testing.T, nodesConf string, systemOverlays ...string) *testenv.TestEnv {
+	env := testenv.New(t)
+	t.Cleanup(env.RemoveAll)
+	env.WriteFile("etc/warewulf/nodes.conf", nodesConf)
+	require.NoError(t, LoadNodeDB())
+	statusDB.Nodes = make(map[string]*NodeStatus)
+	t.Cleanup(func() {
+		statusDB.Nodes = make(map[string]*NodeStatus)
+	})
+	secureFalse := false
+	warewulfconf.Get().Warewulf.SecureP = &secureFalse
+	for _, nodeID := range systemOverlays {
+		writeOverlayImage(t, nodeID, "__SYSTEM__.img", "system overlay")
+	}
+	return env
+}
+
+/*
+Writes an overlay image of a node to the provision directory and returns
+its path
+*/
+func writeOverlayImage(t *testing.T, nodeID, name, content string) string {
+	fileName := path.Join(warewulfconf.Get().Paths.OverlayProvisiondir(), nodeID, name)
+	require.NoError(t, os.MkdirAll(path.Dir(fileName), 0700))
+	require.NoError(t, os.WriteFile(fileName, []byte(content), 0600))
+	return fileName
+}
+
+func Test_ProvisionSendTLSRequired(t *testing.T) {
+	provisionTestEnv(t, `nodes:
+  n1:
+    network devices:
+      default:
+        hwaddr: 00:00:00:ff:ff:ff`, "n1")
+	writeOverlayImage(t, "n1", "__RUNTIME__.img", "runtime overlay")
+
+	conf := warewulfconf.Get()
+	tlsTrue := true
+	conf.Warewulf.TLS.EnabledP = &tlsTrue
+	conf.Warewulf.TLS.Stages = []string{"runtime"}
+
+	tests := map[string]struct {
+		url    string
+		tls    bool
+		status int
+	}{
+		"system overlay over http":  {"/overlay-system/00:00:00:ff:ff:ff", false, 200},
+		"runtime overlay over http": {"/overlay-runtime/00:00:00:ff:ff:ff", false, 403},
+		"runtime overlay over tls":  {"/overlay-runtime/00:00:00:ff:ff:ff", true, 200},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			req.RemoteAddr = "10.10.10.10:987"
+			if tt.tls {
+				req.TLS = &tls.ConnectionState{}
+			}
+			w := httptest.NewRecorder()
+			ProvisionSend(w, req)
+			res := w.Result()
+			defer res.Body.Close()
+			assert.Equal(t, tt.status, res.StatusCode)
+		})
+	}
+}
+
+func Test_ProvisionSendUUID(t *testing.T) {
+	provisionTestEnv(t, `nodes:
+  n1:
+    uuid: 4C4C4544-0000-1010-8000-B2C04F000001
+    network devices:
+      default:
+        hwaddr: 00:00:00:ff:ff:ff
+  n2:
+    uuid binding: true
+    network devices:
+      default:
+        hwaddr: 00:00:00:00:ff:ff
+  n3:
+    uuid binding: true
+    network devices:
+      default:
+        hwaddr: 00:00:00:00:00:ff`, "n1", "n2", "n3")
+
+	// the steps depend on each other, as the first valid uuid is recorded
+	steps := []struct {
+		description string
+		url         string
+		status      int
+	}{
+		{"pre-seeded uuid", "/overlay-system/00:00:00:ff:ff:ff?uuid=4c4c4544-0000-1010-8000-b2c04f000001", 200},
+		{"wrong pre-seeded uuid", "/overlay-system/00:00:00:ff:ff:ff?uuid=4c4c4544-0000-1010-8000-b2c04f000002", 401},
+		{"missing pre-seeded uuid", "/overlay-system/00:00:00:ff:ff:ff", 401},
+		{"invalid uuid is not bound", "/overlay-system/00:00:00:00:ff:ff?uuid=00000000-0000-0000-0000-000000000000", 200},
+		{"first uuid is bound", "/overlay-system/00:00:00:00:ff:ff?uuid=4C4C4544-0000-1010-8000-B2C04F000003", 200},
+		{"bound uuid", "/overlay-system/00:00:00:00:ff:ff?uuid=4c4c4544-0000-1010-8000-b2c04f000003", 200},
+		{"other uuid", "/overlay-system/00:00:00:00:ff:ff?uuid=4c4c4544-0000-1010-8000-b2c04f000004", 401},
+	}
+	for _, tt := range steps {
+		t.Run(tt.description, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			req.RemoteAddr = "10.10.10.10:987"
+			w := httptest.NewRecorder()
+			ProvisionSend(w, req)
+			res := w.Result()
+			defer res.Body.Close()
+			assert.Equal(t, tt.status, res.StatusCode)
+		})
+	}
+
+	registry, err := node.New()
+	assert.NoError(t, err)
+	n2, err := registry.GetNode("n2")
+	assert.NoError(t, err)
+	assert.Equal(t, "4c4c4544-0000-1010-8000-b2c04f000003", n2.UUID)
+	dbLock.RLock()
+	assert.Equal(t, "BAD_ASSET", statusDB.Nodes["n2"].Sent)
+	dbLock.RUnlock()
+
+	// a uuid which can't be bound is refused with a reason
+	defer func(timeout time.Duration) { conffile.LockTimeout = timeout }(conffile.LockTimeout)
+	conffile.LockTimeout = 0
+	lock, err := node.Lock()
+	require.NoError(t, err)
+	defer lock.Unlock()
+	req := httptest.NewRequest(http.MethodGet, "/overlay-system/00:00:00:00:00:ff?uuid=4c4c4544-0000-1010-8000-b2c04f000005", nil)
+	req.RemoteAddr = "10.10.10.10:987"
+	w := httptest.NewRecorder()
+	ProvisionSend(w, req)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Result().StatusCode)
+	dbLock.RLock()
+	assert.Equal(t, "UUID_BIND_FAILED", statusDB.Nodes["n3"].Sent)
+	dbLock.RUnlock()
+}
+
+func Test_validUUID(t *testing.T) {
+	assert.True(t, validUUID("4C4C4544-0000-1010-8000-B2C04F000001"))
+	assert.False(t, validUUID(""))
+	assert.False(t, validUUID("00000000-0000-0000-0000-000000000000"))
+	assert.False(t, validUUID("FFFFFFFF-FFFF-FFFF-FFFF-FFFFFFFFFFFF"))
+	assert.False(t, validUUID("4c4c4544"))
+}
+
+func Test_ProvisionSendNodeToken(t *testing.T) {
+	provisionTestEnv(t, `nodes:
+  n1:
+    network devices:
+      default:
+        hwaddr: 00:00:00:ff:ff:ff
+  n2:
+    network devices:
+      default:
+        hwaddr: 00:00:00:00:ff:ff`, "n1")
+	writeOverlayImage(t, "n1", "__RUNTIME__.img", "runtime overlay")
+
+	tokensTrue := true
+	warewulfconf.Get().Warewulf.NodeTokensP = &tokensTrue
+
+	secret, err := nodetoken.Get("n1")
+	require.NoError(t, err)
+	other, err := nodetoken.Get("n2")
+	require.NoError(t, err)
+	signed := func(secret string) string {
+		timestamp := time.Now().Unix()
+		return fmt.Sprintf("timestamp=%d&token=%s", timestamp, nodetoken.Sign(secret, "00:00:00:ff:ff:ff", timestamp))
+	}
+
+	tests := map[string]struct {
+		url    string
+		port   int
+		status int
+	}{
+		"system overlay":                                {"/overlay-system/00:00:00:ff:ff:ff", 987, 200},
+		"system overlay from unprivileged port":         {"/overlay-system/00:00:00:ff:ff:ff", 40000, 401},
+		"unsigned runtime overlay":                      {"/overlay-runtime/00:00:00:ff:ff:ff", 40000, 401},
+		"runtime overlay":                               {"/overlay-runtime/00:00:00:ff:ff:ff?" + signed(secret), 40000, 200},
+		"runtime overlay of another node":               {"/overlay-runtime/00:00:00:ff:ff:ff?" + signed(other), 987, 401},
+		"unsigned runtime overlay from privileged port": {"/overlay-runtime/00:00:00:ff:ff:ff", 987, 401},
+		"runtime overlay by stage":                      {"/provision/00:00:00:ff:ff:ff?stage=runtime&" + signed(secret), 40000, 200},
+		"unsigned runtime overlay of dracut":            {"/provision/00:00:00:ff:ff:ff?stage=runtime&assetkey=&uuid=&compress=", 987, 401},
+		"runtime overlay of dracut":                     {"/provision/00:00:00:ff:ff:ff?stage=runtime&assetkey=&uuid=&compress=&" + signed(secret), 987, 200},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			req.RemoteAddr = fmt.Sprintf("10.10.10.10:%d", tt.port)
+			w := httptest.NewRecorder()
+			ProvisionSend(w, req)
+			res := w.Result()
+			defer res.Body.Close()
+			assert.Equal(t, tt.status, res.StatusCode)
+		})
+	}
+}
+
+func Test_ProvisionSendETag(t *testing.T) {
+	provisionTestEnv(t, `nodes:
+  n1:
+    network devices:
+      default:
+        hwaddr: 00:00:00:ff:ff:ff`)
+	runtimeImage := writeOverlayImage(t, "n1", "__RUNTIME__.img", "runtime overlay")
+	writeOverlayImage(t, "n1", "__RUNTIME__.img.gz", "compressed runtime overlay")
+
+	get := func(url string, ifNoneMatch string) *http.Response {
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		req.RemoteAddr = "10.10.10.10:987"
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		ProvisionSend(w, req)
+		return w.Result()
+	}
+	runtimeOverlay := func() string {
+		var status allStatus
+		data, err := statusJSON()
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(data, &status))
+		if n, ok := status.Nodes["n1"]; ok {
+			return n.RuntimeOverlay
+		}
+		return ""
+	}
+
+	assert.Equal(t, "", runtimeOverlay(), "unknown before the first download")
+	res := get("/overlay-runtime/00:00:00:ff:ff:ff", "")
+	defer res.Body.Close()
+	assert.Equal(t, 200, res.StatusCode)
+	etag := res.Header.Get("ETag")
+	assert.Regexp(t, `^"[0-9a-f]{64}"$`, etag)
+	assert.Equal(t, "current", runtimeOverlay())
+
+	res = get("/overlay-runtime/00:00:00:ff:ff:ff", etag)
+	defer res.Body.Close()
+	assert.Equal(t, 304, res.StatusCode)
+	body, err := io.ReadAll(res.Body)
+	assert.NoError(t, err)
+	assert.Empty(t, body)
+	assert.Equal(t, "NOT_MODIFIED", statusDB.Nodes["n1"].Sent)
+
+	// compressed overlays have their own ETag
+	res = get("/overlay-runtime/00:00:00:ff:ff:ff?compress=gz", etag)
+	defer res.Body.Close()
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, etag[:len(etag)-1]+`-gzip"`, res.Header.Get("ETag"))
+	res = get("/overlay-runtime/00:00:00:ff:ff:ff?compress=gz", res.Header.Get("ETag"))
+	defer res.Body.Close()
+	assert.Equal(t, 304, res.StatusCode)
+	assert.Equal(t, "current", runtimeOverlay())
+
+	// a rebuilt overlay is sent again
+	assert.NoError(t, os.WriteFile(runtimeImage, []byte("changed runtime overlay"), 0600))
+	assert.Equal(t, "outdated", runtimeOverlay())
+	res = get("/overlay-runtime/00:00:00:ff:ff:ff", etag)
+	defer res.Body.Close()
+	assert.Equal(t, 200, res.StatusCode)
+	assert.NotEqual(t, etag, res.Header.Get("ETag"))
+	assert.Equal(t, "current", runtimeOverlay())
+}
+
+func Test_etagMatch(t *testing.T) {
+	assert.True(t, etagMatch(`"a"`, `"a"`))
+	assert.True(t, etagMatch(`"b", "a"`, `"a"`))
+	assert.True(t, etagMatch(`W/"a"`, `"a"`))
+	assert.True(t, etagMatch(`*`, `"a"`))
+	assert.False(t, etagMatch(``, `"a"`))
+	assert.False(t, etagMatch(`"a-gzip"`, `"a"`))
+}
@@ -0,0 +1,113 @@
+package warewulfd
+
+import (
+	"fmt"
+	"net"
+	"path"
+	"strings"
+	"time"
+
+	warewulfconf "github.com/warewulf/warewulf/internal/pkg/config"
+	"github.com/warewulf/warewulf/internal/pkg/dhcp"
+	"github.com/warewulf/warewulf/internal/pkg/wwlog"
+)
+
+/*
+proxyDHCP responder, which answers PXE clients with the boot file for
+their architecture and leaves address assignment to a DHCP server which
+is not managed by Warewulf.
+*/
+
+// ports of the proxyDHCP listeners
+var (
+	proxyDHCPPort = dhcp.ServerPort
+	pxePort       = dhcp.PXEPort
+)
+
+/*
+Returns the key of the client architecture in warewulf.conf:tftp:ipxe
+*/
+func archKey(arch uint16) string {
+	return fmt.Sprintf("%02X:%02X", arch>>8, arch&0xff)
+}
+
+/*
+Returns the boot file for a PXE client: iPXE chains to the iPXE script
+of warewulfd, while PXE firmware gets the iPXE binary, or shim with
+grubboot, for its architecture from TFTP. UEFI HTTP Boot clients load
+shim from warewulfd.
+*/
+func proxyBootFile(req *dhcp.Packet) (filename string, ok bool) {
+	conf := warewulfconf.Get()
+	arch, _ := req.Arch()
+	if dhcp.IsHTTPClient(req) {
+		if !conf.DHCP.HTTPBoot() {
+			wwlog.Verbose("proxydhcp: ignoring http boot client, dhcp:http boot is disabled: %s", req.Chaddr)
+			return "", false
+		}
+		filename = fmt.Sprintf("http://%s:%d/efiboot/shim.efi", conf.Ipaddr, conf.Warewulf.Port)
+	} else if req.UserClass() == "iPXE" {
+		filename = fmt.Sprintf("http://%s:%d/ipxe/${mac:hexhyp}?assetkey=${asset}&uuid=${uuid}", conf.Ipaddr, conf.Warewulf.Port)
+	} else if conf.Warewulf.GrubBoot() && arch != 0 {
+		filename = "warewulf/shim.efi"
+	} else {
+		for key, binary := range conf.TFTP.IpxeBinaries {
+			if strings.EqualFold(key, archKey(arch)) {
+				filename = path.Join("warewulf", path.Base(binary))
+				break
+			}
+		}
+	}
+	hwaddr := req.Chaddr.String()
+	if filename == "" {
+		wwlog.Warn("proxydhcp: no boot file for architecture %s: %s", archKey(arch), hwaddr)
+		return "", false
+	}
+	wwlog.Serv("proxydhcp: %s (arch %s) -> %s", hwaddr, archKey(arch), filename)
+
+	if nodeID := nodeIDByHwaddr(hwaddr); nodeID != "" {
+		sent := path.Base(filename)
+		if req.UserClass() == "iPXE" {
+			sent = "ipxe"
+		}
+		updateStatus(nodeID, "DHCP", sent, "")
+		addHistory(nodeID, NodeEvent{
+			Time:  time.Now().Unix(),
+			Stage: "DHCP",
+			Sent:  sent,
+		})
+	}
+	return filename, true
+}
+
+/*
+Starts proxyDHCP listeners on the DHCP server port, which receives the
+broadcasts of clients without an address, and on the PXE port of the
+given addresses. Errors of running listeners are sent to errs.
+*/
+func startProxyDHCP(addrs []string, errs chan<- error) (conns []net.PacketConn, err error) {
+	if len(addrs) == 0 {
+		return nil, nil
+	}
+	serverIP := net.ParseIP(warewulfconf.Get().Ipaddr).To4()
+	if serverIP == nil {
+		return nil, fmt.Errorf("proxydhcp requires an IPv4 address in warewulf.conf:ipaddr")
+	}
+	server := &dhcp.ProxyServer{ServerIP: serverIP, BootFile: proxyBootFile}
+	// broadcasts are only received on the unspecified address
+	for _, addr := range append([]string{fmt.Sprintf("0.0.0.0:%d", proxyDHCPPort)}, addrs...) {
+		conn, err := net.ListenPacket("udp4", addr)
+		if err != nil {
+			closeConns(conns)
+			return nil, err
+		}
+		conns = append(conns, conn)
+		go func() {
+			if err := server.Serve(conn); err != nil {
+				errs <- err
+			}
+		}()
+		wwlog.Info("listening for proxydhcp requests on %s", addr)
+	}
+	return conns, nil
+}
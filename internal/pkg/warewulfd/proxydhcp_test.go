@@ -0,0 +1,131 @@
+package warewulfd
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	warewulfconf "github.com/warewulf/warewulf/internal/pkg/config"
+	"github.com/warewulf/warewulf/internal/pkg/dhcp"
+	"github.com/warewulf/warewulf/internal/pkg/testenv"
+)
+
+func pxeRequest(msgType byte, arch uint16, userClass string) *dhcp.Packet {
+	hwaddr, _ := net.ParseMAC("00:00:00:ff:ff:ff")
+	req := &dhcp.Packet{
+		Op:     1,
+		Xid:    42,
+		Chaddr: hwaddr,
+		Options: map[byte][]byte{
+			dhcp.OptMessageType: {msgType},
+			dhcp.OptVendorClass: []byte("PXEClient:Arch:00007:UNDI:003016"),
+			dhcp.OptClientArch:  {byte(arch >> 8), byte(arch)},
+		},
+	}
+	if userClass != "" {
+		req.Options[dhcp.OptUserClass] = []byte(userClass)
+	}
+	return req
+}
+
+func Test_proxyBootFile(t *testing.T) {
+	env := testenv.New(t)
+	defer env.RemoveAll()
+	env.WriteFile("etc/warewulf/nodes.conf", `nodes:
+  n1:
+    network devices:
+      default:
+        hwaddr: 00:00:00:ff:ff:ff`)
+	assert.NoError(t, LoadNodeDB())
+	statusDB.Nodes = make(map[string]*NodeStatus)
+	defer func() {
+		statusDB.Nodes = make(map[string]*NodeStatus)
+	}()
+
+	conf := warewulfconf.Get()
+	conf.Ipaddr = "10.0.0.1"
+	conf.Warewulf.Port = 9873
+	conf.TFTP.IpxeBinaries = map[string]string{
+		"00:00": "undionly.kpxe",
+		"00:07": "ipxe-snponly-x86_64.efi",
+		"00:0B": "arm64-efi/snponly.efi",
+	}
+
+	tests := map[string]struct {
+		arch      uint16
+		userClass string
+		grubBoot  bool
+		httpBoot  bool
+		filename  string
+		ok        bool
+	}{
+		"bios":               {arch: 0, filename: "warewulf/undionly.kpxe", ok: true},
+		"efi x86_64":         {arch: 7, filename: "warewulf/ipxe-snponly-x86_64.efi", ok: true},
+		"efi arm64":          {arch: 0xb, filename: "warewulf/snponly.efi", ok: true},
+		"ipxe":               {arch: 7, userClass: "iPXE", filename: "http://10.0.0.1:9873/ipxe/${mac:hexhyp}?assetkey=${asset}&uuid=${uuid}", ok: true},
+		"grubboot":           {arch: 7, grubBoot: true, filename: "warewulf/shim.efi", ok: true},
+		"unknown":            {arch: 0x10, ok: false},
+		"http boot":          {arch: 0x10, userClass: "HTTPClient", httpBoot: true, filename: "http://10.0.0.1:9873/efiboot/shim.efi", ok: true},
+		"http boot disabled": {arch: 0x10, userClass: "HTTPClient", ok: false},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			conf.Warewulf.GrubBootP = &tt.grubBoot
+			conf.DHCP.HTTPBootP = &tt.httpBoot
+			req := pxeRequest(dhcp.MsgDiscover, tt.arch, "")
+			if tt.userClass == "HTTPClient" {
+				req.Options[dhcp.OptVendorClass] = []byte("HTTPClient:Arch:00016:UNDI:003016")
+			} else if tt.userClass != "" {
+				req.Options[dhcp.OptUserClass] = []byte(tt.userClass)
+			}
+			filename, ok := proxyBootFile(req)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.filename, filename)
+		})
+	}
+
+	require.Contains(t, statusDB.Nodes, "n1")
+	assert.Equal(t, "DHCP", statusDB.Nodes["n1"].Stage)
+}
+
+func Test_startProxyDHCP(t *testing.T) {
+	env := testenv.New(t)
+	defer env.RemoveAll()
+	assert.NoError(t, LoadNodeDB())
+
+	conf := warewulfconf.Get()
+	conf.Ipaddr = "10.0.0.1"
+	conf.TFTP.IpxeBinaries = map[string]string{"00:07": "ipxe-snponly-x86_64.efi"}
+
+	prevPort := proxyDHCPPort
+	proxyDHCPPort = 0
+	defer func() {
+		proxyDHCPPort = prevPort
+	}()
+	errs := make(chan error, 2)
+	conns, err := startProxyDHCP([]string{"127.0.0.1:0"}, errs)
+	require.NoError(t, err)
+	require.Len(t, conns, 2)
+	defer closeConns(conns)
+
+	client, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer client.Close()
+	req := pxeRequest(dhcp.MsgRequest, 7, "")
+	req.Ciaddr = net.ParseIP("127.0.0.1")
+	_, err = client.WriteTo(req.Marshal(), conns[1].LocalAddr())
+	require.NoError(t, err)
+
+	buf := make([]byte, 1500)
+	require.NoError(t, client.SetReadDeadline(time.Now().Add(2*time.Second)))
+	n, _, err := client.ReadFrom(buf)
+	require.NoError(t, err)
+	reply, err := dhcp.Parse(buf[:n])
+	require.NoError(t, err)
+	assert.Equal(t, byte(dhcp.MsgAck), reply.MessageType())
+	assert.Equal(t, "warewulf/ipxe-snponly-x86_64.efi", reply.File)
+	assert.Equal(t, "10.0.0.1", reply.Siaddr.String())
+}
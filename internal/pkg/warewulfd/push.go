@@ -0,0 +1,299 @@
+package warewulfd
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	warewulfconf "github.com/warewulf/warewulf/internal/pkg/config"
+	"github.com/warewulf/warewulf/internal/pkg/hostlist"
+	"github.com/warewulf/warewulf/internal/pkg/wwlog"
+)
+
+/*
+Immediate updates of runtime overlays. wwclient waits on /notify/<hwaddr>
+until warewulfd tells it to update, which happens as soon as the runtime
+overlay of the node changed or an update is pushed to the node on /push.
+Otherwise the request times out and wwclient waits again.
+*/
+
+// time a notification request is held open before it is answered with
+// 204 No Content
+var notifyTimeout = 50 * time.Second
+
+// interval in which the runtime overlay of a waiting node is checked
+var notifyCheckInterval = 2 * time.Second
+
+// default time in seconds a push waits for the nodes to report back
+const defaultPushTimeout = 60
+
+// PushResult is the outcome of an update pushed to a node.
+type PushResult struct {
+	Node   string `json:"node"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Statuses of a PushResult
+const (
+	PushUpdated      = "updated"
+	PushFailed       = "failed"
+	PushNotConnected = "not connected"
+	PushTimeout      = "timeout"
+	PushUnknownNode  = "unknown node"
+)
+
+var (
+	notifyWaiters     = make(map[string]map[chan struct{}]struct{})
+	notifyWaitersLock = sync.Mutex{}
+)
+
+/*
+Registers a wwclient waiting for a notification of the node. The
+returned channel must be released with removeNotifyWaiter.
+*/
+func addNotifyWaiter(nodeID string) chan struct{} {
+	ch := make(chan struct{}, 1)
+	notifyWaitersLock.Lock()
+	defer notifyWaitersLock.Unlock()
+	if notifyWaiters[nodeID] == nil {
+		notifyWaiters[nodeID] = make(map[chan struct{}]struct{})
+	}
+	notifyWaiters[nodeID][ch] = struct{}{}
+	return ch
+}
+
+func removeNotifyWaiter(nodeID string, ch chan struct{}) {
+	notifyWaitersLock.Lock()
+	defer notifyWaitersLock.Unlock()
+	delete(notifyWaiters[nodeID], ch)
+	if len(notifyWaiters[nodeID]) == 0 {
+		delete(notifyWaiters, nodeID)
+	}
+}
+
+/*
+Tells the waiting wwclients of a node to update. Returns false if no
+wwclient of the node is waiting.
+*/
+func notifyNode(nodeID string) bool {
+	notifyWaitersLock.Lock()
+	defer notifyWaitersLock.Unlock()
+	for ch := range notifyWaiters[nodeID] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+	return len(notifyWaiters[nodeID]) > 0
+}
+
+/*
+Returns true if the runtime overlay the node fetched last is outdated.
+Nodes which never fetched their runtime overlay from this warewulfd are
+not notified, so that they aren't told to update over and over.
+*/
+func runtimeOverlayOutdated(nodeID string) bool {
+	dbLock.RLock()
+	etag := ""
+	if n, ok := statusDB.Nodes[nodeID]; ok {
+		etag = n.RuntimeETag
+	}
+	dbLock.RUnlock()
+	if etag == "" {
+		return false
+	}
+	current, err := runtimeOverlayCurrent(nodeID, etag)
+	return err == nil && !current
+}
+
+/*
+Holds the notification request of wwclient open until the node has to
+update its runtime overlay, which is answered with 200, or until the
+request times out, which is answered with 204. Requests are
+authenticated like runtime overlay requests.
+*/
+func NotifySend(w http.ResponseWriter, req *http.Request) {
+	start := time.Now()
+	sw := newStatusWriter(w)
+	w = sw
+	entry := accessEntry{Stage: "notify"}
+	defer logAccess(req, sw, start, &entry)
+
+	conf := warewulfconf.Get()
+	rinfo, err := parseReq(req)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		wwlog.ErrorExc(err, "Bad notification request")
+		entry.Reason = "BAD_REQUEST"
+		return
+	}
+	entry.Hwaddr = rinfo.hwaddr
+
+	if req.TLS == nil && conf.Warewulf.TLS.Required(rinfo.stage) {
+		wwlog.Denied("stage %s requires tls: %s", rinfo.stage, req.RemoteAddr)
+		w.WriteHeader(http.StatusForbidden)
+		entry.Reason = "TLS_REQUIRED"
+		return
+	}
+
+	nodeID, _, ok := authNode(w, req, rinfo, "notification request", &entry)
+	if !ok {
+		return
+	}
+
+	notified := addNotifyWaiter(nodeID)
+	defer removeNotifyWaiter(nodeID, notified)
+	timeout := time.NewTimer(notifyTimeout)
+	defer timeout.Stop()
+	check := time.NewTicker(notifyCheckInterval)
+	defer check.Stop()
+	wwlog.Debug("%s waits for notifications", nodeID)
+	for {
+		if runtimeOverlayOutdated(nodeID) {
+			wwlog.Verbose("notifying %s of its changed runtime overlay", nodeID)
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		select {
+		case <-notified:
+			wwlog.Verbose("notifying %s of a pushed update", nodeID)
+			w.WriteHeader(http.StatusOK)
+			return
+		case <-check.C:
+		case <-timeout.C:
+			w.WriteHeader(http.StatusNoContent)
+			return
+		case <-serverDone:
+			w.WriteHeader(http.StatusNoContent)
+			return
+		case <-req.Context().Done():
+			entry.Reason = "CANCELED"
+			return
+		}
+	}
+}
+
+/*
+Returns true if the request was made from the Warewulf server itself
+*/
+func localRequest(req *http.Request) bool {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	if ip.IsLoopback() {
+		return true
+	}
+	if local, ok := req.Context().Value(http.LocalAddrContextKey).(*net.TCPAddr); ok {
+		return local.IP.Equal(ip)
+	}
+	return false
+}
+
+/*
+Pushes an update of the runtime overlay to the nodes given in node query
+parameters, which may contain host ranges, and responds with the outcome
+for each node once all nodes reported back or the timeout query
+parameter, in seconds, passed. Pushes are only accepted from the Warewulf
+server itself.
+*/
+func PushSend(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !localRequest(req) {
+		wwlog.Denied("push from remote host: %s", req.RemoteAddr)
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	nodeNames := hostlist.Expand(req.URL.Query()["node"])
+	if len(nodeNames) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	timeout := defaultPushTimeout
+	if value := req.URL.Query().Get("timeout"); value != "" {
+		var err error
+		if timeout, err = strconv.Atoi(value); err != nil || timeout <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	results := pushUpdates(req.Context(), nodeNames, time.Duration(timeout)*time.Second)
+	data, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		wwlog.Error("could not marshal JSON data from push results: %s", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(data); err != nil {
+		wwlog.Warn("Could not send push results: %s", err)
+	}
+}
+
+/*
+Notifies the waiting wwclients of the nodes and waits for their health
+reports, which tell whether the update succeeded
+*/
+func pushUpdates(ctx context.Context, nodeNames []string, timeout time.Duration) []PushResult {
+	// subscribe before notifying, so that no report is missed
+	events := subscribeStatus()
+	defer unsubscribeStatus(events)
+	start := time.Now().Unix()
+
+	results := make([]PushResult, len(nodeNames))
+	waiting := make(map[string]int)
+	db.lock.RLock()
+	for i, nodeName := range nodeNames {
+		results[i].Node = nodeName
+		if _, err := db.yml.GetNode(nodeName); err != nil {
+			results[i].Status = PushUnknownNode
+		} else if !notifyNode(nodeName) {
+			results[i].Status = PushNotConnected
+		} else {
+			results[i].Status = PushTimeout
+			waiting[nodeName] = i
+		}
+	}
+	db.lock.RUnlock()
+	wwlog.Info("pushed runtime overlay update to %d of %d nodes", len(waiting), len(nodeNames))
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for len(waiting) > 0 {
+		select {
+		case n := <-events:
+			i, ok := waiting[n.NodeName]
+			if !ok || n.Health == nil || n.Health.Received < start {
+				continue
+			}
+			if n.Health.UpdateError != "" {
+				results[i].Status = PushFailed
+				results[i].Error = n.Health.UpdateError
+			} else {
+				results[i].Status = PushUpdated
+			}
+			delete(waiting, n.NodeName)
+		case <-timer.C:
+			return results
+		case <-serverDone:
+			return results
+		case <-ctx.Done():
+			return results
+		}
+	}
+	return results
+}
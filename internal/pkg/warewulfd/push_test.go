@@ -0,0 +1,134 @@
+package warewulfd
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const pushTestNodes = `nodes:
+  n1:
+    network devices:
+      default:
+        hwaddr: 00:00:00:ff:ff:ff
+  n2:
+    network devices:
+      default:
+        hwaddr: 00:00:00:00:ff:ff`
+
+func Test_NotifySend(t *testing.T) {
+	provisionTestEnv(t, pushTestNodes)
+	defer func(timeout time.Duration) { notifyTimeout = timeout }(notifyTimeout)
+	notifyTimeout = 100 * time.Millisecond
+
+	notify := func(url string) int {
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		req.RemoteAddr = "10.10.10.10:986"
+		w := httptest.NewRecorder()
+		NotifySend(w, req)
+		return w.Result().StatusCode
+	}
+
+	t.Run("unknown node", func(t *testing.T) {
+		assert.Equal(t, 404, notify("/notify/00:00:00:00:00:01"))
+	})
+	t.Run("timeout", func(t *testing.T) {
+		assert.Equal(t, 204, notify("/notify/00:00:00:ff:ff:ff"))
+		assert.Empty(t, notifyWaiters)
+	})
+	t.Run("push", func(t *testing.T) {
+		notifyTimeout = 10 * time.Second
+		status := make(chan int)
+		go func() {
+			status <- notify("/notify/00:00:00:ff:ff:ff")
+		}()
+		assert.Eventually(t, func() bool { return notifyNode("n1") }, time.Second, 10*time.Millisecond)
+		select {
+		case s := <-status:
+			assert.Equal(t, 200, s)
+		case <-time.After(5 * time.Second):
+			t.Fatal("no notification")
+		}
+		assert.False(t, notifyNode("n1"))
+	})
+}
+
+func Test_localRequest(t *testing.T) {
+	tests := map[string]struct {
+		remote string
+		local  string
+		result bool
+	}{
+		"loopback":    {"127.0.0.1:40000", "127.0.0.1:9873", true},
+		"server addr": {"10.0.0.1:40000", "10.0.0.1:9873", true},
+		"remote":      {"10.0.0.2:40000", "10.0.0.1:9873", false},
+		"invalid":     {"foo", "10.0.0.1:9873", false},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/push?node=n1", nil)
+			req.RemoteAddr = tt.remote
+			local, err := net.ResolveTCPAddr("tcp", tt.local)
+			require.NoError(t, err)
+			req = req.WithContext(context.WithValue(req.Context(), http.LocalAddrContextKey, local))
+			assert.Equal(t, tt.result, localRequest(req))
+		})
+	}
+}
+
+func Test_PushSend(t *testing.T) {
+	provisionTestEnv(t, pushTestNodes)
+
+	tests := map[string]struct {
+		method string
+		url    string
+		remote string
+		status int
+	}{
+		"get":         {http.MethodGet, "/push?node=n1", "127.0.0.1:40000", 405},
+		"remote":      {http.MethodPost, "/push?node=n1", "10.10.10.10:40000", 403},
+		"no node":     {http.MethodPost, "/push", "127.0.0.1:40000", 400},
+		"bad timeout": {http.MethodPost, "/push?node=n1&timeout=x", "127.0.0.1:40000", 400},
+		"push":        {http.MethodPost, "/push?node=n1&timeout=1", "127.0.0.1:40000", 200},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.url, nil)
+			req.RemoteAddr = tt.remote
+			w := httptest.NewRecorder()
+			PushSend(w, req)
+			res := w.Result()
+			defer res.Body.Close()
+			assert.Equal(t, tt.status, res.StatusCode)
+		})
+	}
+}
+
+func Test_pushUpdates(t *testing.T) {
+	provisionTestEnv(t, pushTestNodes)
+
+	// n1 waits for notifications and reports a failed update
+	notified := addNotifyWaiter("n1")
+	defer removeNotifyWaiter("n1", notified)
+	go func() {
+		<-notified
+		req := httptest.NewRequest(http.MethodPost, "/health/00:00:00:ff:ff:ff",
+			strings.NewReader(`{"update error": "could not extract 1 paths of the runtime overlay"}`))
+		req.RemoteAddr = "10.10.10.10:987"
+		HealthReceive(httptest.NewRecorder(), req)
+	}()
+
+	results := pushUpdates(context.Background(), []string{"n1", "n2", "n3"}, 5*time.Second)
+	assert.Equal(t, []PushResult{
+		{Node: "n1", Status: PushFailed, Error: "could not extract 1 paths of the runtime overlay"},
+		{Node: "n2", Status: PushNotConnected},
+		{Node: "n3", Status: PushUnknownNode},
+	}, results)
+}
@@ -2,17 +2,24 @@ package warewulfd
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"os"
+	"path"
 	"sync"
 	"time"
 
+	warewulfconf "github.com/warewulf/warewulf/internal/pkg/config"
 	"github.com/warewulf/warewulf/internal/pkg/node"
+	"github.com/warewulf/warewulf/internal/pkg/nodehealth"
 	"github.com/warewulf/warewulf/internal/pkg/wwlog"
 )
 
 type allStatus struct {
 	Nodes map[string]*NodeStatus `json:"nodes"`
+	// current transfers, only included in responses
+	Transfers *transferStatus `json:"transfers,omitempty"`
 }
 
 type NodeStatus struct {
@@ -21,29 +28,71 @@ type NodeStatus struct {
 	Sent     string `json:"sent"`
 	Ipaddr   string `json:"ipaddr"`
 	Lastseen int64  `json:"last seen"`
+	// ETag of the runtime overlay the node has
+	RuntimeETag string `json:"runtime etag,omitempty"`
+	// whether the runtime overlay of the node is current or outdated,
+	// only included in responses
+	RuntimeOverlay string `json:"runtime overlay,omitempty"`
+	// last health report of the node
+	Health *nodehealth.Health `json:"health,omitempty"`
 }
 
 var (
 	statusDB allStatus
 	dbLock   = sync.RWMutex{}
+	// set once the status DB was restored from the state file
+	statusRestored bool
+	// counts the changes of the status DB, and the changes which were
+	// persisted, so that the state file is only written if it changed
+	statusVersion    uint64
+	persistedVersion uint64
+	// serializes writes of the state file
+	persistLock = sync.Mutex{}
 )
 
+// interval in which the status DB is written to the state file
+const statusFlushInterval = 30 * time.Second
+
 func init() {
 	statusDB.Nodes = make(map[string]*NodeStatus)
 }
 
+/*
+Populates the status DB with all configured nodes. On the first call the
+status persisted by a previous warewulfd is restored from the state
+file. Entries of nodes which no longer exist are pruned.
+*/
 func LoadNodeStatus() error {
+	yml, err := node.New()
+	if err != nil {
+		return err
+	}
+	return setNodeStatus(yml)
+}
+
+/*
+Populates the status DB with the given nodes. On errors the current
+status DB is kept.
+*/
+func setNodeStatus(yml node.NodesYaml) error {
 	dbLock.Lock()
 	defer dbLock.Unlock()
+	if !statusRestored {
+		restored, err := readNodeStatus(warewulfconf.Get().Paths.NodeStatusFile())
+		if err != nil {
+			wwlog.Warn("Could not restore node status: %s", err)
+		} else {
+			for id, n := range restored.Nodes {
+				statusDB.Nodes[id] = n
+			}
+		}
+		statusRestored = true
+	}
+
 	var newDB allStatus
 	newDB.Nodes = make(map[string]*NodeStatus)
 
-	DB, err := node.New()
-	if err != nil {
-		return err
-	}
-
-	nodes, err := DB.FindAllNodes()
+	nodes, err := yml.FindAllNodes()
 	if err != nil {
 		return err
 	}
@@ -58,6 +107,7 @@ func LoadNodeStatus() error {
 	}
 
 	statusDB = newDB
+	pruneHistory(newDB.Nodes)
 	return nil
 }
 
@@ -75,16 +125,181 @@ func updateStatus(nodeID, stage, sent, ipaddr string) {
 		Sent:     sent,
 		Ipaddr:   ipaddr,
 	}
+	if old, ok := statusDB.Nodes[nodeID]; ok {
+		n.RuntimeETag = old.RuntimeETag
+		n.Health = old.Health
+	}
 	statusDB.Nodes[nodeID] = &n
+	statusVersion++
+	publishStatus(n)
 }
 
-func statusJSON() ([]byte, error) {
+/*
+Records the ETag of the runtime overlay a node was sent or already had
+*/
+func setRuntimeETag(nodeID, etag string) {
+	dbLock.Lock()
+	defer dbLock.Unlock()
+	n, ok := statusDB.Nodes[nodeID]
+	if !ok {
+		n = &NodeStatus{NodeName: nodeID}
+		statusDB.Nodes[nodeID] = n
+	}
+	if n.RuntimeETag != etag {
+		n.RuntimeETag = etag
+		statusVersion++
+	}
+}
+
+/*
+Returns what was last sent to a node, or the reason its last request was
+refused
+*/
+func lastSent(nodeID string) string {
 	dbLock.RLock()
 	defer dbLock.RUnlock()
+	if n, ok := statusDB.Nodes[nodeID]; ok {
+		return n.Sent
+	}
+	return ""
+}
+
+/*
+Records a health report of a node, which counts as the node being seen
+*/
+func setNodeHealth(nodeID, ipaddr string, health *nodehealth.Health) {
+	dbLock.Lock()
+	defer dbLock.Unlock()
+	n := NodeStatus{NodeName: nodeID}
+	if old, ok := statusDB.Nodes[nodeID]; ok {
+		n = *old
+	}
+	n.Health = health
+	n.Lastseen = health.Received
+	n.Ipaddr = ipaddr
+	statusDB.Nodes[nodeID] = &n
+	statusVersion++
+	publishStatus(n)
+}
+
+/*
+Reads a status DB from the given state file. A missing file results in
+an empty DB.
+*/
+func readNodeStatus(fileName string) (ret allStatus, err error) {
+	ret.Nodes = make(map[string]*NodeStatus)
+	data, err := os.ReadFile(fileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return ret, nil
+	} else if err != nil {
+		return ret, err
+	}
+	err = json.Unmarshal(data, &ret)
+	if err != nil {
+		return ret, fmt.Errorf("could not parse %s: %w", fileName, err)
+	}
+	if ret.Nodes == nil {
+		ret.Nodes = make(map[string]*NodeStatus)
+	}
+	return ret, nil
+}
 
+/*
+Writes the status DB to the state file. The file is replaced atomically
+so that a crash never leaves a truncated state file behind. The status DB
+is only locked while it is marshaled, so that status updates don't wait
+for the disk.
+*/
+func PersistNodeStatus() error {
+	persistLock.Lock()
+	defer persistLock.Unlock()
+	dbLock.RLock()
+	data, err := json.Marshal(statusDB)
+	version := statusVersion
+	dbLock.RUnlock()
+	if err != nil {
+		return fmt.Errorf("could not marshal JSON data from status structure: %w", err)
+	}
+	fileName := warewulfconf.Get().Paths.NodeStatusFile()
+	if err := os.MkdirAll(path.Dir(fileName), 0o755); err != nil {
+		return err
+	}
+	tmpFile, err := os.CreateTemp(path.Dir(fileName), ".status-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+	if _, err := tmpFile.Write(data); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpFile.Name(), fileName); err != nil {
+		return err
+	}
+	dbLock.Lock()
+	persistedVersion = version
+	dbLock.Unlock()
+	wwlog.Debug("persisted node status: %s", fileName)
+	return nil
+}
+
+/*
+Returns true if the status DB changed since it was last persisted
+*/
+func statusDirty() bool {
+	dbLock.RLock()
+	defer dbLock.RUnlock()
+	return statusVersion != persistedVersion
+}
+
+/*
+Periodically writes the status DB to the state file, if it has changed.
+*/
+func persistNodeStatusLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if !statusDirty() {
+			continue
+		}
+		if err := PersistNodeStatus(); err != nil {
+			wwlog.Error("Could not persist node status: %s", err)
+		}
+	}
+}
+
+func statusJSON() ([]byte, error) {
 	wwlog.Debug("Request for node status data...")
 
-	ret, err := json.MarshalIndent(statusDB, "", "  ")
+	dbLock.RLock()
+	nodes := make(map[string]*NodeStatus, len(statusDB.Nodes))
+	for id, n := range statusDB.Nodes {
+		status := *n
+		nodes[id] = &status
+	}
+	dbLock.RUnlock()
+
+	// overlay images are hashed without holding the lock
+	for id, n := range nodes {
+		if n.RuntimeETag == "" {
+			continue
+		}
+		if current, err := runtimeOverlayCurrent(id, n.RuntimeETag); err != nil {
+			wwlog.Debug("could not check runtime overlay of %s: %s", id, err)
+		} else if current {
+			n.RuntimeOverlay = "current"
+		} else {
+			n.RuntimeOverlay = "outdated"
+		}
+	}
+
+	ret, err := json.MarshalIndent(allStatus{
+		Nodes:     nodes,
+		Transfers: transfers.status(),
+	}, "", "  ")
 	if err != nil {
 		return ret, fmt.Errorf("could not marshal JSON data from status structure: %w", err)
 	}
@@ -0,0 +1,64 @@
+package warewulfd
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	warewulfconf "github.com/warewulf/warewulf/internal/pkg/config"
+	"github.com/warewulf/warewulf/internal/pkg/testenv"
+)
+
+func Test_LoadNodeStatusRestore(t *testing.T) {
+	env := testenv.New(t)
+	defer env.RemoveAll()
+	env.WriteFile("etc/warewulf/nodes.conf", `nodes:
+  n1: {}
+  n2: {}`)
+	env.WriteFile("var/local/warewulf/status.json", `{"nodes": {
+  "n1": {"node name": "n1", "stage": "RUNTIME_OVERLAY", "sent": "__RUNTIME__.img.gz", "ipaddr": "10.0.0.1", "last seen": 1000},
+  "deleted": {"node name": "deleted", "stage": "IPXE", "sent": "default.ipxe", "ipaddr": "10.0.0.2", "last seen": 1000}}}`)
+
+	statusDB.Nodes = make(map[string]*NodeStatus)
+	statusRestored = false
+	defer func() {
+		statusDB.Nodes = make(map[string]*NodeStatus)
+		statusRestored = false
+	}()
+
+	assert.NoError(t, LoadNodeStatus())
+	assert.Len(t, statusDB.Nodes, 2)
+	assert.Equal(t, "RUNTIME_OVERLAY", statusDB.Nodes["n1"].Stage)
+	assert.Equal(t, int64(1000), statusDB.Nodes["n1"].Lastseen)
+	assert.Equal(t, "n2", statusDB.Nodes["n2"].NodeName)
+	assert.Equal(t, int64(0), statusDB.Nodes["n2"].Lastseen)
+	assert.NotContains(t, statusDB.Nodes, "deleted")
+}
+
+func Test_PersistNodeStatus(t *testing.T) {
+	env := testenv.New(t)
+	defer env.RemoveAll()
+
+	statusDB.Nodes = make(map[string]*NodeStatus)
+	defer func() {
+		statusDB.Nodes = make(map[string]*NodeStatus)
+	}()
+
+	updateStatus("n1", "KERNEL", "vmlinuz", "10.0.0.1")
+	assert.True(t, statusDirty())
+	assert.NoError(t, PersistNodeStatus())
+	assert.False(t, statusDirty())
+
+	fileName := warewulfconf.Get().Paths.NodeStatusFile()
+	assert.FileExists(t, fileName)
+	restored, err := readNodeStatus(fileName)
+	assert.NoError(t, err)
+	assert.Equal(t, "KERNEL", restored.Nodes["n1"].Stage)
+	assert.Equal(t, "vmlinuz", restored.Nodes["n1"].Sent)
+
+	assert.NoError(t, os.Remove(fileName))
+	restored, err = readNodeStatus(fileName)
+	assert.NoError(t, err)
+	assert.Empty(t, restored.Nodes)
+}
@@ -0,0 +1,124 @@
+package warewulfd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/warewulf/warewulf/internal/pkg/hostlist"
+	"github.com/warewulf/warewulf/internal/pkg/wwlog"
+)
+
+/*
+Streaming feed of the status DB, sent as Server-Sent Events on
+/status/stream. Every update of a node status is published to all
+subscribers.
+*/
+
+// number of events buffered for each subscriber before events are dropped
+const statusSubscriberBuffer = 256
+
+// interval in which a comment is sent to keep idle streams open
+var statusKeepalive = 15 * time.Second
+
+var (
+	statusSubscribers     = make(map[chan NodeStatus]struct{})
+	statusSubscribersLock = sync.Mutex{}
+)
+
+/*
+Registers a new subscriber for status updates. The returned channel must
+be released with unsubscribeStatus.
+*/
+func subscribeStatus() chan NodeStatus {
+	ch := make(chan NodeStatus, statusSubscriberBuffer)
+	statusSubscribersLock.Lock()
+	defer statusSubscribersLock.Unlock()
+	statusSubscribers[ch] = struct{}{}
+	return ch
+}
+
+func unsubscribeStatus(ch chan NodeStatus) {
+	statusSubscribersLock.Lock()
+	defer statusSubscribersLock.Unlock()
+	delete(statusSubscribers, ch)
+}
+
+/*
+Sends a status update to all subscribers. A subscriber which doesn't
+keep up misses the update instead of blocking the provisioning service.
+*/
+func publishStatus(n NodeStatus) {
+	statusSubscribersLock.Lock()
+	defer statusSubscribersLock.Unlock()
+	for ch := range statusSubscribers {
+		select {
+		case ch <- n:
+		default:
+			wwlog.Debug("dropping status update of %s for slow subscriber", n.NodeName)
+		}
+	}
+}
+
+/*
+Streams status updates as Server-Sent Events until the client
+disconnects. The stream can be limited to nodes with one or more node
+query parameters, which may contain host ranges.
+*/
+func StatusStreamSend(w http.ResponseWriter, req *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	var filter map[string]bool
+	if nodes := req.URL.Query()["node"]; len(nodes) > 0 {
+		filter = make(map[string]bool)
+		for _, n := range hostlist.Expand(nodes) {
+			filter[n] = true
+		}
+	}
+
+	events := subscribeStatus()
+	defer unsubscribeStatus(events)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	wwlog.Verbose("status stream opened by %s", req.RemoteAddr)
+
+	keepalive := time.NewTicker(statusKeepalive)
+	defer keepalive.Stop()
+	for {
+		select {
+		case <-req.Context().Done():
+			wwlog.Verbose("status stream closed by %s", req.RemoteAddr)
+			return
+		case <-serverDone:
+			return
+		case n := <-events:
+			if filter != nil && !filter[n.NodeName] {
+				continue
+			}
+			data, err := json.Marshal(n)
+			if err != nil {
+				wwlog.Warn("Could not marshal status of %s: %s", n.NodeName, err)
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: status\ndata: %s\n\n", data); err != nil {
+				wwlog.Verbose("Could not send status event: %s", err)
+				return
+			}
+			flusher.Flush()
+		case <-keepalive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
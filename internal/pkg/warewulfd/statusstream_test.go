@@ -0,0 +1,93 @@
+package warewulfd
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// waits until the given number of status subscribers are registered
+func waitForSubscribers(t *testing.T, count int) {
+	for i := 0; i < 100; i++ {
+		statusSubscribersLock.Lock()
+		n := len(statusSubscribers)
+		statusSubscribersLock.Unlock()
+		if n >= count {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("no status subscriber registered")
+}
+
+func Test_StatusStreamSend(t *testing.T) {
+	statusDB.Nodes = make(map[string]*NodeStatus)
+	defer func() {
+		statusDB.Nodes = make(map[string]*NodeStatus)
+	}()
+
+	tests := map[string]struct {
+		query   string
+		updates []string
+		expect  []string
+	}{
+		"all nodes": {
+			query:   "",
+			updates: []string{"n1", "n2"},
+			expect:  []string{"n1", "n2"},
+		},
+		"filtered": {
+			query:   "?node=n[2-3]",
+			updates: []string{"n1", "n2", "n4", "n3"},
+			expect:  []string{"n2", "n3"},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(StatusStreamSend))
+			defer server.Close()
+
+			resp, err := http.Get(server.URL + tt.query)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+			waitForSubscribers(t, 1)
+
+			for _, n := range tt.updates {
+				updateStatus(n, "KERNEL", "vmlinuz", "10.0.0.1")
+			}
+
+			scanner := bufio.NewScanner(resp.Body)
+			var received []string
+			for len(received) < len(tt.expect) && scanner.Scan() {
+				line := scanner.Text()
+				if !strings.HasPrefix(line, "data: ") {
+					continue
+				}
+				var n NodeStatus
+				require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &n))
+				assert.Equal(t, "KERNEL", n.Stage)
+				received = append(received, n.NodeName)
+			}
+			assert.Equal(t, tt.expect, received)
+		})
+	}
+}
+
+func Test_publishStatusSlowSubscriber(t *testing.T) {
+	events := subscribeStatus()
+	defer unsubscribeStatus(events)
+
+	for i := 0; i < statusSubscriberBuffer+10; i++ {
+		publishStatus(NodeStatus{NodeName: "n1"})
+	}
+	assert.Len(t, events, statusSubscriberBuffer)
+}
@@ -0,0 +1,160 @@
+package warewulfd
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	warewulfconf "github.com/warewulf/warewulf/internal/pkg/config"
+	"github.com/warewulf/warewulf/internal/pkg/tftp"
+	"github.com/warewulf/warewulf/internal/pkg/wwlog"
+)
+
+/*
+Built-in read-only TFTP server, which serves the iPXE binaries and the
+shim and grub binaries of the host directly from their source locations
+instead of copies in the TFTP root of an external TFTP server.
+*/
+
+// port of the TFTP listeners
+var tftpPort = 69
+
+// files served over TFTP, built once for each loaded configuration
+var tftpFileMap struct {
+	sync.Mutex
+	conf  *warewulfconf.WarewulfYaml
+	files map[string]string
+}
+
+/*
+Returns the files served over TFTP by their path relative to the TFTP
+root, and their source locations. The files are looked up again once
+warewulf.conf was reloaded, e.g. on SIGHUP.
+*/
+func tftpFiles() map[string]string {
+	conf := warewulfconf.Get()
+	tftpFileMap.Lock()
+	defer tftpFileMap.Unlock()
+	if tftpFileMap.conf != conf {
+		tftpFileMap.files = findTFTPFiles(conf)
+		tftpFileMap.conf = conf
+	}
+	return tftpFileMap.files
+}
+
+func findTFTPFiles(conf *warewulfconf.WarewulfYaml) map[string]string {
+	files := make(map[string]string)
+	for _, f := range conf.TFTP.IpxeBinaries {
+		if !path.IsAbs(f) {
+			f = path.Join(conf.Paths.Ipxesource, f)
+		}
+		files[path.Join("warewulf", path.Base(f))] = f
+	}
+	shimGrub, err := shimGrubFiles()
+	if err != nil {
+		wwlog.Debug("not serving shim and grub over tftp: %s", err)
+	}
+	for name, f := range shimGrub {
+		files[path.Join("warewulf", name)] = f
+	}
+	return files
+}
+
+func tftpOpen(filename string, remote net.Addr) (io.ReadCloser, int64, error) {
+	name := path.Clean(strings.TrimLeft(filename, "/"))
+	source, ok := tftpFiles()[name]
+	if !ok {
+		wwlog.Error("tftp: not found: %s", filename)
+		return nil, 0, tftp.ErrNotFound
+	}
+	file, err := os.Open(source)
+	if err != nil {
+		wwlog.Error("tftp: %s", err)
+		if os.IsNotExist(err) {
+			return nil, 0, tftp.ErrNotFound
+		}
+		return nil, 0, err
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+	wwlog.Info("tftp: send %s -> %s", source, remote)
+	return file, stat.Size(), nil
+}
+
+/*
+Accounts a finished TFTP transfer in the metrics, and in the status and
+history of the node, if it is known
+*/
+func tftpDone(filename string, remote net.Addr, sent int64, duration time.Duration, err error) {
+	status := http.StatusOK
+	if errors.Is(err, tftp.ErrNotFound) {
+		status = http.StatusNotFound
+	} else if err != nil {
+		wwlog.Warn("tftp: transfer of %s to %s failed: %s", filename, remote, err)
+		status = http.StatusInternalServerError
+	}
+	metrics.observeRequest("tftp", status, sent, duration)
+
+	ipaddr, _, _ := net.SplitHostPort(remote.String())
+	nodeID := nodeIDByIP(ipaddr)
+	if nodeID == "" {
+		wwlog.Verbose("tftp: unknown node: %s", ipaddr)
+		return
+	}
+	sentName := path.Base(filename)
+	if status == http.StatusNotFound {
+		sentName = "NOT_FOUND"
+	} else if status != http.StatusOK {
+		sentName = "FAILED"
+	}
+	start := time.Now().Add(-duration)
+	updateStatus(nodeID, "TFTP", sentName, ipaddr)
+	addHistory(nodeID, NodeEvent{
+		Time:     start.Unix(),
+		Stage:    "TFTP",
+		Sent:     sentName,
+		Bytes:    sent,
+		Status:   status,
+		Ipaddr:   ipaddr,
+		Duration: duration.Seconds(),
+	})
+}
+
+/*
+Starts TFTP listeners on the given addresses. Errors of running
+listeners are sent to errs.
+*/
+func startTFTP(addrs []string, errs chan<- error) (conns []net.PacketConn, err error) {
+	server := &tftp.Server{Handler: tftpOpen, Done: tftpDone}
+	for _, addr := range addrs {
+		conn, err := net.ListenPacket("udp", addr)
+		if err != nil {
+			closeConns(conns)
+			return nil, err
+		}
+		conns = append(conns, conn)
+		go func() {
+			if err := server.Serve(conn); err != nil {
+				errs <- err
+			}
+		}()
+		wwlog.Info("listening for tftp requests on %s", addr)
+	}
+	return conns, nil
+}
+
+// closes the listeners of the tftp and proxydhcp services
+func closeConns(conns []net.PacketConn) {
+	for _, conn := range conns {
+		conn.Close()
+	}
+}
@@ -0,0 +1,92 @@
+package warewulfd
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	warewulfconf "github.com/warewulf/warewulf/internal/pkg/config"
+	"github.com/warewulf/warewulf/internal/pkg/testenv"
+)
+
+func Test_tftpFiles(t *testing.T) {
+	env := testenv.New(t)
+	defer env.RemoveAll()
+
+	conf := warewulfconf.Get()
+	conf.TFTP.IpxeBinaries = map[string]string{
+		"00:00": "undionly.kpxe",
+		"00:07": "/opt/ipxe/ipxe-snponly-x86_64.efi",
+		"00:09": "/opt/ipxe/ipxe-snponly-x86_64.efi",
+	}
+	files := tftpFiles()
+	assert.Equal(t, conf.Paths.Ipxesource+"/undionly.kpxe", files["warewulf/undionly.kpxe"])
+	assert.Equal(t, "/opt/ipxe/ipxe-snponly-x86_64.efi", files["warewulf/ipxe-snponly-x86_64.efi"])
+
+	// the files are only looked up again for a reloaded configuration
+	conf.TFTP.IpxeBinaries = map[string]string{"00:00": "ipxe.efi"}
+	assert.Equal(t, files, tftpFiles())
+	require.NoError(t, warewulfconf.Reload(false, func(old, conf *warewulfconf.WarewulfYaml) {
+		conf.TFTP.IpxeBinaries = map[string]string{"00:00": "ipxe.efi"}
+	}))
+	files = tftpFiles()
+	assert.Contains(t, files, "warewulf/ipxe.efi")
+	assert.NotContains(t, files, "warewulf/undionly.kpxe")
+}
+
+func Test_startTFTP(t *testing.T) {
+	env := testenv.New(t)
+	defer env.RemoveAll()
+
+	env.WriteFile("etc/warewulf/nodes.conf", `nodes:
+  n1:
+    network devices:
+      default:
+        hwaddr: 00:00:00:ff:ff:ff
+        ipaddr: 127.0.0.1`)
+	env.WriteFile("usr/share/ipxe/undionly.kpxe", "ipxe binary")
+	prevArpFile := arpFile
+	arpFile = env.GetPath("/var/tmp/arpcache")
+	defer func() {
+		arpFile = prevArpFile
+	}()
+	assert.NoError(t, LoadNodeDB())
+	statusDB.Nodes = make(map[string]*NodeStatus)
+	defer func() {
+		statusDB.Nodes = make(map[string]*NodeStatus)
+	}()
+
+	conf := warewulfconf.Get()
+	conf.TFTP.IpxeBinaries = map[string]string{"00:00": env.GetPath("usr/share/ipxe/undionly.kpxe")}
+
+	errs := make(chan error, 1)
+	conns, err := startTFTP([]string{"127.0.0.1:0"}, errs)
+	require.NoError(t, err)
+	defer closeConns(conns)
+
+	client, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer client.Close()
+	_, err = client.WriteTo([]byte("\x00\x01/warewulf/undionly.kpxe\x00octet\x00"), conns[0].LocalAddr())
+	require.NoError(t, err)
+
+	buf := make([]byte, 1024)
+	require.NoError(t, client.SetReadDeadline(time.Now().Add(2*time.Second)))
+	n, server, err := client.ReadFrom(buf)
+	require.NoError(t, err)
+	assert.Equal(t, uint16(3), binary.BigEndian.Uint16(buf))
+	assert.Equal(t, "ipxe binary", string(buf[4:n]))
+	_, err = client.WriteTo([]byte{0, 4, 0, 1}, server)
+	require.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		dbLock.RLock()
+		defer dbLock.RUnlock()
+		n, ok := statusDB.Nodes["n1"]
+		return ok && n.Stage == "TFTP" && n.Sent == "undionly.kpxe" && n.Ipaddr == "127.0.0.1"
+	}, time.Second, 10*time.Millisecond)
+}
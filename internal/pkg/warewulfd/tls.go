@@ -0,0 +1,42 @@
+package warewulfd
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	warewulfconf "github.com/warewulf/warewulf/internal/pkg/config"
+)
+
+/*
+Builds the TLS configuration for the TLS listener from the certificate,
+key and optional client CA configured in warewulf.conf. If a client CA
+is configured, clients have to present a certificate signed by it.
+*/
+func tlsConfig(conf warewulfconf.TLSConf) (*tls.Config, error) {
+	if conf.Cert == "" || conf.Key == "" {
+		return nil, fmt.Errorf("tls is enabled but no certificate or key is configured")
+	}
+	cert, err := tls.LoadX509KeyPair(conf.Cert, conf.Key)
+	if err != nil {
+		return nil, fmt.Errorf("could not load certificate %s: %w", conf.Cert, err)
+	}
+	ret := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if conf.ClientCA != "" {
+		pem, err := os.ReadFile(conf.ClientCA)
+		if err != nil {
+			return nil, fmt.Errorf("could not read client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in client CA: %s", conf.ClientCA)
+		}
+		ret.ClientCAs = pool
+		ret.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return ret, nil
+}
@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/warewulf/warewulf/internal/pkg/config"
 	"github.com/warewulf/warewulf/internal/pkg/node"
@@ -58,7 +59,13 @@ func getOverlayFile(n node.Node, context string, stage_overlays []string, autobu
 	}
 
 	if build {
-		registry, err := node.New()
+		start := time.Now()
+		var registry node.NodesYaml
+		var err error
+		defer func() {
+			metrics.observeOverlayBuild(time.Since(start), err)
+		}()
+		registry, err = node.New()
 		if err != nil {
 			wwlog.Error("Failed to build overlay: %s, %s, %s\n%s",
 				n.Id(), stage_overlays, stage_file, err)
@@ -1,20 +1,24 @@
 package warewulfd
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"reflect"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
+	"time"
 
 	warewulfconf "github.com/warewulf/warewulf/internal/pkg/config"
 	"github.com/warewulf/warewulf/internal/pkg/wwlog"
 )
 
-// TODO: https://github.com/danderson/netboot/blob/master/pixiecore/dhcp.go
-// TODO: https://github.com/pin/tftp
 /*
 wrapper type for the server mux as shim requests http://efiboot//grub.efi
 which is filtered out by http to `301 Moved Permanently` what
@@ -33,26 +37,105 @@ func (h *slashFix) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	h.mux.ServeHTTP(w, r)
 }
 
+// time to wait for in-flight transfers on shutdown
+const shutdownTimeout = 60 * time.Second
+
+// closed when the server shuts down, to end long-lived requests
+var serverDone = make(chan struct{})
+
+/*
+Returns the addresses to listen on for the given port, which are all
+interfaces if no listen addresses are configured.
+*/
+func listenAddrs(listen []string, port int) (ret []string) {
+	if len(listen) == 0 {
+		return []string{":" + strconv.Itoa(port)}
+	}
+	for _, addr := range listen {
+		ret = append(ret, net.JoinHostPort(addr, strconv.Itoa(port)))
+	}
+	return ret
+}
+
+/*
+Re-reads warewulf.conf. Settings of the listeners can't be changed
+while running, so their previous values are kept until warewulfd is
+restarted.
+*/
+func reloadConf() error {
+	return warewulfconf.Reload(true, func(old, conf *warewulfconf.WarewulfYaml) {
+		if conf.Warewulf.Port != old.Warewulf.Port || !reflect.DeepEqual(conf.Warewulf.Listen, old.Warewulf.Listen) || !reflect.DeepEqual(conf.Warewulf.TLS, old.Warewulf.TLS) {
+			wwlog.Warn("Changes of port, listen and tls require a restart of warewulfd")
+			conf.Warewulf.Port = old.Warewulf.Port
+			conf.Warewulf.Listen = old.Warewulf.Listen
+			conf.Warewulf.TLS = old.Warewulf.TLS
+		}
+		if conf.TFTP.Builtin() != old.TFTP.Builtin() {
+			wwlog.Warn("Changes of tftp:builtin require a restart of warewulfd")
+			conf.TFTP.BuiltinP = old.TFTP.BuiltinP
+		}
+		if conf.DHCP.Proxy() != old.DHCP.Proxy() {
+			wwlog.Warn("Changes of dhcp:proxy require a restart of warewulfd")
+			conf.DHCP.ProxyP = old.DHCP.ProxyP
+		}
+	})
+}
+
+/*
+Stops accepting new connections and waits for in-flight requests to
+complete, up to the given timeout.
+*/
+func shutdownServers(servers []*http.Server, timeout time.Duration) {
+	close(serverDone)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	var wg sync.WaitGroup
+	for _, server := range servers {
+		wg.Add(1)
+		go func(server *http.Server) {
+			defer wg.Done()
+			if err := server.Shutdown(ctx); err != nil {
+				wwlog.Warn("Could not drain connections on %s: %s", server.Addr, err)
+			}
+		}(server)
+	}
+	wg.Wait()
+}
+
 func RunServer() error {
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, syscall.SIGHUP)
 
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT)
+
 	go func() {
 		for range c {
 			wwlog.Warn("Received SIGHUP, reloading...")
-			err := LoadNodeDB()
+			err := reloadConf()
 			if err != nil {
-				wwlog.Error("Could not load node DB: %s", err)
+				wwlog.Error("Could not reload %s, keeping the current configuration: %s", warewulfconf.Get().GetWarewulfConf(), err)
 			}
 
-			err = LoadNodeStatus()
+			// reopens the access log, also after it was rotated externally
+			err = accessLog.configure(warewulfconf.Get().Warewulf.AccessLog)
 			if err != nil {
-				wwlog.Error("Could not prepopulate node status DB: %s", err)
+				wwlog.Error("Could not open access log: %s", err)
+			}
+
+			err = reloadNodes()
+			if err != nil {
+				wwlog.Error("Could not reload %s, keeping the current node DB: %s", warewulfconf.Get().Paths.NodesConf(), err)
 			}
 		}
 	}()
 
-	err := LoadNodeDB()
+	err := accessLog.configure(warewulfconf.Get().Warewulf.AccessLog)
+	if err != nil {
+		wwlog.Error("Could not open access log: %s", err)
+	}
+
+	err = LoadNodeDB()
 	if err != nil {
 		wwlog.Error("Could not load database: %s", err)
 	}
@@ -61,10 +144,21 @@ func RunServer() error {
 	if err != nil {
 		wwlog.Error("Could not prepopulate node status DB: %s", err)
 	}
+	go persistNodeStatusLoop(statusFlushInterval)
+	// the status DB is persisted on every exit, also if a listener failed
+	defer func() {
+		if err := PersistNodeStatus(); err != nil {
+			wwlog.Error("Could not persist node status: %s", err)
+		}
+	}()
 
+	nodesWatcher, err := watchNodesConf()
 	if err != nil {
-		wwlog.Warn("couldn't copy default shim: %s", err)
+		wwlog.Warn("Could not watch node configuration, changes require a reload of warewulfd: %s", err)
+	} else {
+		defer nodesWatcher.Close()
 	}
+
 	var wwHandler http.ServeMux
 	wwHandler.HandleFunc("/provision/", ProvisionSend)
 	wwHandler.HandleFunc("/ipxe/", ProvisionSend)
@@ -74,16 +168,76 @@ func RunServer() error {
 	wwHandler.HandleFunc("/overlay-system/", ProvisionSend)
 	wwHandler.HandleFunc("/overlay-runtime/", ProvisionSend)
 	wwHandler.HandleFunc("/overlay-file/", OverlaySend)
+	wwHandler.HandleFunc("/health/", HealthReceive)
+	wwHandler.HandleFunc("/notify/", NotifySend)
+	wwHandler.HandleFunc("/push", PushSend)
 	wwHandler.HandleFunc("/status", StatusSend)
+	wwHandler.HandleFunc("/status/stream", StatusStreamSend)
+	wwHandler.HandleFunc("/status/", StatusHistorySend)
+	wwHandler.HandleFunc("/metrics", MetricsSend)
+	wwHandler.HandleFunc("/discovery", DiscoverySend)
 
 	conf := warewulfconf.Get()
+	handler := &slashFix{&wwHandler}
 
-	daemonPort := conf.Warewulf.Port
-	err = http.ListenAndServe(":"+strconv.Itoa(daemonPort), &slashFix{&wwHandler})
+	var servers []*http.Server
+	var tlsServers []*http.Server
+	for _, addr := range listenAddrs(conf.Warewulf.Listen, conf.Warewulf.Port) {
+		servers = append(servers, &http.Server{Addr: addr, Handler: handler})
+	}
+	if conf.Warewulf.TLS.Enabled() {
+		tlsConf, err := tlsConfig(conf.Warewulf.TLS)
+		if err != nil {
+			return fmt.Errorf("could not configure tls listening service: %w", err)
+		}
+		for _, addr := range listenAddrs(conf.Warewulf.Listen, conf.Warewulf.TLS.Port) {
+			tlsServers = append(tlsServers, &http.Server{Addr: addr, Handler: handler, TLSConfig: tlsConf})
+		}
+	}
 
+	var tftpAddrs []string
+	if conf.TFTP.Builtin() {
+		tftpAddrs = listenAddrs(conf.Warewulf.Listen, tftpPort)
+	}
+	var proxyDHCPAddrs []string
+	if conf.DHCP.Proxy() {
+		proxyDHCPAddrs = listenAddrs(conf.Warewulf.Listen, pxePort)
+	}
+
+	errs := make(chan error, len(servers)+len(tlsServers)+len(tftpAddrs)+len(proxyDHCPAddrs)+1)
+	tftpConns, err := startTFTP(tftpAddrs, errs)
 	if err != nil {
-		return fmt.Errorf("could not start listening service: %w", err)
+		return fmt.Errorf("could not start tftp service: %w", err)
+	}
+	defer closeConns(tftpConns)
+	proxyDHCPConns, err := startProxyDHCP(proxyDHCPAddrs, errs)
+	if err != nil {
+		return fmt.Errorf("could not start proxydhcp service: %w", err)
+	}
+	defer closeConns(proxyDHCPConns)
+	for _, server := range tlsServers {
+		go func(server *http.Server) {
+			if err := server.ListenAndServeTLS("", ""); !errors.Is(err, http.ErrServerClosed) {
+				errs <- err
+			}
+		}(server)
+		wwlog.Info("listening for tls connections on %s", server.Addr)
+	}
+	for _, server := range servers {
+		go func(server *http.Server) {
+			if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				errs <- err
+			}
+		}(server)
+		wwlog.Info("listening for connections on %s", server.Addr)
 	}
 
+	select {
+	case err = <-errs:
+		return fmt.Errorf("could not start listening service: %w", err)
+	case sig := <-stop:
+		wwlog.Warn("Received %s, draining connections...", sig)
+		shutdownServers(append(servers, tlsServers...), shutdownTimeout)
+	}
 	return nil
 }
@@ -0,0 +1,101 @@
+package warewulfd
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	warewulfconf "github.com/warewulf/warewulf/internal/pkg/config"
+	"github.com/warewulf/warewulf/internal/pkg/testenv"
+)
+
+func Test_listenAddrs(t *testing.T) {
+	assert.Equal(t, []string{":9873"}, listenAddrs(nil, 9873))
+	assert.Equal(t, []string{"10.0.0.1:9873", "[fd00::1]:9873"}, listenAddrs([]string{"10.0.0.1", "fd00::1"}, 9873))
+}
+
+func Test_reloadConf(t *testing.T) {
+	env := testenv.New(t)
+	defer env.RemoveAll()
+
+	assert.True(t, warewulfconf.Get().Warewulf.Secure())
+	env.WriteFile("etc/warewulf/warewulf.conf", `warewulf:
+  secure: false
+  update interval: 30
+  port: 9999
+  listen:
+  - 10.0.0.1`)
+	assert.NoError(t, reloadConf())
+	conf := warewulfconf.Get()
+	assert.False(t, conf.Warewulf.Secure())
+	assert.Equal(t, 30, conf.Warewulf.UpdateInterval)
+	assert.Equal(t, 9873, conf.Warewulf.Port)
+	assert.Empty(t, conf.Warewulf.Listen)
+
+	env.WriteFile("etc/warewulf/warewulf.conf", `warewulf:
+  secure: [`)
+	assert.Error(t, reloadConf())
+	assert.False(t, warewulfconf.Get().Warewulf.Secure())
+}
+
+func Test_reloadConfConcurrent(t *testing.T) {
+	env := testenv.New(t)
+	defer env.RemoveAll()
+	env.WriteFile("etc/warewulf/warewulf.conf", `warewulf:
+  port: 9999`)
+
+	// handlers read the configuration while it is reloaded
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			assert.Equal(t, 9873, warewulfconf.Get().Warewulf.Port)
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, reloadConf())
+	}
+	<-done
+}
+
+func Test_shutdownServers(t *testing.T) {
+	serverDone = make(chan struct{})
+	defer func() {
+		serverDone = make(chan struct{})
+	}()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	started := make(chan struct{})
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		_, _ = w.Write([]byte("image"))
+	})}
+	go func() {
+		_ = server.Serve(listener)
+	}()
+
+	body := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://" + listener.Addr().String())
+		if err != nil {
+			body <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		body <- string(data)
+	}()
+
+	<-started
+	shutdownServers([]*http.Server{server}, 5*time.Second)
+	assert.Equal(t, "image", <-body)
+	_, err = http.Get("http://" + listener.Addr().String())
+	assert.Error(t, err)
+}
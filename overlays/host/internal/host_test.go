@@ -46,6 +46,13 @@ func Test_hostOverlay(t *testing.T) {
 			log:    host_dhcp_static,
 			header: "",
 		},
+		{
+			name:   "host:dhcp(http boot)",
+			conf:   "warewulf.conf-httpboot",
+			args:   []string{"--render", "host", "host", "etc/dhcp/dhcpd.conf.ww"},
+			log:    host_dhcp_httpboot,
+			header: "",
+		},
 		{
 			name:   "host:dnsmasq",
 			conf:   "warewulf.conf",
@@ -170,6 +177,81 @@ subnet 192.168.0.0 netmask 255.255.255.0 {
     range 192.168.0.100 192.168.0.199;
     next-server 192.168.0.1;
 }
+`
+
+const host_dhcp_httpboot string = `backupFile: true
+writeFile: true
+Filename: etc/dhcp/dhcpd.conf
+# This file is autogenerated by warewulf
+
+allow booting;
+allow bootp;
+ddns-update-style interim;
+authoritative;
+
+option space ipxe;
+
+# Tell iPXE to not wait for ProxyDHCP requests to speed up boot.
+option ipxe.no-pxedhcp code 176 = unsigned integer 8;
+option ipxe.no-pxedhcp 1;
+
+option space PXE;
+option PXE.mtftp-ip    code 1 = ip-address;
+option PXE.mtftp-cport code 2 = unsigned integer 16;
+option PXE.mtftp-sport code 3 = unsigned integer 16;
+option PXE.mtftp-tmout code 4 = unsigned integer 8;
+option PXE.mtftp-delay code 5 = unsigned integer 8;
+
+option architecture-type   code 93  = unsigned integer 16;
+if exists user-class and option user-class = "iPXE" {
+    filename "http://192.168.0.1:9873/ipxe/${mac:hexhyp}?assetkey=${asset}&uuid=${uuid}";
+} else {
+    if option architecture-type = 00:00 {
+        filename "/warewulf/undionly.kpxe";
+    }
+    if option architecture-type = 00:07 {
+        filename "/warewulf/ipxe-snponly-x86_64.efi";
+    }
+    if option architecture-type = 00:09 {
+        filename "/warewulf/ipxe-snponly-x86_64.efi";
+    }
+    if option architecture-type = 00:0B {
+        filename "/warewulf/snponly.efi";
+    }
+}
+if substring (option vendor-class-identifier, 0, 10) = "HTTPClient" {
+  # UEFI HTTP Boot clients load shim and grub from warewulfd
+  option vendor-class-identifier "HTTPClient";
+  filename "http://192.168.0.1:9873/efiboot/shim.efi";
+}
+subnet 192.168.0.0 netmask 255.255.255.0 {
+    max-lease-time 120;
+    range 192.168.0.100 192.168.0.199;
+    next-server 192.168.0.1;
+}
+host node1-default
+{
+    hardware ethernet e6:92:39:49:7b:03;
+    fixed-address 192.168.3.21;
+    option host-name "node1";
+}
+
+host node1-secondary
+{
+    hardware ethernet 9a:77:29:73:14:f1;
+    fixed-address 192.168.3.22;
+}
+
+
+host node2-default
+{
+    hardware ethernet e6:92:39:49:7b:04;
+    fixed-address 192.168.3.23;
+    option host-name "node2";
+}
+
+
+
 `
 
 const host_dhcp_static string = `backupFile: true
@@ -256,6 +338,7 @@ dhcp-match=set:aarch64,option:client-arch, 11 #EFI aarch64
 dhcp-match=set:iPXE,77,"iPXE"
 dhcp-userclass=set:iPXE,iPXE
 dhcp-vendorclass=set:efi-http,HTTPClient:Arch:00016
+dhcp-vendorclass=set:efi-http,HTTPClient:Arch:00019
 dhcp-option-force=tag:efi-http,60,HTTPClient
 # for http boot always use shim/grub
 dhcp-boot=tag:efi-http,"http://192.168.0.1:9873/efiboot/shim.efi"
@@ -17,6 +17,7 @@ func Test_wwinitOverlay(t *testing.T) {
 	env.ImportFile("etc/warewulf/nodes.conf", "nodes.conf")
 	env.ImportFile("var/lib/warewulf/overlays/wwinit/rootfs/etc/warewulf/warewulf.conf.ww", "../rootfs/etc/warewulf/warewulf.conf.ww")
 	env.ImportFile("var/lib/warewulf/overlays/wwinit/rootfs/warewulf/config.ww", "../rootfs/warewulf/config.ww")
+	env.ImportFile("var/lib/warewulf/overlays/wwinit/rootfs/warewulf/token.ww", "../rootfs/warewulf/token.ww")
 
 	tests := []struct {
 		name string
@@ -33,6 +34,11 @@ func Test_wwinitOverlay(t *testing.T) {
 			args: []string{"--render", "node1", "wwinit", "warewulf/config.ww"},
 			log:  wwinit_config,
 		},
+		{
+			name: "wwinit:token.ww",
+			args: []string{"--render", "node1", "wwinit", "warewulf/token.ww"},
+			log:  wwinit_token,
+		},
 	}
 
 	for _, tt := range tests {
@@ -85,6 +91,7 @@ const wwinit_config string = `backupFile: true
 writeFile: true
 Filename: warewulf/config
 WWIMAGE=rockylinux-9
+WWIMAGE_DIGEST=
 WWHOSTNAME=node1
 WWROOT=initramfs
 WWINIT=/sbin/init
@@ -95,3 +102,9 @@ WWIPMI_USER="user"
 WWIPMI_PASSWORD="password"
 WWIPMI_WRITE="true"
 `
+
+const wwinit_token string = `backupFile: true
+writeFile: false
+Filename: warewulf/token
+
+`